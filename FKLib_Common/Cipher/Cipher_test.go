@@ -0,0 +1,102 @@
+//---------------------------------------------
+package cipher
+
+//---------------------------------------------
+import (
+	"bytes"
+	RAND "crypto/rand"
+	RSA "crypto/rsa"
+	"testing"
+)
+
+//---------------------------------------------
+func TestHandshake(t *testing.T) {
+	priv, err := RSA.GenerateKey(RAND.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClientHandshake()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hello, server_enc, server_dec, err := ServerHandshake(priv, client.Nonce, client.Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client_enc, client_dec, err := client.Finish(&priv.PublicKey, hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 双向通信
+	for i := 0; i < 3; i++ {
+		msg := []byte("hello server")
+		p, err := server_dec.Open(client_enc.Seal(append([]byte(nil), msg...)))
+		if err != nil || !bytes.Equal(p, msg) {
+			t.Fatal("client->server:", err)
+		}
+		msg = []byte("hello client")
+		p, err = client_dec.Open(server_enc.Seal(append([]byte(nil), msg...)))
+		if err != nil || !bytes.Equal(p, msg) {
+			t.Fatal("server->client:", err)
+		}
+	}
+
+	// 被篡改的数据包
+	sealed := client_enc.Seal([]byte("tampered"))
+	sealed[0] ^= 0xff
+	if _, err := server_dec.Open(sealed); err != ERROR_DECRYPT {
+		t.Error("tampered packet should fail:", err)
+	}
+}
+
+//---------------------------------------------
+func TestHandshakeForged(t *testing.T) {
+	priv, _ := RSA.GenerateKey(RAND.Reader, 2048)
+	other, _ := RSA.GenerateKey(RAND.Reader, 2048)
+
+	client, _ := NewClientHandshake()
+	hello, _, _, err := ServerHandshake(priv, client.Nonce, client.Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 客户端预置的是另一个公钥，相当于中间人
+	if _, _, err := client.Finish(&other.PublicKey, hello); err != ERROR_BAD_SIGNATURE {
+		t.Error("forged server should fail:", err)
+	}
+	// 中间人替换了服务器公钥
+	hello.Public[10] ^= 1
+	if _, _, err := client.Finish(&priv.PublicKey, hello); err != ERROR_BAD_SIGNATURE {
+		t.Error("modified public key should fail:", err)
+	}
+}
+
+//---------------------------------------------
+func TestReplay(t *testing.T) {
+	key := make([]byte, 32)
+	enc, _ := NewGCMCodec(key)
+	dec, _ := NewGCMCodec(key)
+
+	p1 := enc.Seal([]byte("one"))
+	replay := append([]byte(nil), p1...)
+	if _, err := dec.Open(p1); err != nil {
+		t.Fatal(err)
+	}
+	// 相同的数据包再次到达，nonce已经前进
+	if _, err := dec.Open(replay); err != ERROR_DECRYPT {
+		t.Error("replayed packet should fail:", err)
+	}
+}
+
+//---------------------------------------------
+func TestRC4(t *testing.T) {
+	enc, _ := NewRC4Codec([]byte("DH12345"))
+	dec, _ := NewRC4Codec([]byte("DH12345"))
+	p, _ := dec.Open(enc.Seal([]byte("plain")))
+	if string(p) != "plain" {
+		t.Error("rc4 roundtrip failed")
+	}
+}
+
+//---------------------------------------------
@@ -0,0 +1,109 @@
+//---------------------------------------------
+package cipher
+
+//---------------------------------------------
+/*
+	客户端连接的数据包加解密
+	v1: RC4流加密，密钥由32位DH协商，仅为兼容旧客户端保留
+	v2: AES-256-GCM，每个方向独立的密钥，nonce为隐式递增计数器
+	    每个数据包附带16字节校验标签，被篡改、重放或乱序的数据包无法解密
+*/
+//---------------------------------------------
+import (
+	AES "crypto/aes"
+	CIPHER "crypto/cipher"
+	RC4 "crypto/rc4"
+	BINARY "encoding/binary"
+	ERRORS "errors"
+)
+
+//---------------------------------------------
+var (
+	ERROR_DECRYPT = ERRORS.New("packet authentication failed")
+)
+
+//---------------------------------------------
+// 一个方向上的数据包加解密器，不可在多个协程中同时使用
+type Codec interface {
+	Seal(data []byte) []byte          // 加密，可能复用data的内存
+	Open(data []byte) ([]byte, error) // 解密并校验，可能复用data的内存
+}
+
+//---------------------------------------------
+// RC4流加密
+type RC4Codec struct {
+	cipher *RC4.Cipher
+}
+
+//---------------------------------------------
+func NewRC4Codec(key []byte) (*RC4Codec, error) {
+	c, err := RC4.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &RC4Codec{cipher: c}, nil
+}
+
+//---------------------------------------------
+func (c *RC4Codec) Seal(data []byte) []byte {
+	c.cipher.XORKeyStream(data, data)
+	return data
+}
+
+//---------------------------------------------
+func (c *RC4Codec) Open(data []byte) ([]byte, error) {
+	c.cipher.XORKeyStream(data, data)
+	return data, nil
+}
+
+//---------------------------------------------
+// AES-256-GCM
+type GCMCodec struct {
+	aead  CIPHER.AEAD
+	nonce []byte // 前4字节为0，后8字节为大端计数器
+	count uint64
+}
+
+//---------------------------------------------
+// key必须为32字节
+func NewGCMCodec(key []byte) (*GCMCodec, error) {
+	block, err := AES.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := CIPHER.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &GCMCodec{aead: aead, nonce: make([]byte, aead.NonceSize())}, nil
+}
+
+//---------------------------------------------
+// 每个数据包使用一个新的nonce，密钥只用于一个方向，所以不会重复
+func (c *GCMCodec) next_nonce() []byte {
+	BINARY.BigEndian.PutUint64(c.nonce[len(c.nonce)-8:], c.count)
+	c.count++
+	return c.nonce
+}
+
+//---------------------------------------------
+func (c *GCMCodec) Seal(data []byte) []byte {
+	return c.aead.Seal(data[:0], c.next_nonce(), data, nil)
+}
+
+//---------------------------------------------
+func (c *GCMCodec) Open(data []byte) ([]byte, error) {
+	p, err := c.aead.Open(data[:0], c.next_nonce(), data, nil)
+	if err != nil {
+		return nil, ERROR_DECRYPT
+	}
+	return p, nil
+}
+
+//---------------------------------------------
+// 加密后增加的字节数
+func (c *GCMCodec) Overhead() int {
+	return c.aead.Overhead()
+}
+
+//---------------------------------------------
@@ -0,0 +1,220 @@
+//---------------------------------------------
+package cipher
+
+//---------------------------------------------
+/*
+	v2握手(带服务器认证的秘钥交换)
+	1. 客户端生成32字节随机数和MODP-2048公钥，发送给服务器
+	2. 服务器同样生成随机数和公钥，用RSA私钥对握手记录签名后返回
+	3. 客户端用预置的服务器RSA公钥校验签名，防止中间人
+	4. 双方由DH共享秘钥和握手记录派生出两个方向的AES-256-GCM密钥
+	握手记录 = "FKGoServer-handshake-v2" | 客户端随机数 | 客户端公钥 | 服务器随机数 | 服务器公钥
+*/
+//---------------------------------------------
+import (
+	CRYPTO "crypto"
+	HMAC "crypto/hmac"
+	RAND "crypto/rand"
+	RSA "crypto/rsa"
+	SHA256 "crypto/sha256"
+	X509 "crypto/x509"
+	PEM "encoding/pem"
+	ERRORS "errors"
+	IOUTIL "io/ioutil"
+	BIG "math/big"
+
+	DH "FKGoServer/FKLib_Common/DH"
+)
+
+//---------------------------------------------
+const (
+	HANDSHAKE_V1 = 1 // DH+RC4，对应get_seed_req
+	HANDSHAKE_V2 = 2 // MODP-2048+RSA签名+AES-GCM，对应key_exchange_req
+
+	NONCE_BYTES = 32 // 握手随机数字节数
+)
+
+//---------------------------------------------
+var (
+	ERROR_BAD_NONCE     = ERRORS.New("bad handshake nonce")
+	ERROR_BAD_SIGNATURE = ERRORS.New("bad server signature")
+	ERROR_BAD_KEY_FILE  = ERRORS.New("bad rsa key file")
+
+	transcript_label = []byte("FKGoServer-handshake-v2")
+)
+
+//---------------------------------------------
+// 服务器的握手回复
+type ServerHello struct {
+	Nonce     []byte
+	Public    []byte
+	Signature []byte
+}
+
+//---------------------------------------------
+// 服务器处理客户端握手请求，返回握手回复和服务器使用的加解密器
+func ServerHandshake(priv *RSA.PrivateKey, client_nonce, client_public []byte) (*ServerHello, Codec, Codec, error) {
+	if len(client_nonce) != NONCE_BYTES {
+		return nil, nil, nil, ERROR_BAD_NONCE
+	}
+	secret, public, err := DH.ModpExchange()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	shared, err := DH.ModpKey(secret, client_public)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	nonce, err := func_RandomNonce()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	transcript := Transcript(client_nonce, client_public, nonce, public)
+	digest := SHA256.Sum256(transcript)
+	sig, err := RSA.SignPKCS1v15(RAND.Reader, priv, CRYPTO.SHA256, digest[:])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	c2s, s2c := DeriveKeys(shared, transcript)
+	encoder, err := NewGCMCodec(s2c)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	decoder, err := NewGCMCodec(c2s)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return &ServerHello{Nonce: nonce, Public: public, Signature: sig}, encoder, decoder, nil
+}
+
+//---------------------------------------------
+// 客户端握手状态
+type ClientHandshake struct {
+	Nonce  []byte
+	Public []byte
+	secret *BIG.Int
+}
+
+//---------------------------------------------
+// 客户端开始握手，将Nonce和Public发送给服务器
+func NewClientHandshake() (*ClientHandshake, error) {
+	secret, public, err := DH.ModpExchange()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := func_RandomNonce()
+	if err != nil {
+		return nil, err
+	}
+	return &ClientHandshake{Nonce: nonce, Public: public, secret: secret}, nil
+}
+
+//---------------------------------------------
+// 客户端校验服务器回复，返回客户端使用的加解密器
+func (c *ClientHandshake) Finish(pub *RSA.PublicKey, hello *ServerHello) (Codec, Codec, error) {
+	if len(hello.Nonce) != NONCE_BYTES {
+		return nil, nil, ERROR_BAD_NONCE
+	}
+	transcript := Transcript(c.Nonce, c.Public, hello.Nonce, hello.Public)
+	digest := SHA256.Sum256(transcript)
+	if err := RSA.VerifyPKCS1v15(pub, CRYPTO.SHA256, digest[:], hello.Signature); err != nil {
+		return nil, nil, ERROR_BAD_SIGNATURE
+	}
+	shared, err := DH.ModpKey(c.secret, hello.Public)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c2s, s2c := DeriveKeys(shared, transcript)
+	encoder, err := NewGCMCodec(c2s)
+	if err != nil {
+		return nil, nil, err
+	}
+	decoder, err := NewGCMCodec(s2c)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encoder, decoder, nil
+}
+
+//---------------------------------------------
+// 拼接握手记录
+func Transcript(client_nonce, client_public, server_nonce, server_public []byte) []byte {
+	ret := make([]byte, 0, len(transcript_label)+len(client_nonce)+len(client_public)+len(server_nonce)+len(server_public))
+	ret = append(ret, transcript_label...)
+	ret = append(ret, client_nonce...)
+	ret = append(ret, client_public...)
+	ret = append(ret, server_nonce...)
+	ret = append(ret, server_public...)
+	return ret
+}
+
+//---------------------------------------------
+// 由共享秘钥派生两个方向的32字节密钥
+func DeriveKeys(shared, transcript []byte) (c2s, s2c []byte) {
+	derive := func(label string) []byte {
+		mac := HMAC.New(SHA256.New, shared)
+		mac.Write(transcript)
+		mac.Write([]byte(label))
+		return mac.Sum(nil)
+	}
+	return derive("client->server"), derive("server->client")
+}
+
+//---------------------------------------------
+func func_RandomNonce() ([]byte, error) {
+	nonce := make([]byte, NONCE_BYTES)
+	if _, err := RAND.Read(nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+//---------------------------------------------
+// 读取PEM格式的RSA私钥，支持PKCS1和PKCS8
+func LoadPrivateKey(path string) (*RSA.PrivateKey, error) {
+	data, err := IOUTIL.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := PEM.Decode(data)
+	if block == nil {
+		return nil, ERROR_BAD_KEY_FILE
+	}
+	if key, err := X509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := X509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if rsa_key, ok := key.(*RSA.PrivateKey); ok {
+		return rsa_key, nil
+	}
+	return nil, ERROR_BAD_KEY_FILE
+}
+
+//---------------------------------------------
+// 读取PEM格式的RSA公钥(PKIX)，供客户端校验服务器签名
+func LoadPublicKey(path string) (*RSA.PublicKey, error) {
+	data, err := IOUTIL.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := PEM.Decode(data)
+	if block == nil {
+		return nil, ERROR_BAD_KEY_FILE
+	}
+	key, err := X509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if rsa_key, ok := key.(*RSA.PublicKey); ok {
+		return rsa_key, nil
+	}
+	return nil, ERROR_BAD_KEY_FILE
+}
+
+//---------------------------------------------
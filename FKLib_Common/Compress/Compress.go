@@ -0,0 +1,185 @@
+//---------------------------------------------
+package compress
+
+//---------------------------------------------
+/*
+	客户端连接的数据包压缩，在加密之前进行(接收方解密之后解压)
+	压缩算法在v2握手中协商: 客户端在key_exchange_req.compress中给出支持的算法(按位或)，服务器回复选定的一种
+	协商出压缩算法后，每个数据包明文前增加1字节标记:
+	| 1B flag | DATA |
+	flag = COMPRESS_NONE:   DATA为原始数据
+	flag = COMPRESS_SNAPPY: DATA为snappy块格式
+	flag = COMPRESS_LZ4:    DATA为 4B原始长度(大端) + lz4块格式
+	只有超过阈值且压缩后确实变小的数据包才会压缩
+*/
+//---------------------------------------------
+import (
+	BINARY "encoding/binary"
+	ERRORS "errors"
+	STRINGS "strings"
+
+	SNAPPY "github.com/golang/snappy"
+	LZ4 "github.com/pierrec/lz4"
+)
+
+//---------------------------------------------
+const (
+	COMPRESS_NONE   = 0x0
+	COMPRESS_SNAPPY = 0x1
+	COMPRESS_LZ4    = 0x2
+
+	DEFAULT_THRESHOLD = 256     // 字节，小于该长度的数据包不压缩
+	DEFAULT_MAX_SIZE  = 4 << 20 // 字节，解压后允许的最大长度，与消息长度的默认上限一致
+)
+
+//---------------------------------------------
+var (
+	ERROR_BAD_FLAG      = ERRORS.New("unknown compress flag")
+	ERROR_CORRUPT       = ERRORS.New("corrupt compressed data")
+	ERROR_TOO_LARGE     = ERRORS.New("decompressed data too large")
+	ERROR_UNKNOWN_ALGOR = ERRORS.New("unknown compress algorithm")
+)
+
+var algorithm_names = map[int32]string{
+	COMPRESS_NONE:   "none",
+	COMPRESS_SNAPPY: "snappy",
+	COMPRESS_LZ4:    "lz4",
+}
+
+//---------------------------------------------
+// 算法名
+func Name(algorithm int32) string {
+	return algorithm_names[algorithm]
+}
+
+//---------------------------------------------
+// 解析算法名列表，按给出的顺序作为优先级
+func ParseAlgorithms(names []string) ([]int32, error) {
+	var algorithms []int32
+	for _, name := range names {
+		name = STRINGS.ToLower(STRINGS.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		found := false
+		for algorithm, v := range algorithm_names {
+			if v == name && algorithm != COMPRESS_NONE {
+				algorithms = append(algorithms, algorithm)
+				found = true
+			}
+		}
+		if !found {
+			return nil, ERROR_UNKNOWN_ALGOR
+		}
+	}
+	return algorithms, nil
+}
+
+//---------------------------------------------
+// 按服务器的优先级从客户端支持的算法中选取一种，没有共同的算法时返回COMPRESS_NONE
+func Negotiate(preferred []int32, supported int32) int32 {
+	for _, algorithm := range preferred {
+		if supported&algorithm != 0 {
+			return algorithm
+		}
+	}
+	return COMPRESS_NONE
+}
+
+//---------------------------------------------
+// 一条连接上的压缩器，不可在多个协程中同时使用
+type Codec struct {
+	algorithm int32
+	threshold int
+	max_size  int
+}
+
+//---------------------------------------------
+func NewCodec(algorithm int32, threshold int) *Codec {
+	return &Codec{algorithm: algorithm, threshold: threshold, max_size: DEFAULT_MAX_SIZE}
+}
+
+//---------------------------------------------
+// 设置解压后允许的最大长度，用于扩展帧传输的大消息
+func (c *Codec) SetLimit(limit int) {
+	c.max_size = limit
+}
+
+//---------------------------------------------
+// 协商出的算法
+func (c *Codec) Algorithm() int32 {
+	return c.algorithm
+}
+
+//---------------------------------------------
+// 压缩并加上标记
+func (c *Codec) Compress(data []byte) []byte {
+	if len(data) >= c.threshold {
+		switch c.algorithm {
+		case COMPRESS_SNAPPY:
+			out := make([]byte, 1+SNAPPY.MaxEncodedLen(len(data)))
+			out[0] = COMPRESS_SNAPPY
+			n := len(SNAPPY.Encode(out[1:], data))
+			if n < len(data) {
+				return out[:1+n]
+			}
+		case COMPRESS_LZ4:
+			out := make([]byte, 5+LZ4.CompressBlockBound(len(data)))
+			out[0] = COMPRESS_LZ4
+			BINARY.BigEndian.PutUint32(out[1:], uint32(len(data)))
+			// 当前vendor中的LZ4.CompressBlock哈希表初始化有误，找不到任何匹配，这里使用HC版本
+			n, err := LZ4.CompressBlockHC(data, out[5:], 0)
+			if err == nil && n > 0 && 4+n < len(data) {
+				return out[:5+n]
+			}
+		}
+	}
+
+	out := make([]byte, 1+len(data))
+	out[0] = COMPRESS_NONE
+	copy(out[1:], data)
+	return out
+}
+
+//---------------------------------------------
+// 去掉标记并解压，对端可以使用任意已知的算法
+func (c *Codec) Decompress(data []byte) ([]byte, error) {
+	if len(data) < 1 {
+		return nil, ERROR_CORRUPT
+	}
+	flag, body := data[0], data[1:]
+	switch flag {
+	case COMPRESS_NONE:
+		return body, nil
+	case COMPRESS_SNAPPY:
+		n, err := SNAPPY.DecodedLen(body)
+		if err != nil {
+			return nil, ERROR_CORRUPT
+		}
+		if n > c.max_size {
+			return nil, ERROR_TOO_LARGE
+		}
+		out, err := SNAPPY.Decode(make([]byte, n), body)
+		if err != nil {
+			return nil, ERROR_CORRUPT
+		}
+		return out, nil
+	case COMPRESS_LZ4:
+		if len(body) < 4 {
+			return nil, ERROR_CORRUPT
+		}
+		n := int(BINARY.BigEndian.Uint32(body))
+		if n > c.max_size {
+			return nil, ERROR_TOO_LARGE
+		}
+		out := make([]byte, n)
+		m, err := LZ4.UncompressBlock(body[4:], out, 0)
+		if err != nil || m != n {
+			return nil, ERROR_CORRUPT
+		}
+		return out, nil
+	}
+	return nil, ERROR_BAD_FLAG
+}
+
+//---------------------------------------------
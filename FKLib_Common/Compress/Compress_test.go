@@ -0,0 +1,75 @@
+//---------------------------------------------
+package compress
+
+//---------------------------------------------
+import (
+	BYTES "bytes"
+	RAND "math/rand"
+	"testing"
+)
+
+//---------------------------------------------
+func TestRoundTrip(t *testing.T) {
+	text := BYTES.Repeat([]byte("inventory item 1001; "), 100)
+	noise := make([]byte, 1000)
+	RAND.Read(noise)
+
+	for _, algorithm := range []int32{COMPRESS_NONE, COMPRESS_SNAPPY, COMPRESS_LZ4} {
+		c := NewCodec(algorithm, DEFAULT_THRESHOLD)
+		for _, data := range [][]byte{[]byte("short"), text, noise} {
+			packed := c.Compress(data)
+			if algorithm != COMPRESS_NONE && BYTES.Equal(data, text) && (packed[0] != byte(algorithm) || len(packed) >= len(text)) {
+				t.Error(Name(algorithm), "did not compress text:", len(packed))
+			}
+			if len(data) < DEFAULT_THRESHOLD && packed[0] != COMPRESS_NONE {
+				t.Error(Name(algorithm), "compressed below threshold")
+			}
+			out, err := c.Decompress(packed)
+			if err != nil || !BYTES.Equal(out, data) {
+				t.Error(Name(algorithm), "round trip failed:", err)
+			}
+		}
+	}
+}
+
+//---------------------------------------------
+func TestDecompressBad(t *testing.T) {
+	c := NewCodec(COMPRESS_LZ4, DEFAULT_THRESHOLD)
+	if _, err := c.Decompress([]byte{9, 1, 2}); err != ERROR_BAD_FLAG {
+		t.Error("bad flag got", err)
+	}
+	if _, err := c.Decompress([]byte{COMPRESS_LZ4, 0xff, 0xff, 0xff, 0xff, 0}); err != ERROR_TOO_LARGE {
+		t.Error("huge lz4 got", err)
+	}
+	garbage := make([]byte, 64)
+	for i := 0; i < 100; i++ {
+		RAND.Read(garbage)
+		garbage[0] = COMPRESS_SNAPPY
+		c.Decompress(garbage)
+		garbage[0] = COMPRESS_LZ4
+		garbage[1], garbage[2] = 0, 0
+		c.Decompress(garbage)
+	}
+}
+
+//---------------------------------------------
+func TestNegotiate(t *testing.T) {
+	preferred, err := ParseAlgorithms([]string{"lz4", "snappy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := Negotiate(preferred, COMPRESS_SNAPPY|COMPRESS_LZ4); a != COMPRESS_LZ4 {
+		t.Error("negotiate got", Name(a))
+	}
+	if a := Negotiate(preferred, COMPRESS_SNAPPY); a != COMPRESS_SNAPPY {
+		t.Error("negotiate got", Name(a))
+	}
+	if a := Negotiate(preferred, COMPRESS_NONE); a != COMPRESS_NONE {
+		t.Error("negotiate got", Name(a))
+	}
+	if _, err := ParseAlgorithms([]string{"zip"}); err != ERROR_UNKNOWN_ALGOR {
+		t.Error("unknown algorithm got", err)
+	}
+}
+
+//---------------------------------------------
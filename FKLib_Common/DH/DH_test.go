@@ -3,6 +3,7 @@ package dh
 
 //---------------------------------------------
 import (
+	"bytes"
 	"fmt"
 	"testing"
 )
@@ -26,6 +27,43 @@ func TestDH(t *testing.T) {
 	}
 }
 
+//---------------------------------------------
+func TestModp(t *testing.T) {
+	X1, E1, err := ModpExchange()
+	if err != nil {
+		t.Fatal(err)
+	}
+	X2, E2, err := ModpExchange()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(E1) != MODP2048_BYTES || len(E2) != MODP2048_BYTES {
+		t.Fatal("bad public key length")
+	}
+
+	KEY1, err := ModpKey(X1, E2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	KEY2, err := ModpKey(X2, E1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(KEY1, KEY2) {
+		t.Error("MODP Diffie-Hellman failed")
+	}
+
+	// 非法公钥
+	one := make([]byte, MODP2048_BYTES)
+	one[MODP2048_BYTES-1] = 1
+	if _, err := ModpKey(X1, one); err != ERROR_BAD_PUBLIC_KEY {
+		t.Error("public key 1 should be rejected")
+	}
+	if _, err := ModpKey(X1, E2[1:]); err != ERROR_BAD_PUBLIC_KEY {
+		t.Error("short public key should be rejected")
+	}
+}
+
 //---------------------------------------------
 func BenchmarkDH(b *testing.B) {
 	for i := 0; i < b.N; i++ {
@@ -0,0 +1,76 @@
+//---------------------------------------------
+package dh
+
+//---------------------------------------------
+/*
+	2048位MODP群的Diffie-Hellman秘钥交换(RFC 3526 Group 14)
+	私钥使用crypto/rand生成，用于v2握手，见FKLib_Common/Cipher
+*/
+//---------------------------------------------
+import (
+	RAND "crypto/rand"
+	ERRORS "errors"
+	BIG "math/big"
+)
+
+//---------------------------------------------
+const (
+	MODP2048_BYTES = 256 // 公钥序列化后的字节数
+)
+
+//---------------------------------------------
+var (
+	MODP2048BASE     = BIG.NewInt(2)
+	MODP2048PRIME, _ = BIG.NewInt(0).SetString(
+		"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1"+
+			"29024E088A67CC74020BBEA63B139B22514A08798E3404DD"+
+			"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245"+
+			"E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+			"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3D"+
+			"C2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F"+
+			"83655D23DCA3AD961C62F356208552BB9ED529077096966D"+
+			"670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B"+
+			"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9"+
+			"DE2BCBF6955817183995497CEA956AE515D2261898FA0510"+
+			"15728E5A8AACAA68FFFFFFFFFFFFFFFF", 16)
+
+	ERROR_BAD_PUBLIC_KEY = ERRORS.New("bad diffie-hellman public key")
+)
+
+//---------------------------------------------
+// 生成一对私钥和公钥，公钥为固定长度的大端字节序
+func ModpExchange() (secret *BIG.Int, public []byte, err error) {
+	// 私钥取256位即可提供与群相当的安全强度
+	buf := make([]byte, 32)
+	if _, err = RAND.Read(buf); err != nil {
+		return nil, nil, err
+	}
+	secret = BIG.NewInt(0).SetBytes(buf)
+	pub := BIG.NewInt(0).Exp(MODP2048BASE, secret, MODP2048PRIME)
+	return secret, func_PadBytes(pub), nil
+}
+
+//---------------------------------------------
+// 根据自己的私钥和对方的公钥计算共享秘钥
+// 对方公钥必须在(1, p-1)之间，避免小子群攻击
+func ModpKey(secret *BIG.Int, peer []byte) ([]byte, error) {
+	if len(peer) != MODP2048_BYTES {
+		return nil, ERROR_BAD_PUBLIC_KEY
+	}
+	y := BIG.NewInt(0).SetBytes(peer)
+	max := BIG.NewInt(0).Sub(MODP2048PRIME, BIG.NewInt(1))
+	if y.Cmp(BIG.NewInt(1)) <= 0 || y.Cmp(max) >= 0 {
+		return nil, ERROR_BAD_PUBLIC_KEY
+	}
+	return func_PadBytes(BIG.NewInt(0).Exp(y, secret, MODP2048PRIME)), nil
+}
+
+//---------------------------------------------
+func func_PadBytes(x *BIG.Int) []byte {
+	b := x.Bytes()
+	ret := make([]byte, MODP2048_BYTES)
+	copy(ret[MODP2048_BYTES-len(b):], b)
+	return ret
+}
+
+//---------------------------------------------
@@ -7,31 +7,102 @@ const (
 	DEFAULT_GSID = "game1" // 默认客户端连接的游戏服务器ID
 )
 
+//---------------------------------------------
+// 登陆方式，对应S_user_login_info.F_login_way
+const (
+	LOGIN_WAY_UDID        = 1 // 使用设备udid以游客身份登陆
+	LOGIN_WAY_CERTIFICATE = 2 // 使用客户端证书登陆
+	LOGIN_WAY_TOKEN       = 3 // 使用用户中心签发的票据登陆
+)
+
+//---------------------------------------------
+// 错误码，对应S_error_info.F_code，0代表成功
+const (
+	ERR_LOGIN_WAY_UNSUPPORTED = 100 // 不支持的登陆方式
+	ERR_LOGIN_BAD_CREDENTIAL  = 101 // 登陆凭证无效
+	ERR_LOGIN_TOKEN_EXPIRED   = 102 // 登陆票据已过期
+	ERR_LOGIN_ACCOUNT_BANNED  = 103 // 账号已被封禁
+	ERR_LOGIN_INTERNAL        = 104 // 服务器内部错误
+	ERR_LOGIN_NO_GAME_SERVER  = 105 // 没有可用的游戏服务器
+	ERR_GAME_SERVICE_LOST     = 200 // 游戏服连接中断
+	ERR_RESUME_INVALID_TOKEN  = 300 // 恢复会话的凭证无效或会话已过期
+	ERR_RESUME_PACKET_LOST    = 301 // 重传缓冲已无法补齐客户端缺失的数据包
+	ERR_HANDSHAKE_VERSION     = 400 // 服务器未启用该握手版本
+	ERR_HANDSHAKE_FAILED      = 401 // 握手失败
+	ERR_PROTO_NOT_ALLOWED     = 500 // 当前会话状态不允许该协议
+	ERR_KICK_DUPLICATE_LOGIN  = 600 // 同一账号在其他地方登陆
+	ERR_KICK_BANNED           = 601 // 账号已被封禁
+	ERR_KICK_MAINTENANCE      = 602 // 服务器维护
+	ERR_KICK_RATE_LIMITED     = 603 // 发包频率超限
+	ERR_KICK_ADMIN            = 604 // 被运维踢掉
+	ERR_KICK_PROTOCOL         = 605 // 数据包错误(解密失败、序号错误、未知协议等)
+	ERR_KICK_SLOW_CLIENT      = 606 // 客户端接收过慢
+	ERR_KICK_GAME             = 607 // 被游戏服踢掉，游戏服未指定原因
+	ERR_KICK_SERVICE_LOST     = 608 // 后端服务不可用
+	ERR_VERSION_TOO_OLD       = 700 // 客户端协议版本低于服务器支持的最低版本，需要更新
+)
+
 //---------------------------------------------
 var Code = map[string]int16{
-	"heart_beat_req":         0,    // 心跳包..
-	"heart_beat_ack":         1,    // 心跳包回复
-	"user_login_req":         10,   // 登陆
-	"user_login_succeed_ack": 11,   // 登陆成功
-	"user_login_faild_ack":   12,   // 登陆失败
-	"client_error_ack":       13,   // 客户端错误
-	"get_seed_req":           30,   // socket通信加密使用
-	"get_seed_ack":           31,   // socket通信加密使用
-	"proto_ping_req":         1001, //  ping
-	"proto_ping_ack":         1002, //  ping回复
+	"heart_beat_req":           0,    // 心跳包..
+	"heart_beat_ack":           1,    // 心跳包回复
+	"user_login_req":           10,   // 登陆
+	"user_login_succeed_ack":   11,   // 登陆成功
+	"user_login_faild_ack":     12,   // 登陆失败
+	"client_error_ack":         13,   // 客户端错误
+	"game_lost_ack":            14,   // 游戏服连接中断，正在重新连接
+	"game_restored_ack":        15,   // 游戏服连接已恢复
+	"session_resume_req":       16,   // 恢复会话
+	"session_resume_ack":       17,   // 恢复会话成功
+	"session_resume_faild_ack": 18,   // 恢复会话失败
+	"server_notice_ack":        19,   // 服务器公告
+	"user_kicked_ack":          20,   // 被踢下线，code为原因
+	"server_migrate_ack":       21,   // 服务器即将关闭，客户端应在deadline秒内重新连接
+	"server_ping_ack":          22,   // Agent主动发起的ping，客户端须原样回复server_pong_req，用于测量往返时延
+	"server_pong_req":          23,   // 回复server_ping_ack，id与ping相同
+	"get_seed_req":             30,   // socket通信加密使用
+	"get_seed_ack":             31,   // socket通信加密使用
+	"key_exchange_req":         32,   // v2握手，密钥交换
+	"key_exchange_ack":         33,   // v2握手，密钥交换
+	"key_exchange_faild_ack":   34,   // 握手失败
+	"kcp_profile_req":          35,   // 切换KCP调优参数
+	"kcp_profile_ack":          36,   // 切换KCP调优参数结果，name为当前生效的参数，非KCP连接为空
+	"client_version_req":       37,   // 客户端协议版本协商，登陆前发送
+	"client_version_ack":       38,   // 协议版本协商结果，version为会话使用的协议版本
+	"client_version_faild_ack": 39,   // 客户端版本过低，需要更新
+	"proto_ping_req":           1001, //  ping
+	"proto_ping_ack":           1002, //  ping回复
 }
 
 var RCode = map[int16]string{
-	0:    "heart_beat_req",         // 心跳包..
-	1:    "heart_beat_ack",         // 心跳包回复
-	10:   "user_login_req",         // 登陆
-	11:   "user_login_succeed_ack", // 登陆成功
-	12:   "user_login_faild_ack",   // 登陆失败
-	13:   "client_error_ack",       // 客户端错误
-	30:   "get_seed_req",           // socket通信加密使用
-	31:   "get_seed_ack",           // socket通信加密使用
-	1001: "proto_ping_req",         //  ping
-	1002: "proto_ping_ack",         //  ping回复
+	0:    "heart_beat_req",           // 心跳包..
+	1:    "heart_beat_ack",           // 心跳包回复
+	10:   "user_login_req",           // 登陆
+	11:   "user_login_succeed_ack",   // 登陆成功
+	12:   "user_login_faild_ack",     // 登陆失败
+	13:   "client_error_ack",         // 客户端错误
+	14:   "game_lost_ack",            // 游戏服连接中断，正在重新连接
+	15:   "game_restored_ack",        // 游戏服连接已恢复
+	16:   "session_resume_req",       // 恢复会话
+	17:   "session_resume_ack",       // 恢复会话成功
+	18:   "session_resume_faild_ack", // 恢复会话失败
+	19:   "server_notice_ack",        // 服务器公告
+	20:   "user_kicked_ack",          // 被踢下线，code为原因
+	21:   "server_migrate_ack",       // 服务器即将关闭，客户端应在deadline秒内重新连接
+	22:   "server_ping_ack",          // Agent主动发起的ping，客户端须原样回复server_pong_req，用于测量往返时延
+	23:   "server_pong_req",          // 回复server_ping_ack，id与ping相同
+	30:   "get_seed_req",             // socket通信加密使用
+	31:   "get_seed_ack",             // socket通信加密使用
+	32:   "key_exchange_req",         // v2握手，密钥交换
+	33:   "key_exchange_ack",         // v2握手，密钥交换
+	34:   "key_exchange_faild_ack",   // 握手失败
+	35:   "kcp_profile_req",          // 切换KCP调优参数
+	36:   "kcp_profile_ack",          // 切换KCP调优参数结果，name为当前生效的参数，非KCP连接为空
+	37:   "client_version_req",       // 客户端协议版本协商，登陆前发送
+	38:   "client_version_ack",       // 协议版本协商结果，version为会话使用的协议版本
+	39:   "client_version_faild_ack", // 客户端版本过低，需要更新
+	1001: "proto_ping_req",           //  ping
+	1002: "proto_ping_ack",           //  ping回复
 }
 
 //---------------------------------------------
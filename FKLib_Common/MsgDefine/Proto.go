@@ -41,7 +41,7 @@ func (p S_error_info) Pack(w *PACKET.Packet) {
 }
 
 //---------------------------------------------
-//#用户登陆发包 1代表使用uuid登陆 2代表使用客户端证书登陆
+//#用户登陆发包 1代表使用uuid登陆 2代表使用客户端证书登陆 3代表使用票据登陆
 type S_user_login_info struct {
 	F_login_way          int32
 	F_open_udid          string
@@ -83,13 +83,109 @@ func (p S_seed_info) Pack(w *PACKET.Packet) {
 }
 
 //---------------------------------------------
-//#用户信息包
+//#用户信息包，datagram_token为不可靠数据报通道的凭证(8字节通道ID+16字节密钥)，未开启时为空
 type S_user_snapshot struct {
-	F_uid int32
+	F_uid            int32
+	F_resume_token   string
+	F_datagram_token string
 }
 
 func (p S_user_snapshot) Pack(w *PACKET.Packet) {
 	w.WriteS32(p.F_uid)
+	w.WriteString(p.F_resume_token)
+	w.WriteString(p.F_datagram_token)
+}
+
+//---------------------------------------------
+//#恢复会话，count为对端已收到的数据包个数
+type S_resume_info struct {
+	F_token string
+	F_count int32
+}
+
+func (p S_resume_info) Pack(w *PACKET.Packet) {
+	w.WriteString(p.F_token)
+	w.WriteS32(p.F_count)
+}
+
+//---------------------------------------------
+//#v2握手，nonce为32字节随机数，public为MODP-2048公钥，signature为服务器RSA签名(请求中为空)
+type S_key_exchange_info struct {
+	F_version   int32
+	F_nonce     string
+	F_public    string
+	F_signature string
+	F_compress  int32
+}
+
+func (p S_key_exchange_info) Pack(w *PACKET.Packet) {
+	w.WriteS32(p.F_version)
+	w.WriteString(p.F_nonce)
+	w.WriteString(p.F_public)
+	w.WriteString(p.F_signature)
+	w.WriteS32(p.F_compress)
+}
+
+//---------------------------------------------
+//#服务器公告
+type S_notice_info struct {
+	F_msg string
+}
+
+func (p S_notice_info) Pack(w *PACKET.Packet) {
+	w.WriteString(p.F_msg)
+}
+
+//---------------------------------------------
+//#服务器迁移通知，addr为建议重连的地址(空为原入口)，deadline为强制断开前的剩余秒数
+type S_migrate_info struct {
+	F_msg      string
+	F_addr     string
+	F_deadline int32
+}
+
+func (p S_migrate_info) Pack(w *PACKET.Packet) {
+	w.WriteString(p.F_msg)
+	w.WriteString(p.F_addr)
+	w.WriteS32(p.F_deadline)
+}
+
+//---------------------------------------------
+//#KCP调优参数协商
+type S_kcp_profile struct {
+	F_name string
+}
+
+func (p S_kcp_profile) Pack(w *PACKET.Packet) {
+	w.WriteString(p.F_name)
+}
+
+//---------------------------------------------
+//#客户端协议版本协商，请求中version为客户端版本，回复中为会话使用的版本与服务器支持的区间(max为0表示不限制)
+type S_version_info struct {
+	F_version     int32
+	F_min_version int32
+	F_max_version int32
+}
+
+func (p S_version_info) Pack(w *PACKET.Packet) {
+	w.WriteS32(p.F_version)
+	w.WriteS32(p.F_min_version)
+	w.WriteS32(p.F_max_version)
+}
+
+//---------------------------------------------
+//#客户端版本过低，url为新版本的下载地址
+type S_update_info struct {
+	F_code int32
+	F_msg  string
+	F_url  string
+}
+
+func (p S_update_info) Pack(w *PACKET.Packet) {
+	w.WriteS32(p.F_code)
+	w.WriteString(p.F_msg)
+	w.WriteString(p.F_url)
 }
 
 //---------------------------------------------
@@ -161,6 +257,94 @@ func PKT_user_snapshot(reader *PACKET.Packet) (tbl S_user_snapshot, err error) {
 	tbl.F_uid, err = reader.ReadS32()
 	func_CheckErr(err)
 
+	tbl.F_resume_token, err = reader.ReadString()
+	func_CheckErr(err)
+
+	tbl.F_datagram_token, err = reader.ReadString()
+	func_CheckErr(err)
+
+	return
+}
+
+func PKT_resume_info(reader *PACKET.Packet) (tbl S_resume_info, err error) {
+	tbl.F_token, err = reader.ReadString()
+	func_CheckErr(err)
+
+	tbl.F_count, err = reader.ReadS32()
+	func_CheckErr(err)
+
+	return
+}
+
+func PKT_key_exchange_info(reader *PACKET.Packet) (tbl S_key_exchange_info, err error) {
+	tbl.F_version, err = reader.ReadS32()
+	func_CheckErr(err)
+
+	tbl.F_nonce, err = reader.ReadString()
+	func_CheckErr(err)
+
+	tbl.F_public, err = reader.ReadString()
+	func_CheckErr(err)
+
+	tbl.F_signature, err = reader.ReadString()
+	func_CheckErr(err)
+
+	tbl.F_compress, err = reader.ReadS32()
+	func_CheckErr(err)
+
+	return
+}
+
+func PKT_notice_info(reader *PACKET.Packet) (tbl S_notice_info, err error) {
+	tbl.F_msg, err = reader.ReadString()
+	func_CheckErr(err)
+
+	return
+}
+
+func PKT_migrate_info(reader *PACKET.Packet) (tbl S_migrate_info, err error) {
+	tbl.F_msg, err = reader.ReadString()
+	func_CheckErr(err)
+
+	tbl.F_addr, err = reader.ReadString()
+	func_CheckErr(err)
+
+	tbl.F_deadline, err = reader.ReadS32()
+	func_CheckErr(err)
+
+	return
+}
+
+func PKT_kcp_profile(reader *PACKET.Packet) (tbl S_kcp_profile, err error) {
+	tbl.F_name, err = reader.ReadString()
+	func_CheckErr(err)
+
+	return
+}
+
+func PKT_version_info(reader *PACKET.Packet) (tbl S_version_info, err error) {
+	tbl.F_version, err = reader.ReadS32()
+	func_CheckErr(err)
+
+	tbl.F_min_version, err = reader.ReadS32()
+	func_CheckErr(err)
+
+	tbl.F_max_version, err = reader.ReadS32()
+	func_CheckErr(err)
+
+	return
+}
+
+func PKT_update_info(reader *PACKET.Packet) (tbl S_update_info, err error) {
+	tbl.F_code, err = reader.ReadS32()
+	func_CheckErr(err)
+
+	tbl.F_msg, err = reader.ReadString()
+	func_CheckErr(err)
+
+	tbl.F_url, err = reader.ReadString()
+	func_CheckErr(err)
+
 	return
 }
 
@@ -0,0 +1,78 @@
+//---------------------------------------------
+package packet
+
+//---------------------------------------------
+/*
+	客户端连接上的分帧
+	普通帧格式为 | 2B size | DATA |，size为1-65535，与旧格式完全一致
+	超过FRAME_LIMIT的消息使用扩展帧: | 2B 0 | 4B size | DATA |
+	size为0在旧格式中不是有效的消息(任何消息至少包含协议号)，用作扩展帧的标记不改变任何已有长度的含义
+	例如 65535字节的消息 = 一个普通帧
+	     70000字节的消息 = 一个扩展帧
+	旧客户端不会收到超过65535字节的消息(旧格式无法表示)，因此无需协商
+	分帧在加密之后进行，接收方读出完整消息后再解密
+*/
+//---------------------------------------------
+import (
+	BINARY "encoding/binary"
+	ERRORS "errors"
+	IO "io"
+)
+
+//---------------------------------------------
+const (
+	FRAME_LIMIT           = PACKET_LIMIT // 普通帧的最大长度
+	EXTENDED_FRAME        = 0            // 扩展帧的标记，后面是4字节的长度
+	DEFAULT_MESSAGE_LIMIT = 4 << 20      // 默认允许的最大消息长度
+)
+
+//---------------------------------------------
+var (
+	ERROR_MESSAGE_TOO_LARGE = ERRORS.New("message too large")
+)
+
+//---------------------------------------------
+// 将一条消息分帧后追加到dst，空消息与超过FRAME_LIMIT的消息使用扩展帧
+func AppendFrames(dst, data []byte) []byte {
+	n := len(data)
+	if n > EXTENDED_FRAME && n <= FRAME_LIMIT {
+		var header [2]byte
+		BINARY.BigEndian.PutUint16(header[:], uint16(n))
+		dst = append(dst, header[:]...)
+		return append(dst, data...)
+	}
+
+	var header [6]byte
+	BINARY.BigEndian.PutUint16(header[:2], EXTENDED_FRAME)
+	BINARY.BigEndian.PutUint32(header[2:], uint32(n))
+	dst = append(dst, header[:]...)
+	return append(dst, data...)
+}
+
+//---------------------------------------------
+// 读取一条消息，普通帧或扩展帧
+// header为2字节的复用缓冲，limit为允许的最大长度
+func ReadMessage(r IO.Reader, header []byte, limit int) ([]byte, error) {
+	if _, err := IO.ReadFull(r, header[:2]); err != nil {
+		return nil, err
+	}
+	size := int(BINARY.BigEndian.Uint16(header))
+	if size == EXTENDED_FRAME {
+		var extended [4]byte
+		if _, err := IO.ReadFull(r, extended[:]); err != nil {
+			return nil, err
+		}
+		size = int(BINARY.BigEndian.Uint32(extended[:]))
+	}
+	if size > limit || size < 0 {
+		return nil, ERROR_MESSAGE_TOO_LARGE
+	}
+
+	payload := make([]byte, size)
+	if _, err := IO.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+//---------------------------------------------
@@ -0,0 +1,56 @@
+//---------------------------------------------
+package packet
+
+//---------------------------------------------
+import (
+	BYTES "bytes"
+	"testing"
+)
+
+//---------------------------------------------
+func TestFrames(t *testing.T) {
+	header := make([]byte, 2)
+	for _, n := range []int{0, 10, FRAME_LIMIT - 1, FRAME_LIMIT, FRAME_LIMIT + 1, 3*FRAME_LIMIT + 7} {
+		data := make([]byte, n)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		frames := AppendFrames(nil, data)
+		if n > 0 && n <= FRAME_LIMIT && len(frames) != n+2 {
+			t.Error("message up to FRAME_LIMIT should be a single legacy frame:", n, len(frames))
+		}
+
+		// 多条消息连续读取
+		stream := BYTES.NewReader(append(frames, AppendFrames(nil, []byte{0xAB})...))
+		got, err := ReadMessage(stream, header, DEFAULT_MESSAGE_LIMIT)
+		if err != nil || !BYTES.Equal(got, data) {
+			t.Error("message mismatch:", n, len(got), err)
+		}
+		if got, err := ReadMessage(stream, header, DEFAULT_MESSAGE_LIMIT); err != nil || len(got) != 1 || got[0] != 0xAB {
+			t.Error("next message mismatch:", n, got, err)
+		}
+	}
+
+	// 恰好65535字节的消息与旧格式相同: 一个size为65535的帧，后面直接是下一条消息
+	data := make([]byte, FRAME_LIMIT)
+	legacy := append([]byte{0xFF, 0xFF}, data...)
+	legacy = append(legacy, 0x00, 0x01, 0xAB)
+	if frames := AppendFrames(nil, data); !BYTES.Equal(frames, legacy[:len(frames)]) || len(frames) != FRAME_LIMIT+2 {
+		t.Error("65535 bytes message is not a legacy frame")
+	}
+	stream := BYTES.NewReader(legacy)
+	if got, err := ReadMessage(stream, header, DEFAULT_MESSAGE_LIMIT); err != nil || len(got) != FRAME_LIMIT {
+		t.Error("legacy 65535 bytes frame got", len(got), err)
+	}
+	if got, err := ReadMessage(stream, header, DEFAULT_MESSAGE_LIMIT); err != nil || len(got) != 1 || got[0] != 0xAB {
+		t.Error("message after legacy 65535 bytes frame got", got, err)
+	}
+
+	// 超过上限
+	frames := AppendFrames(nil, make([]byte, 2*FRAME_LIMIT))
+	if _, err := ReadMessage(BYTES.NewReader(frames), header, FRAME_LIMIT+10); err != ERROR_MESSAGE_TOO_LARGE {
+		t.Error("oversized message got", err)
+	}
+}
+
+//---------------------------------------------
@@ -198,12 +198,7 @@ func (p *service_pool) add_service(key, value string) {
 	if conn, err := GRPC.Dial(value, GRPC.WithBlock(), GRPC.WithInsecure()); err == nil {
 		service.clients = append(service.clients, client{key, conn})
 		LOG.Println("增加服务完成:", key, "-->", value)
-		for k := range p.callbacks[service_name] {
-			select {
-			case p.callbacks[service_name][k] <- key:
-			default:
-			}
-		}
+		p.notify_callbacks(service_name, key)
 	} else {
 		LOG.Println("无法连接服务:", key, "-->", value, "错误信息:", err)
 	}
@@ -233,11 +228,23 @@ func (p *service_pool) remove_service(key string) {
 			service.clients[k].conn.Close()
 			service.clients = append(service.clients[:k], service.clients[k+1:]...)
 			LOG.Println("服务移除完毕:", key)
+			p.notify_callbacks(service_name, key)
 			return
 		}
 	}
 }
 
+//---------------------------------------------
+// 通知服务变化，回调方通过get_service_ids获取变化后的完整列表
+func (p *service_pool) notify_callbacks(service_name, key string) {
+	for k := range p.callbacks[service_name] {
+		select {
+		case p.callbacks[service_name][k] <- key:
+		default:
+		}
+	}
+}
+
 //---------------------------------------------
 // 为一个服务提供一个ID
 // 例如：path:/backends/snowflake, id:s1
@@ -287,19 +294,43 @@ func (p *service_pool) get_service(path string) (conn *GRPC.ClientConn, key stri
 }
 
 //---------------------------------------------
+// 获取一种服务当前全部的ID
+// 例如：path:/backends/snowflake 返回 [s1, s2]
+func (p *service_pool) get_service_ids(path string) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	service := p.services[path]
+	if service == nil {
+		return nil
+	}
+
+	ids := make([]string, 0, len(service.clients))
+	for k := range service.clients {
+		ids = append(ids, FILEPATH.Base(service.clients[k].key))
+	}
+	return ids
+}
+
+//---------------------------------------------
+// 已有实例的通知在解锁后发送，回调方收到通知后会调用get_service_ids，持锁发送会在通道写满时死锁
 func (p *service_pool) register_callback(path string, callback chan string) {
 	p.mu.Lock()
-	defer p.mu.Unlock()
 	if p.callbacks == nil {
 		p.callbacks = make(map[string][]chan string)
 	}
 
 	p.callbacks[path] = append(p.callbacks[path], callback)
+	var keys []string
 	if s, ok := p.services[path]; ok {
 		for k := range s.clients {
-			callback <- s.clients[k].key
+			keys = append(keys, s.clients[k].key)
 		}
 	}
+	p.mu.Unlock()
+
+	for _, key := range keys {
+		callback <- key
+	}
 	LOG.Println("注册服务回调:", path)
 }
 
@@ -321,6 +352,12 @@ func GetServiceWithId(path string, id string) *GRPC.ClientConn {
 }
 
 //---------------------------------------------
+func GetServiceIds(path string) []string {
+	return _default_pool.get_service_ids(_default_pool.root + "/" + path)
+}
+
+//---------------------------------------------
+// 注册服务变化回调，服务增加和移除时都会向callback写入对应的key
 func RegisterCallback(path string, callback chan string) {
 	_default_pool.register_callback(_default_pool.root+"/"+path, callback)
 }
@@ -0,0 +1,60 @@
+//---------------------------------------------
+package Service
+
+//---------------------------------------------
+import (
+	"testing"
+	TIME "time"
+)
+
+//---------------------------------------------
+// 已有实例多于通道容量时，回调方边读取边查询实例列表，注册不能死锁
+func TestRegisterCallback(t *testing.T) {
+	path := "/backends/game-10000"
+	p := &service_pool{services: map[string]*service{path: {}}}
+	for _, id := range []string{"game1", "game2", "game3", "game4"} {
+		p.services[path].clients = append(p.services[path].clients, client{key: path + "/" + id})
+	}
+
+	ch := make(chan string, 1)
+	got := make(chan int)
+	go func() {
+		n := 0
+		for range ch {
+			p.get_service_ids(path)
+			if n++; n == 4 {
+				got <- n
+				return
+			}
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		p.register_callback(path, ch)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-TIME.After(5 * TIME.Second):
+		t.Fatal("register_callback deadlocked")
+	}
+	if n := <-got; n != 4 {
+		t.Error("notified", n)
+	}
+
+	// 注册后实例的变化同样通知
+	p.mu.Lock()
+	p.notify_callbacks(path, path+"/game5")
+	p.mu.Unlock()
+	select {
+	case key := <-ch:
+		if key != path+"/game5" {
+			t.Error("notified", key)
+		}
+	default:
+		t.Error("change not notified")
+	}
+}
+
+//---------------------------------------------
@@ -0,0 +1,342 @@
+//---------------------------------------------
+package websocket
+
+//---------------------------------------------
+/*
+	最小化的WebSocket(RFC 6455)实现，只支持二进制消息
+	升级后的连接实现了net.Conn:
+	Read  按字节流返回收到的二进制帧内容，一个帧可以包含多个数据包，一个数据包也可以跨越多个帧
+	Write 每次调用发送一个二进制帧
+	因此Agent可以像处理TCP连接一样处理WebSocket连接
+	ping由Read自动回复pong；收到close帧时回复close并返回io.EOF
+*/
+//---------------------------------------------
+import (
+	BUFIO "bufio"
+	RAND "crypto/rand"
+	SHA1 "crypto/sha1"
+	BASE64 "encoding/base64"
+	BINARY "encoding/binary"
+	ERRORS "errors"
+	FMT "fmt"
+	IO "io"
+	NET "net"
+	HTTP "net/http"
+	STRINGS "strings"
+	SYNC "sync"
+)
+
+//---------------------------------------------
+const (
+	OP_CONTINUATION = 0x0
+	OP_TEXT         = 0x1
+	OP_BINARY       = 0x2
+	OP_CLOSE        = 0x8
+	OP_PING         = 0x9
+	OP_PONG         = 0xA
+
+	CLOSE_NORMAL         = 1000
+	CLOSE_PROTOCOL_ERROR = 1002
+	CLOSE_UNSUPPORTED    = 1003
+	CLOSE_TOO_BIG        = 1009
+
+	DEFAULT_MAX_FRAME_SIZE = 1 << 20 // 单个帧的最大长度
+
+	accept_guid = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+//---------------------------------------------
+var (
+	ERROR_BAD_HANDSHAKE  = ERRORS.New("websocket: bad handshake")
+	ERROR_BAD_ORIGIN     = ERRORS.New("websocket: origin not allowed")
+	ERROR_PROTOCOL       = ERRORS.New("websocket: protocol error")
+	ERROR_TEXT_FRAME     = ERRORS.New("websocket: text frame unsupported")
+	ERROR_FRAME_TOO_BIG  = ERRORS.New("websocket: frame too big")
+	ERROR_NOT_HIJACKABLE = ERRORS.New("websocket: response does not support hijack")
+)
+
+//---------------------------------------------
+// 服务器端升级参数
+type Upgrader struct {
+	CheckOrigin  func(r *HTTP.Request) bool // 为空时允许任意来源
+	MaxFrameSize int                        // 为0时使用DEFAULT_MAX_FRAME_SIZE
+}
+
+//---------------------------------------------
+// 将HTTP请求升级为WebSocket连接，失败时已经向客户端回复了错误
+func (u *Upgrader) Upgrade(w HTTP.ResponseWriter, r *HTTP.Request) (*Conn, error) {
+	if r.Method != "GET" ||
+		!func_HeaderContains(r.Header, "Connection", "upgrade") ||
+		!func_HeaderContains(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" {
+		HTTP.Error(w, "bad websocket handshake", HTTP.StatusBadRequest)
+		return nil, ERROR_BAD_HANDSHAKE
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if k, err := BASE64.StdEncoding.DecodeString(key); err != nil || len(k) != 16 {
+		HTTP.Error(w, "bad websocket key", HTTP.StatusBadRequest)
+		return nil, ERROR_BAD_HANDSHAKE
+	}
+	if u.CheckOrigin != nil && !u.CheckOrigin(r) {
+		HTTP.Error(w, "origin not allowed", HTTP.StatusForbidden)
+		return nil, ERROR_BAD_ORIGIN
+	}
+
+	hj, ok := w.(HTTP.Hijacker)
+	if !ok {
+		HTTP.Error(w, "websocket unsupported", HTTP.StatusInternalServerError)
+		return nil, ERROR_NOT_HIJACKABLE
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + func_AcceptKey(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return func_NewConn(conn, rw.Reader, false, u.MaxFrameSize), nil
+}
+
+//---------------------------------------------
+// 客户端握手，conn为已经建立的TCP(或TLS)连接
+func Client(conn NET.Conn, host, path string) (*Conn, error) {
+	k := make([]byte, 16)
+	if _, err := IO.ReadFull(RAND.Reader, k); err != nil {
+		return nil, err
+	}
+	key := BASE64.StdEncoding.EncodeToString(k)
+	req := FMT.Sprintf("GET %v HTTP/1.1\r\nHost: %v\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %v\r\nSec-WebSocket-Version: 13\r\n\r\n", path, host, key)
+	if _, err := conn.Write([]byte(req)); err != nil {
+		return nil, err
+	}
+
+	br := BUFIO.NewReader(conn)
+	resp, err := HTTP.ReadResponse(br, &HTTP.Request{Method: "GET"})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != HTTP.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != func_AcceptKey(key) {
+		return nil, ERROR_BAD_HANDSHAKE
+	}
+	return func_NewConn(conn, br, true, 0), nil
+}
+
+//---------------------------------------------
+func func_AcceptKey(key string) string {
+	h := SHA1.New()
+	h.Write([]byte(key + accept_guid))
+	return BASE64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+//---------------------------------------------
+func func_HeaderContains(h HTTP.Header, name, token string) bool {
+	for _, v := range h[HTTP.CanonicalHeaderKey(name)] {
+		for _, t := range STRINGS.Split(v, ",") {
+			if STRINGS.EqualFold(STRINGS.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//---------------------------------------------
+// WebSocket连接
+type Conn struct {
+	NET.Conn
+	br        *BUFIO.Reader
+	client    bool // 客户端发送的帧必须加掩码，服务器发送的帧不加
+	max_frame int
+
+	remain int64   // 当前数据帧剩余未读取的字节数
+	mask   [4]byte // 当前数据帧的掩码
+	masked bool
+	pos    int // 掩码位置
+
+	wmu    SYNC.Mutex // Write与Read中的pong/close可能同时写
+	closed bool
+}
+
+//---------------------------------------------
+func func_NewConn(conn NET.Conn, br *BUFIO.Reader, client bool, max_frame int) *Conn {
+	if max_frame <= 0 {
+		max_frame = DEFAULT_MAX_FRAME_SIZE
+	}
+	return &Conn{Conn: conn, br: br, client: client, max_frame: max_frame}
+}
+
+//---------------------------------------------
+// 读取二进制帧的内容
+func (c *Conn) Read(b []byte) (int, error) {
+	for c.remain == 0 {
+		if err := c.next_frame(); err != nil {
+			return 0, err
+		}
+	}
+	if int64(len(b)) > c.remain {
+		b = b[:c.remain]
+	}
+	n, err := c.br.Read(b)
+	if c.masked {
+		for i := 0; i < n; i++ {
+			b[i] ^= c.mask[c.pos&3]
+			c.pos++
+		}
+	}
+	c.remain -= int64(n)
+	return n, err
+}
+
+//---------------------------------------------
+// 读取下一个帧头，控制帧在这里处理完毕
+func (c *Conn) next_frame() error {
+	var hdr [2]byte
+	if _, err := IO.ReadFull(c.br, hdr[:]); err != nil {
+		return err
+	}
+	fin := hdr[0]&0x80 != 0
+	opcode := hdr[0] & 0x0F
+	masked := hdr[1]&0x80 != 0
+	length := int64(hdr[1] & 0x7F)
+
+	if hdr[0]&0x70 != 0 || masked == c.client { // 不支持扩展；服务器只接受加掩码的帧，客户端相反
+		return c.fail(CLOSE_PROTOCOL_ERROR, ERROR_PROTOCOL)
+	}
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := IO.ReadFull(c.br, ext[:]); err != nil {
+			return err
+		}
+		length = int64(BINARY.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := IO.ReadFull(c.br, ext[:]); err != nil {
+			return err
+		}
+		length = int64(BINARY.BigEndian.Uint64(ext[:]))
+	}
+	if length < 0 || length > int64(c.max_frame) {
+		return c.fail(CLOSE_TOO_BIG, ERROR_FRAME_TOO_BIG)
+	}
+	var mask [4]byte
+	if masked {
+		if _, err := IO.ReadFull(c.br, mask[:]); err != nil {
+			return err
+		}
+	}
+
+	switch opcode {
+	case OP_BINARY, OP_CONTINUATION:
+		c.remain, c.mask, c.masked, c.pos = length, mask, masked, 0
+		return nil
+	case OP_TEXT:
+		return c.fail(CLOSE_UNSUPPORTED, ERROR_TEXT_FRAME)
+	case OP_CLOSE, OP_PING, OP_PONG:
+		if !fin || length > 125 {
+			return c.fail(CLOSE_PROTOCOL_ERROR, ERROR_PROTOCOL)
+		}
+		payload := make([]byte, length)
+		if _, err := IO.ReadFull(c.br, payload); err != nil {
+			return err
+		}
+		if masked {
+			for i := range payload {
+				payload[i] ^= mask[i&3]
+			}
+		}
+		switch opcode {
+		case OP_PING:
+			return c.write_frame(OP_PONG, payload)
+		case OP_CLOSE:
+			c.write_frame(OP_CLOSE, payload)
+			return IO.EOF
+		}
+		return nil
+	}
+	return c.fail(CLOSE_PROTOCOL_ERROR, ERROR_PROTOCOL)
+}
+
+//---------------------------------------------
+// 发送close帧并返回错误
+func (c *Conn) fail(code uint16, err error) error {
+	var payload [2]byte
+	BINARY.BigEndian.PutUint16(payload[:], code)
+	c.write_frame(OP_CLOSE, payload[:])
+	return err
+}
+
+//---------------------------------------------
+// 每次调用发送一个二进制帧
+func (c *Conn) Write(b []byte) (int, error) {
+	if err := c.write_frame(OP_BINARY, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+//---------------------------------------------
+func (c *Conn) write_frame(opcode byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return ERRORS.New("websocket: close sent")
+	}
+	if opcode == OP_CLOSE {
+		c.closed = true
+	}
+
+	buf := make([]byte, 0, len(payload)+14)
+	buf = append(buf, 0x80|opcode)
+	mask_bit := byte(0)
+	if c.client {
+		mask_bit = 0x80
+	}
+	n := len(payload)
+	switch {
+	case n <= 125:
+		buf = append(buf, mask_bit|byte(n))
+	case n <= 0xFFFF:
+		buf = append(buf, mask_bit|126, byte(n>>8), byte(n))
+	default:
+		var ext [8]byte
+		BINARY.BigEndian.PutUint64(ext[:], uint64(n))
+		buf = append(buf, mask_bit|127)
+		buf = append(buf, ext[:]...)
+	}
+
+	if c.client {
+		var mask [4]byte
+		if _, err := IO.ReadFull(RAND.Reader, mask[:]); err != nil {
+			return err
+		}
+		buf = append(buf, mask[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		for i := start; i < len(buf); i++ {
+			buf[i] ^= mask[(i-start)&3]
+		}
+	} else {
+		buf = append(buf, payload...)
+	}
+	_, err := c.Conn.Write(buf)
+	return err
+}
+
+//---------------------------------------------
+// 发送close帧后关闭连接
+func (c *Conn) Close() error {
+	var payload [2]byte
+	BINARY.BigEndian.PutUint16(payload[:], CLOSE_NORMAL)
+	c.write_frame(OP_CLOSE, payload[:])
+	return c.Conn.Close()
+}
+
+//---------------------------------------------
@@ -0,0 +1,110 @@
+//---------------------------------------------
+package websocket
+
+//---------------------------------------------
+import (
+	"bytes"
+	IO "io"
+	NET "net"
+	HTTP "net/http"
+	HTTPTEST "net/http/httptest"
+	STRINGS "strings"
+	"testing"
+)
+
+//---------------------------------------------
+// 回显服务器
+func func_EchoServer(t *testing.T) *HTTPTEST.Server {
+	u := &Upgrader{MaxFrameSize: 1024}
+	return HTTPTEST.NewServer(HTTP.HandlerFunc(func(w HTTP.ResponseWriter, r *HTTP.Request) {
+		conn, err := u.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 7) // 故意小于帧长度，验证跨帧读取
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			conn.Write(buf[:n])
+		}
+	}))
+}
+
+//---------------------------------------------
+func func_Dial(t *testing.T, srv *HTTPTEST.Server) *Conn {
+	addr := STRINGS.TrimPrefix(srv.URL, "http://")
+	raw, err := NET.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := Client(raw, addr, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+//---------------------------------------------
+func TestEcho(t *testing.T) {
+	srv := func_EchoServer(t)
+	defer srv.Close()
+	conn := func_Dial(t, srv)
+	defer conn.Close()
+
+	// 两个帧的内容拼接成连续的字节流
+	conn.Write([]byte("hello "))
+	conn.Write([]byte("websocket, with a longer frame"))
+	want := "hello websocket, with a longer frame"
+	got := make([]byte, len(want))
+	if _, err := IO.ReadFull(conn, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("echo: got %q want %q", got, want)
+	}
+
+	// ping由服务器自动回复pong，之后的数据不受影响
+	conn.write_frame(OP_PING, []byte("p"))
+	conn.Write(bytes.Repeat([]byte{1}, 300)) // 16位长度
+	got = make([]byte, 300)
+	if _, err := IO.ReadFull(conn, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, bytes.Repeat([]byte{1}, 300)) {
+		t.Error("echo after ping mismatch")
+	}
+}
+
+//---------------------------------------------
+func TestRejects(t *testing.T) {
+	srv := func_EchoServer(t)
+	defer srv.Close()
+
+	// 普通HTTP请求
+	resp, err := HTTP.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != HTTP.StatusBadRequest {
+		t.Error("plain http should be rejected:", resp.StatusCode)
+	}
+
+	// 超过最大帧长度
+	conn := func_Dial(t, srv)
+	conn.Write(make([]byte, 2048))
+	if _, err := conn.Read(make([]byte, 16)); err != IO.EOF {
+		t.Error("oversized frame should close the connection:", err)
+	}
+
+	// 文本帧
+	conn = func_Dial(t, srv)
+	conn.write_frame(OP_TEXT, []byte("text"))
+	if _, err := conn.Read(make([]byte, 16)); err != IO.EOF {
+		t.Error("text frame should close the connection:", err)
+	}
+}
+
+//---------------------------------------------
@@ -0,0 +1,309 @@
+//---------------------------------------------
+package admin
+
+//---------------------------------------------
+/*
+	运维HTTP接口，挂载在6060端口(与pprof共用)，请求头X-Admin-Secret必须与 --admin-secret 一致
+	GET  /admin/sessions   列出在线会话，可按 userid, gsid, ip 筛选
+	POST /admin/kick       踢掉玩家，参数 userid(必填，逗号分隔), reason
+	POST /admin/broadcast  下发服务器公告，参数 msg(必填)，可按 userid, gsid, ip 筛选
+	GET  /admin/stats      在线统计
+	POST /admin/drain      排空Agent后退出，参数 timeout(例如 5m), addr(建议的重连地址), msg
+	GET  /admin/capture    列出需要抓包的玩家
+	POST /admin/capture    增删需要抓包的玩家，参数 userid(必填), enable(默认1，0为取消)，下次登陆时生效
+	userid: 逗号分隔的玩家ID；gsid: 游戏服ID；ip: 单个IP或CIDR，例如 10.0.0.0/8
+	查询与操作都投递给会话协程执行，CONST_DispatchTimeout内未回复的会话计入missed
+*/
+//---------------------------------------------
+import (
+	SUBTLE "crypto/subtle"
+	JSON "encoding/json"
+	ERRORS "errors"
+	NET "net"
+	HTTP "net/http"
+	STRCONV "strconv"
+	STRINGS "strings"
+	SYNC "sync"
+	TIME "time"
+
+	CAPTURE "FKGoServer/FKServer_Agent/Capture"
+	LIMITER "FKGoServer/FKServer_Agent/Limiter"
+	SESSION "FKGoServer/FKServer_Agent/Session"
+
+	LOG "github.com/Sirupsen/logrus"
+	CLI "gopkg.in/urfave/cli.v2"
+)
+
+//---------------------------------------------
+const (
+	CONST_DispatchTimeout = 2 * TIME.Second // 等待会话协程回复的最长时间
+	SECRET_HEADER         = "X-Admin-Secret"
+)
+
+//---------------------------------------------
+var (
+	ERROR_BAD_USERID = ERRORS.New("bad userid")
+	ERROR_BAD_IP     = ERRORS.New("bad ip")
+
+	once     SYNC.Once
+	_drainer Drainer
+)
+
+//---------------------------------------------
+// 排空Agent，由framework实现
+type Drainer interface {
+	Drain(timeout TIME.Duration, addr, msg string) bool // 开始排空，已在排空中时返回false
+	Draining() bool
+}
+
+//---------------------------------------------
+// 设置排空的实现，未设置时 /admin/drain 不可用
+func Func_SetDrainer(d Drainer) {
+	_drainer = d
+}
+
+//---------------------------------------------
+// 注册运维接口到默认的HTTP服务
+// 未设置 --admin-secret 时不启用
+func InitWithCliContext(c *CLI.Context) {
+	once.Do(func() {
+		secret := c.String("admin-secret")
+		if secret == "" {
+			LOG.Warning("未设置 --admin-secret，运维接口未启用")
+			return
+		}
+		HTTP.Handle("/admin/", NewHandler(secret))
+		LOG.Println("运维接口已启用: /admin/")
+	})
+}
+
+//---------------------------------------------
+// 创建运维接口
+func NewHandler(secret string) HTTP.Handler {
+	mux := HTTP.NewServeMux()
+	mux.HandleFunc("/admin/sessions", func_Sessions)
+	mux.HandleFunc("/admin/kick", func_Kick)
+	mux.HandleFunc("/admin/broadcast", func_Broadcast)
+	mux.HandleFunc("/admin/stats", func_Stats)
+	mux.HandleFunc("/admin/drain", func_Drain)
+	mux.HandleFunc("/admin/capture", func_Capture)
+
+	return HTTP.HandlerFunc(func(w HTTP.ResponseWriter, r *HTTP.Request) {
+		given := r.Header.Get(SECRET_HEADER)
+		if SUBTLE.ConstantTimeCompare([]byte(given), []byte(secret)) != 1 {
+			LOG.Warningf("运维接口鉴权失败 来源:%v 路径:%v", r.RemoteAddr, r.URL.Path)
+			HTTP.Error(w, "forbidden", HTTP.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+//---------------------------------------------
+// GET /admin/sessions
+func func_Sessions(w HTTP.ResponseWriter, r *HTTP.Request) {
+	if r.Method != "GET" {
+		HTTP.Error(w, "method not allowed", HTTP.StatusMethodNotAllowed)
+		return
+	}
+	filter, err := ParseFilter(r)
+	if err != nil {
+		HTTP.Error(w, err.Error(), HTTP.StatusBadRequest)
+		return
+	}
+	infos, missed := SESSION.Func_Dispatch(SESSION.Command{Type: SESSION.CMD_INFO, Filter: filter}, CONST_DispatchTimeout)
+	if infos == nil {
+		infos = []*SESSION.Info{}
+	}
+	func_WriteJSON(w, map[string]interface{}{
+		"sessions": infos,
+		"missed":   missed,
+	})
+}
+
+//---------------------------------------------
+// POST /admin/kick
+func func_Kick(w HTTP.ResponseWriter, r *HTTP.Request) {
+	if r.Method != "POST" {
+		HTTP.Error(w, "method not allowed", HTTP.StatusMethodNotAllowed)
+		return
+	}
+	filter, err := ParseFilter(r)
+	if err != nil {
+		HTTP.Error(w, err.Error(), HTTP.StatusBadRequest)
+		return
+	}
+	// 踢人必须指定玩家，避免误踢全服
+	if len(filter.UserIds) == 0 {
+		HTTP.Error(w, "userid required", HTTP.StatusBadRequest)
+		return
+	}
+	reason := r.FormValue("reason")
+	infos, missed := SESSION.Func_Dispatch(SESSION.Command{Type: SESSION.CMD_KICK, Filter: filter, Text: reason}, CONST_DispatchTimeout)
+	LOG.Warningf("运维踢人 来源:%v 玩家:%v 原因:%v 踢掉会话:%v", r.RemoteAddr, filter.UserIds, reason, len(infos))
+	func_WriteJSON(w, map[string]interface{}{
+		"kicked": len(infos),
+		"missed": missed,
+	})
+}
+
+//---------------------------------------------
+// POST /admin/broadcast
+func func_Broadcast(w HTTP.ResponseWriter, r *HTTP.Request) {
+	if r.Method != "POST" {
+		HTTP.Error(w, "method not allowed", HTTP.StatusMethodNotAllowed)
+		return
+	}
+	filter, err := ParseFilter(r)
+	if err != nil {
+		HTTP.Error(w, err.Error(), HTTP.StatusBadRequest)
+		return
+	}
+	msg := r.FormValue("msg")
+	if msg == "" {
+		HTTP.Error(w, "msg required", HTTP.StatusBadRequest)
+		return
+	}
+	infos, missed := SESSION.Func_Dispatch(SESSION.Command{Type: SESSION.CMD_NOTICE, Filter: filter, Text: msg}, CONST_DispatchTimeout)
+	LOG.Infof("运维公告 来源:%v 内容:%v 送达会话:%v", r.RemoteAddr, msg, len(infos))
+	func_WriteJSON(w, map[string]interface{}{
+		"delivered": len(infos),
+		"missed":    missed,
+	})
+}
+
+//---------------------------------------------
+// GET /admin/stats
+func func_Stats(w HTTP.ResponseWriter, r *HTTP.Request) {
+	if r.Method != "GET" {
+		HTTP.Error(w, "method not allowed", HTTP.StatusMethodNotAllowed)
+		return
+	}
+	infos, missed := SESSION.Func_Dispatch(SESSION.Command{Type: SESSION.CMD_INFO}, CONST_DispatchTimeout)
+	logged_in, detached := 0, 0
+	games := make(map[string]int)
+	for _, info := range infos {
+		if info.UserId != 0 {
+			logged_in++
+		}
+		if info.Detached {
+			detached++
+		}
+		if info.GSID != "" {
+			games[info.GSID]++
+		}
+	}
+	func_WriteJSON(w, map[string]interface{}{
+		"online":    SESSION.Func_OnlineCount(),
+		"logged_in": logged_in,
+		"detached":  detached,
+		"games":     games,
+		"missed":    missed,
+		"limiter":   LIMITER.Func_Counters(),
+		"draining":  _drainer != nil && _drainer.Draining(),
+	})
+}
+
+//---------------------------------------------
+// POST /admin/drain
+func func_Drain(w HTTP.ResponseWriter, r *HTTP.Request) {
+	if r.Method != "POST" {
+		HTTP.Error(w, "method not allowed", HTTP.StatusMethodNotAllowed)
+		return
+	}
+	if _drainer == nil {
+		HTTP.Error(w, "drain unavailable", HTTP.StatusServiceUnavailable)
+		return
+	}
+	var timeout TIME.Duration
+	if s := r.FormValue("timeout"); s != "" {
+		var err error
+		if timeout, err = TIME.ParseDuration(s); err != nil || timeout < 0 {
+			HTTP.Error(w, "bad timeout", HTTP.StatusBadRequest)
+			return
+		}
+	}
+	started := _drainer.Drain(timeout, r.FormValue("addr"), r.FormValue("msg"))
+	LOG.Warningf("运维排空Agent 来源:%v 最长等待:%v 已在排空中:%v", r.RemoteAddr, timeout, !started)
+	func_WriteJSON(w, map[string]interface{}{
+		"started":  started,
+		"draining": true,
+	})
+}
+
+//---------------------------------------------
+// GET|POST /admin/capture
+func func_Capture(w HTTP.ResponseWriter, r *HTTP.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		filter, err := ParseFilter(r)
+		if err != nil {
+			HTTP.Error(w, err.Error(), HTTP.StatusBadRequest)
+			return
+		}
+		if len(filter.UserIds) == 0 {
+			HTTP.Error(w, "userid required", HTTP.StatusBadRequest)
+			return
+		}
+		enable := true
+		if s := r.FormValue("enable"); s != "" {
+			if enable, err = STRCONV.ParseBool(s); err != nil {
+				HTTP.Error(w, "bad enable", HTTP.StatusBadRequest)
+				return
+			}
+		}
+		for _, id := range filter.UserIds {
+			CAPTURE.Func_SetUser(id, enable)
+		}
+		LOG.Infof("运维设置抓包 来源:%v 玩家:%v 开启:%v", r.RemoteAddr, filter.UserIds, enable)
+	default:
+		HTTP.Error(w, "method not allowed", HTTP.StatusMethodNotAllowed)
+		return
+	}
+	func_WriteJSON(w, map[string]interface{}{
+		"enabled": CAPTURE.Func_Enabled(),
+		"users":   CAPTURE.Func_Users(),
+	})
+}
+
+//---------------------------------------------
+// 从请求参数解析会话筛选条件
+func ParseFilter(r *HTTP.Request) (f SESSION.Filter, err error) {
+	if s := r.FormValue("userid"); s != "" {
+		for _, v := range STRINGS.Split(s, ",") {
+			id, err := STRCONV.ParseInt(STRINGS.TrimSpace(v), 10, 32)
+			if err != nil || id <= 0 {
+				return f, ERROR_BAD_USERID
+			}
+			f.UserIds = append(f.UserIds, int32(id))
+		}
+	}
+	f.GSID = r.FormValue("gsid")
+	if s := r.FormValue("ip"); s != "" {
+		if !STRINGS.Contains(s, "/") {
+			ip := NET.ParseIP(s)
+			if ip == nil {
+				return f, ERROR_BAD_IP
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			f.IPNet = &NET.IPNet{IP: ip, Mask: NET.CIDRMask(bits, bits)}
+		} else if _, f.IPNet, err = NET.ParseCIDR(s); err != nil {
+			return f, ERROR_BAD_IP
+		}
+	}
+	return f, nil
+}
+
+//---------------------------------------------
+func func_WriteJSON(w HTTP.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := JSON.NewEncoder(w).Encode(v); err != nil {
+		LOG.Error("运维接口输出失败:", err)
+	}
+}
+
+//---------------------------------------------
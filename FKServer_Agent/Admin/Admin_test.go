@@ -0,0 +1,173 @@
+//---------------------------------------------
+package admin
+
+//---------------------------------------------
+import (
+	JSON "encoding/json"
+	NET "net"
+	HTTP "net/http"
+	HTTPTEST "net/http/httptest"
+	URL "net/url"
+	STRINGS "strings"
+	"testing"
+	TIME "time"
+
+	CAPTURE "FKGoServer/FKServer_Agent/Capture"
+	SESSION "FKGoServer/FKServer_Agent/Session"
+)
+
+//---------------------------------------------
+// 模拟会话协程，只处理运维指令
+func func_FakeSession(userid int32, ip, gsid string) *SESSION.Session {
+	sess := &SESSION.Session{
+		UserId: userid,
+		IP:     NET.ParseIP(ip),
+		GSID:   gsid,
+		Die:    make(chan struct{}),
+		Admin:  make(chan SESSION.Command, SESSION.DEFAULT_ADMIN_QUEUE),
+	}
+	SESSION.Func_AddOnline(sess)
+	go func() {
+		for cmd := range sess.Admin {
+			if !cmd.Filter.Match(sess) {
+				cmd.Reply <- nil
+				continue
+			}
+			info := sess.Snapshot(false)
+			if cmd.Type == SESSION.CMD_KICK {
+				SESSION.Func_RemoveOnline(sess)
+				close(sess.Die)
+			}
+			cmd.Reply <- info
+			if cmd.Type == SESSION.CMD_KICK {
+				return
+			}
+		}
+	}()
+	return sess
+}
+
+//---------------------------------------------
+func func_Do(t *testing.T, h HTTP.Handler, method, path, secret string, form URL.Values) (int, map[string]interface{}) {
+	var r *HTTP.Request
+	if method == "POST" {
+		r = HTTPTEST.NewRequest(method, path, STRINGS.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		r = HTTPTEST.NewRequest(method, path+"?"+form.Encode(), nil)
+	}
+	r.Header.Set(SECRET_HEADER, secret)
+	w := HTTPTEST.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	var ret map[string]interface{}
+	if w.Code == HTTP.StatusOK {
+		if err := JSON.Unmarshal(w.Body.Bytes(), &ret); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code, ret
+}
+
+//---------------------------------------------
+func TestAdmin(t *testing.T) {
+	func_FakeSession(1, "10.0.0.1", "game1")
+	func_FakeSession(2, "10.0.0.2", "game2")
+	func_FakeSession(3, "192.168.1.3", "game1")
+
+	h := NewHandler("secret")
+
+	if code, _ := func_Do(t, h, "GET", "/admin/stats", "wrong", nil); code != HTTP.StatusForbidden {
+		t.Error("bad secret should be forbidden:", code)
+	}
+
+	_, ret := func_Do(t, h, "GET", "/admin/sessions", "secret", URL.Values{"gsid": {"game1"}})
+	if n := len(ret["sessions"].([]interface{})); n != 2 {
+		t.Error("gsid filter got", n)
+	}
+	_, ret = func_Do(t, h, "GET", "/admin/sessions", "secret", URL.Values{"ip": {"10.0.0.0/8"}})
+	if n := len(ret["sessions"].([]interface{})); n != 2 {
+		t.Error("ip filter got", n)
+	}
+
+	if code, _ := func_Do(t, h, "POST", "/admin/kick", "secret", URL.Values{}); code != HTTP.StatusBadRequest {
+		t.Error("kick without userid should fail:", code)
+	}
+	_, ret = func_Do(t, h, "POST", "/admin/kick", "secret", URL.Values{"userid": {"2"}, "reason": {"test"}})
+	if ret["kicked"].(float64) != 1 {
+		t.Error("kick got", ret)
+	}
+
+	_, ret = func_Do(t, h, "POST", "/admin/broadcast", "secret", URL.Values{"msg": {"hello"}})
+	if ret["delivered"].(float64) != 2 {
+		t.Error("broadcast got", ret)
+	}
+
+	_, ret = func_Do(t, h, "GET", "/admin/stats", "secret", nil)
+	if ret["online"].(float64) != 2 || ret["games"].(map[string]interface{})["game1"].(float64) != 2 {
+		t.Error("stats got", ret)
+	}
+}
+
+//---------------------------------------------
+type fake_drainer struct {
+	timeout  TIME.Duration
+	addr     string
+	draining bool
+}
+
+func (d *fake_drainer) Drain(timeout TIME.Duration, addr, msg string) bool {
+	if d.draining {
+		return false
+	}
+	d.timeout, d.addr, d.draining = timeout, addr, true
+	return true
+}
+
+func (d *fake_drainer) Draining() bool {
+	return d.draining
+}
+
+//---------------------------------------------
+func TestDrain(t *testing.T) {
+	h := NewHandler("secret")
+	defer Func_SetDrainer(nil)
+	if code, _ := func_Do(t, h, "POST", "/admin/drain", "secret", nil); code != HTTP.StatusServiceUnavailable {
+		t.Error("drain without drainer got", code)
+	}
+
+	d := &fake_drainer{}
+	Func_SetDrainer(d)
+	if code, _ := func_Do(t, h, "POST", "/admin/drain", "secret", URL.Values{"timeout": {"soon"}}); code != HTTP.StatusBadRequest {
+		t.Error("bad timeout got", code)
+	}
+	_, ret := func_Do(t, h, "POST", "/admin/drain", "secret", URL.Values{"timeout": {"30s"}, "addr": {"agent2:8888"}})
+	if ret["started"] != true || d.timeout != 30*TIME.Second || d.addr != "agent2:8888" {
+		t.Error("drain got", ret, d)
+	}
+	if _, ret = func_Do(t, h, "POST", "/admin/drain", "secret", nil); ret["started"] != false {
+		t.Error("second drain should not start:", ret)
+	}
+	if _, ret = func_Do(t, h, "GET", "/admin/stats", "secret", nil); ret["draining"] != true {
+		t.Error("stats should report draining:", ret)
+	}
+}
+
+//---------------------------------------------
+func TestCapture(t *testing.T) {
+	h := NewHandler("secret")
+	CAPTURE.Init("", nil, 0)
+	if code, _ := func_Do(t, h, "POST", "/admin/capture", "secret", nil); code != HTTP.StatusBadRequest {
+		t.Error("capture without userid got", code)
+	}
+	_, ret := func_Do(t, h, "POST", "/admin/capture", "secret", URL.Values{"userid": {"3,1"}})
+	if users := ret["users"].([]interface{}); len(users) != 2 || users[0].(float64) != 1 || ret["enabled"] != false {
+		t.Error("capture got", ret)
+	}
+	func_Do(t, h, "POST", "/admin/capture", "secret", URL.Values{"userid": {"1"}, "enable": {"0"}})
+	if _, ret = func_Do(t, h, "GET", "/admin/capture", "secret", nil); len(ret["users"].([]interface{})) != 1 {
+		t.Error("disable capture got", ret)
+	}
+}
+
+//---------------------------------------------
@@ -0,0 +1,202 @@
+//---------------------------------------------
+package auth
+
+//---------------------------------------------
+/*
+	登陆鉴权
+	根据S_user_login_info.F_login_way选择对应的鉴权器:
+	1. udid:        设备udid游客登陆，未知设备可以自动创建游客账号
+	2. certificate: 客户端证书登陆，证书需预先存在于账号存储中
+	3. token:       用户中心签发的HMAC票据登陆，见Ticket.go
+	启用哪些方式由命令行参数 --auth 决定
+*/
+//---------------------------------------------
+import (
+	STRINGS "strings"
+	SYNC "sync"
+
+	MSGDEFINE "FKGoServer/FKLib_Common/MsgDefine"
+
+	LOG "github.com/Sirupsen/logrus"
+	CLI "gopkg.in/urfave/cli.v2"
+)
+
+//---------------------------------------------
+// 鉴权失败原因，Code即回复给客户端的S_error_info.F_code
+type Error struct {
+	Code int32
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+//---------------------------------------------
+var (
+	ERROR_WAY_UNSUPPORTED = &Error{MSGDEFINE.ERR_LOGIN_WAY_UNSUPPORTED, "login way unsupported"}
+	ERROR_BAD_CREDENTIAL  = &Error{MSGDEFINE.ERR_LOGIN_BAD_CREDENTIAL, "bad credential"}
+	ERROR_TOKEN_EXPIRED   = &Error{MSGDEFINE.ERR_LOGIN_TOKEN_EXPIRED, "token expired"}
+	ERROR_ACCOUNT_BANNED  = &Error{MSGDEFINE.ERR_LOGIN_ACCOUNT_BANNED, "account banned"}
+	ERROR_INTERNAL        = &Error{MSGDEFINE.ERR_LOGIN_INTERNAL, "internal error"}
+)
+
+//---------------------------------------------
+// 鉴权器，鉴权成功返回玩家ID
+type Authenticator interface {
+	Authenticate(info *MSGDEFINE.S_user_login_info) (int32, error)
+}
+
+//---------------------------------------------
+// 全部已启用的鉴权方式
+type auth_pool struct {
+	ways  map[int32]Authenticator
+	store Store
+	mu    SYNC.RWMutex
+}
+
+var (
+	_default_pool auth_pool
+	once          SYNC.Once
+)
+
+//---------------------------------------------
+func InitWithCliContext(c *CLI.Context) {
+	once.Do(func() {
+		store := Store(NewMemoryStore())
+		if path := c.String("auth-accounts"); path != "" {
+			s, err := NewFileStore(path)
+			if err != nil {
+				LOG.Fatal("加载账号文件失败:", err)
+			}
+			store = s
+		}
+		_default_pool.init(c.StringSlice("auth"), store, c.String("auth-secret"), c.Bool("auth-guest"))
+	})
+}
+
+//---------------------------------------------
+// 直接指定参数初始化，可重复调用，主要用于测试
+func Init(ways []string, store Store, secret string, guest bool) {
+	_default_pool.init(ways, store, secret, guest)
+}
+
+//---------------------------------------------
+func (p *auth_pool) init(ways []string, store Store, secret string, guest bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.store = store
+	p.ways = make(map[int32]Authenticator)
+	for _, way := range ways {
+		switch STRINGS.TrimSpace(way) {
+		case "udid":
+			p.ways[MSGDEFINE.LOGIN_WAY_UDID] = &UdidAuthenticator{Store: store, AllowGuest: guest}
+		case "certificate":
+			p.ways[MSGDEFINE.LOGIN_WAY_CERTIFICATE] = &CertificateAuthenticator{Store: store}
+		case "token":
+			if secret == "" {
+				LOG.Warning("未设置票据密钥 --auth-secret，票据登陆未启用")
+				continue
+			}
+			p.ways[MSGDEFINE.LOGIN_WAY_TOKEN] = &TokenAuthenticator{Store: store, Secret: []byte(secret)}
+		default:
+			LOG.Warning("未知的登陆方式:", way)
+		}
+	}
+	LOG.Println("启用登陆方式:", ways)
+}
+
+//---------------------------------------------
+func (p *auth_pool) authenticate(info *MSGDEFINE.S_user_login_info) (int32, error) {
+	p.mu.RLock()
+	a := p.ways[info.F_login_way]
+	p.mu.RUnlock()
+	if a == nil {
+		return 0, ERROR_WAY_UNSUPPORTED
+	}
+	return a.Authenticate(info)
+}
+
+//---------------------------------------------
+// 根据登陆方式进行鉴权
+func Func_Authenticate(info *MSGDEFINE.S_user_login_info) (int32, error) {
+	return _default_pool.authenticate(info)
+}
+
+//---------------------------------------------
+// 将鉴权错误转换为回复给客户端的错误信息
+func Func_ErrorInfo(err error) MSGDEFINE.S_error_info {
+	if e, ok := err.(*Error); ok {
+		return MSGDEFINE.S_error_info{F_code: e.Code, F_msg: e.Msg}
+	}
+	return MSGDEFINE.S_error_info{F_code: ERROR_INTERNAL.Code, F_msg: ERROR_INTERNAL.Msg}
+}
+
+//---------------------------------------------
+// 设备udid游客登陆
+type UdidAuthenticator struct {
+	Store      Store
+	AllowGuest bool // 未知设备是否自动创建游客账号
+}
+
+func (a *UdidAuthenticator) Authenticate(info *MSGDEFINE.S_user_login_info) (int32, error) {
+	if info.F_open_udid == "" {
+		return 0, ERROR_BAD_CREDENTIAL
+	}
+	acc, ok := a.Store.FindByUdid(info.F_open_udid)
+	if !ok {
+		if !a.AllowGuest {
+			return 0, ERROR_BAD_CREDENTIAL
+		}
+		var err error
+		if acc, err = a.Store.CreateGuest(info.F_open_udid); err != nil {
+			LOG.Error("创建游客账号失败:", err)
+			return 0, ERROR_INTERNAL
+		}
+		LOG.Infof("创建游客账号 udid:%v userid:%v", acc.Udid, acc.Id)
+	}
+	if acc.Banned {
+		return 0, ERROR_ACCOUNT_BANNED
+	}
+	return acc.Id, nil
+}
+
+//---------------------------------------------
+// 客户端证书登陆
+type CertificateAuthenticator struct {
+	Store Store
+}
+
+func (a *CertificateAuthenticator) Authenticate(info *MSGDEFINE.S_user_login_info) (int32, error) {
+	if info.F_client_certificate == "" {
+		return 0, ERROR_BAD_CREDENTIAL
+	}
+	acc, ok := a.Store.FindByCertificate(info.F_client_certificate)
+	if !ok {
+		return 0, ERROR_BAD_CREDENTIAL
+	}
+	if acc.Banned {
+		return 0, ERROR_ACCOUNT_BANNED
+	}
+	return acc.Id, nil
+}
+
+//---------------------------------------------
+// 票据登陆，票据通过F_client_certificate字段携带
+type TokenAuthenticator struct {
+	Store  Store // 用于检查封禁，票据中的玩家不要求存在于本地存储
+	Secret []byte
+}
+
+func (a *TokenAuthenticator) Authenticate(info *MSGDEFINE.S_user_login_info) (int32, error) {
+	userid, err := Func_VerifyTicket(a.Secret, info.F_client_certificate)
+	if err != nil {
+		return 0, err
+	}
+	if acc, ok := a.Store.FindById(userid); ok && acc.Banned {
+		return 0, ERROR_ACCOUNT_BANNED
+	}
+	return userid, nil
+}
+
+//---------------------------------------------
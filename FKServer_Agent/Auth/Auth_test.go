@@ -0,0 +1,174 @@
+//---------------------------------------------
+package auth
+
+//---------------------------------------------
+import (
+	IOUTIL "io/ioutil"
+	OS "os"
+	FILEPATH "path/filepath"
+	SYNC "sync"
+	"testing"
+	TIME "time"
+
+	MSGDEFINE "FKGoServer/FKLib_Common/MsgDefine"
+)
+
+//---------------------------------------------
+func TestUdidGuest(t *testing.T) {
+	Init([]string{"udid"}, NewMemoryStore(), "", true)
+
+	info := MSGDEFINE.S_user_login_info{F_login_way: MSGDEFINE.LOGIN_WAY_UDID, F_open_udid: "device-a"}
+	id1, err := Func_Authenticate(&info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id2, err := Func_Authenticate(&info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id1 != id2 {
+		t.Errorf("same udid got different userid: %v %v", id1, id2)
+	}
+
+	info.F_open_udid = "device-b"
+	id3, _ := Func_Authenticate(&info)
+	if id3 == id1 {
+		t.Error("different udid got same userid")
+	}
+
+	info.F_open_udid = ""
+	if _, err := Func_Authenticate(&info); err != ERROR_BAD_CREDENTIAL {
+		t.Error("empty udid should fail:", err)
+	}
+}
+
+//---------------------------------------------
+// 同一设备并发登陆时都可能在FindByUdid中查不到账号，CreateGuest应返回同一个账号
+func TestUdidGuestConcurrent(t *testing.T) {
+	store := NewMemoryStore()
+
+	const N = 16
+	ids := make([]int32, N)
+	var wg SYNC.WaitGroup
+	for i := 0; i < N; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			acc, err := store.CreateGuest("device-a")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ids[i] = acc.Id
+		}(i)
+	}
+	wg.Wait()
+
+	for _, id := range ids {
+		if id != ids[0] {
+			t.Fatal("same udid got different userid:", ids)
+		}
+	}
+	if acc, ok := store.FindByUdid("device-a"); !ok || acc.Id != ids[0] {
+		t.Error("guest account mismatch:", acc, ids[0])
+	}
+}
+
+//---------------------------------------------
+func TestUdidNoGuest(t *testing.T) {
+	store := NewMemoryStore()
+	store.Add(&Account{Id: 7, Udid: "known"})
+	Init([]string{"udid"}, store, "", false)
+
+	info := MSGDEFINE.S_user_login_info{F_login_way: MSGDEFINE.LOGIN_WAY_UDID, F_open_udid: "unknown"}
+	if _, err := Func_Authenticate(&info); err != ERROR_BAD_CREDENTIAL {
+		t.Error("unknown udid should fail:", err)
+	}
+	info.F_open_udid = "known"
+	if id, err := Func_Authenticate(&info); err != nil || id != 7 {
+		t.Error("known udid login failed:", id, err)
+	}
+}
+
+//---------------------------------------------
+func TestCertificate(t *testing.T) {
+	store := NewMemoryStore()
+	store.Add(&Account{Id: 10, Certificate: "cert-10"})
+	store.Add(&Account{Id: 11, Certificate: "cert-11", Banned: true})
+	Init([]string{"certificate"}, store, "", true)
+
+	info := MSGDEFINE.S_user_login_info{F_login_way: MSGDEFINE.LOGIN_WAY_CERTIFICATE, F_client_certificate: "cert-10"}
+	if id, err := Func_Authenticate(&info); err != nil || id != 10 {
+		t.Error("certificate login failed:", id, err)
+	}
+	info.F_client_certificate = "cert-11"
+	if _, err := Func_Authenticate(&info); err != ERROR_ACCOUNT_BANNED {
+		t.Error("banned account should fail:", err)
+	}
+	info.F_client_certificate = "cert-xx"
+	if _, err := Func_Authenticate(&info); err != ERROR_BAD_CREDENTIAL {
+		t.Error("unknown certificate should fail:", err)
+	}
+
+	// 未启用的登陆方式
+	info.F_login_way = MSGDEFINE.LOGIN_WAY_UDID
+	if _, err := Func_Authenticate(&info); err != ERROR_WAY_UNSUPPORTED {
+		t.Error("disabled way should fail:", err)
+	}
+}
+
+//---------------------------------------------
+func TestToken(t *testing.T) {
+	secret := []byte("secret")
+	Init([]string{"token"}, NewMemoryStore(), string(secret), true)
+
+	info := MSGDEFINE.S_user_login_info{F_login_way: MSGDEFINE.LOGIN_WAY_TOKEN}
+	info.F_client_certificate = Func_SignTicket(secret, 42, TIME.Now().Add(TIME.Minute))
+	if id, err := Func_Authenticate(&info); err != nil || id != 42 {
+		t.Error("token login failed:", id, err)
+	}
+
+	info.F_client_certificate = Func_SignTicket(secret, 42, TIME.Now().Add(-TIME.Minute))
+	if _, err := Func_Authenticate(&info); err != ERROR_TOKEN_EXPIRED {
+		t.Error("expired token should fail:", err)
+	}
+
+	info.F_client_certificate = Func_SignTicket([]byte("other"), 42, TIME.Now().Add(TIME.Minute))
+	if _, err := Func_Authenticate(&info); err != ERROR_BAD_CREDENTIAL {
+		t.Error("forged token should fail:", err)
+	}
+
+	info.F_client_certificate = "42:99999999999:00"
+	if _, err := Func_Authenticate(&info); err != ERROR_BAD_CREDENTIAL {
+		t.Error("bad signature should fail:", err)
+	}
+}
+
+//---------------------------------------------
+func TestFileStore(t *testing.T) {
+	dir, err := IOUTIL.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer OS.RemoveAll(dir)
+	path := FILEPATH.Join(dir, "accounts.json")
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc, err := store.CreateGuest("device-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reload, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := reload.FindByUdid("device-a"); !ok || got.Id != acc.Id {
+		t.Error("guest account not persisted")
+	}
+}
+
+//---------------------------------------------
@@ -0,0 +1,188 @@
+//---------------------------------------------
+package auth
+
+//---------------------------------------------
+import (
+	JSON "encoding/json"
+	ERRORS "errors"
+	IOUTIL "io/ioutil"
+	OS "os"
+	SYNC "sync"
+
+	LOG "github.com/Sirupsen/logrus"
+)
+
+//---------------------------------------------
+var (
+	ERROR_ACCOUNT_EXISTS = ERRORS.New("account already exists")
+)
+
+//---------------------------------------------
+// 一个本地账号记录
+type Account struct {
+	Id          int32  `json:"id"`          // 玩家ID
+	Udid        string `json:"udid"`        // 设备udid，游客登陆使用
+	Certificate string `json:"certificate"` // 客户端证书，证书登陆使用
+	Banned      bool   `json:"banned"`      // 是否已被封禁
+}
+
+//---------------------------------------------
+// 账号存储
+// 通常公司会有一个用户中心服务器，这里只提供一个本地实现，便于测试和小规模部署
+type Store interface {
+	FindById(id int32) (*Account, bool)
+	FindByUdid(udid string) (*Account, bool)
+	FindByCertificate(cert string) (*Account, bool)
+	CreateGuest(udid string) (*Account, error)
+}
+
+//---------------------------------------------
+// 内存账号存储，若指定了文件路径，则从文件加载并在新增账号后写回
+type MemoryStore struct {
+	path     string
+	accounts []*Account
+	by_id    map[int32]*Account
+	by_udid  map[string]*Account
+	by_cert  map[string]*Account
+	next_id  int32
+	mu       SYNC.RWMutex
+}
+
+//---------------------------------------------
+// 创建一个空的内存账号存储
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{}
+	s.by_id = make(map[int32]*Account)
+	s.by_udid = make(map[string]*Account)
+	s.by_cert = make(map[string]*Account)
+	s.next_id = 1
+	return s
+}
+
+//---------------------------------------------
+// 从JSON文件创建账号存储，文件不存在时视为空存储
+// 文件格式为Account数组，例如：
+// [{"id":1,"udid":"xxx","certificate":"yyy","banned":false}]
+func NewFileStore(path string) (*MemoryStore, error) {
+	s := NewMemoryStore()
+	s.path = path
+
+	data, err := IOUTIL.ReadFile(path)
+	if OS.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []*Account
+	if err := JSON.Unmarshal(data, &accounts); err != nil {
+		return nil, err
+	}
+	for _, acc := range accounts {
+		if err := s.func_Add(acc); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+//---------------------------------------------
+// 增加一个账号
+func (s *MemoryStore) Add(acc *Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.func_Add(acc)
+}
+
+//---------------------------------------------
+func (s *MemoryStore) func_Add(acc *Account) error {
+	if acc.Id == 0 {
+		acc.Id = s.next_id
+	}
+	if _, ok := s.by_id[acc.Id]; ok {
+		return ERROR_ACCOUNT_EXISTS
+	}
+	if _, ok := s.by_udid[acc.Udid]; ok && acc.Udid != "" {
+		return ERROR_ACCOUNT_EXISTS
+	}
+	if _, ok := s.by_cert[acc.Certificate]; ok && acc.Certificate != "" {
+		return ERROR_ACCOUNT_EXISTS
+	}
+
+	s.accounts = append(s.accounts, acc)
+	s.by_id[acc.Id] = acc
+	if acc.Udid != "" {
+		s.by_udid[acc.Udid] = acc
+	}
+	if acc.Certificate != "" {
+		s.by_cert[acc.Certificate] = acc
+	}
+	if acc.Id >= s.next_id {
+		s.next_id = acc.Id + 1
+	}
+	return nil
+}
+
+//---------------------------------------------
+func (s *MemoryStore) FindById(id int32) (*Account, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	acc, ok := s.by_id[id]
+	return acc, ok
+}
+
+//---------------------------------------------
+func (s *MemoryStore) FindByUdid(udid string) (*Account, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	acc, ok := s.by_udid[udid]
+	return acc, ok
+}
+
+//---------------------------------------------
+func (s *MemoryStore) FindByCertificate(cert string) (*Account, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	acc, ok := s.by_cert[cert]
+	return acc, ok
+}
+
+//---------------------------------------------
+// 为一个新设备创建游客账号
+// 同一设备的并发登陆可能都在FindByUdid中查不到账号，持锁后再查一次，已存在则返回已有账号
+func (s *MemoryStore) CreateGuest(udid string) (*Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if acc, ok := s.by_udid[udid]; ok && udid != "" {
+		return acc, nil
+	}
+	acc := &Account{Udid: udid}
+	if err := s.func_Add(acc); err != nil {
+		return nil, err
+	}
+	// 写回失败不影响本次登陆，账号仍然保留在内存中
+	if err := s.func_Save(); err != nil {
+		LOG.Error("写回账号文件失败:", err)
+	}
+	return acc, nil
+}
+
+//---------------------------------------------
+// 写回文件
+func (s *MemoryStore) func_Save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := JSON.MarshalIndent(s.accounts, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := IOUTIL.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return OS.Rename(tmp, s.path)
+}
+
+//---------------------------------------------
@@ -0,0 +1,63 @@
+//---------------------------------------------
+package auth
+
+//---------------------------------------------
+/*
+	用户中心签发的登陆票据
+	格式: userid:expire:signature
+	userid:    玩家ID
+	expire:    过期时间(unix秒)
+	signature: HEX(HMAC-SHA256(secret, "userid:expire"))
+*/
+//---------------------------------------------
+import (
+	HMAC "crypto/hmac"
+	SHA256 "crypto/sha256"
+	HEX "encoding/hex"
+	FMT "fmt"
+	STRCONV "strconv"
+	STRINGS "strings"
+	TIME "time"
+)
+
+//---------------------------------------------
+// 签发票据
+func Func_SignTicket(secret []byte, userid int32, expire TIME.Time) string {
+	body := FMT.Sprintf("%v:%v", userid, expire.Unix())
+	return body + ":" + func_Signature(secret, body)
+}
+
+//---------------------------------------------
+// 校验票据，返回票据中的玩家ID
+func Func_VerifyTicket(secret []byte, ticket string) (int32, error) {
+	parts := STRINGS.Split(ticket, ":")
+	if len(parts) != 3 {
+		return 0, ERROR_BAD_CREDENTIAL
+	}
+	body := parts[0] + ":" + parts[1]
+	if !HMAC.Equal([]byte(parts[2]), []byte(func_Signature(secret, body))) {
+		return 0, ERROR_BAD_CREDENTIAL
+	}
+
+	userid, err := STRCONV.ParseInt(parts[0], 10, 32)
+	if err != nil || userid <= 0 {
+		return 0, ERROR_BAD_CREDENTIAL
+	}
+	expire, err := STRCONV.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, ERROR_BAD_CREDENTIAL
+	}
+	if TIME.Now().Unix() > expire {
+		return 0, ERROR_TOKEN_EXPIRED
+	}
+	return int32(userid), nil
+}
+
+//---------------------------------------------
+func func_Signature(secret []byte, body string) string {
+	mac := HMAC.New(SHA256.New, secret)
+	mac.Write([]byte(body))
+	return HEX.EncodeToString(mac.Sum(nil))
+}
+
+//---------------------------------------------
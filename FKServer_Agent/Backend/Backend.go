@@ -0,0 +1,228 @@
+//---------------------------------------------
+package backend
+
+//---------------------------------------------
+import (
+	FMT "fmt"
+	OS "os"
+	STRINGS "strings"
+	SYNC "sync"
+
+	UTILS "FKGoServer/FKLib_Common/Utils"
+	FANOUT "FKGoServer/FKServer_Agent/Fanout"
+	ROUTE "FKGoServer/FKServer_Agent/Route"
+	SELECTOR "FKGoServer/FKServer_Agent/Selector"
+
+	LOG "github.com/Sirupsen/logrus"
+	CLI "gopkg.in/urfave/cli.v2"
+)
+
+//---------------------------------------------
+const (
+	DEFAULT_GAME_SERVICE = "game-10000" // 游戏服的默认服务名，见 --game-service
+	DEFAULT_ROUTE_BEGIN  = 1001         // 未设置 --route 时转发到游戏服的协议区间
+	DEFAULT_ROUTE_END    = 32767        //
+)
+
+//---------------------------------------------
+// 游戏服集合
+type game_pool struct {
+	service  string            // 游戏服在etcd中的服务名，例如 game-10000
+	selector SELECTOR.Selector // 选服策略
+}
+
+//---------------------------------------------
+// 一个Agent的后端服务: 游戏服选服、协议路由，以及到每台游戏服的控制流
+// 同一进程中的多个Agent各自创建，互不影响；在线表、Agent登记与客户端版本策略在进程内共享
+type Backend struct {
+	dialer  Dialer         // 服务发现与连接
+	pool    game_pool      // 游戏服集合
+	routes  route_pool     // 协议路由
+	control control_pool   // 到每台游戏服的控制流
+	fanout  *FANOUT.Fanout // 控制流上的广播、组播帧在本Agent内的分发
+}
+
+var (
+	once SYNC.Once
+)
+
+//---------------------------------------------
+// 按命令行参数初始化进程内共享的部分，Backend实例由Agent按自己的配置创建
+func InitWithCliContext(c *CLI.Context) {
+	once.Do(func() {
+		func_InitPresence(c.String("presence"), c.String("presence-key"))
+		func_InitRegister(c.String("register-key"), c.String("register-addr"))
+		func_InitVersion(c.String("client-version"), c.String("client-update-url"), c.StringSlice("client-feature"), c.String("client-version-key"))
+	})
+}
+
+//---------------------------------------------
+// 不依赖etcd的初始化，使用memory在线表，不登记Agent
+// 供嵌入Agent与端到端测试使用，客户端版本策略见VERSION.Func_SetPolicy
+func Init() {
+	once.Do(func() {
+		func_InitPresence("memory", "")
+	})
+}
+
+//---------------------------------------------
+// 创建后端服务，d为nil时使用etcd服务发现
+// routes为空时全部游戏协议转发到service，route_key不为空时从etcd读取并监视路由表
+func NewBackend(d Dialer, service, strategy, fixed_id string, routes []string, route_key string) (*Backend, error) {
+	if d == nil {
+		d = etcd_dialer{}
+	}
+	if len(routes) == 0 {
+		routes = func_DefaultRoutes(service)
+	}
+	b := &Backend{dialer: d}
+	if err := b.pool.init(service, strategy, fixed_id); err != nil {
+		return nil, err
+	}
+	if err := b.routes.init(d, routes, route_key); err != nil {
+		return nil, err
+	}
+	b.fanout = FANOUT.NewFanout(b)
+
+	// 游戏服增加或移除时，重建选服策略
+	func_WatchService(d, service, b.pool.selector)
+	// 到每台游戏服的控制流，接收广播与组播
+	b.control.init(d, service, b.fanout)
+	return b, nil
+}
+
+//---------------------------------------------
+// 关闭到游戏服的控制流，不再重连，在Agent的全部会话结束后调用
+func (b *Backend) Close() {
+	b.control.close()
+}
+
+//---------------------------------------------
+// 未设置路由表时，全部游戏协议转发到游戏服
+func func_DefaultRoutes(service string) []string {
+	return []string{FMT.Sprintf("%v-%v:%v", DEFAULT_ROUTE_BEGIN, DEFAULT_ROUTE_END, service)}
+}
+
+//---------------------------------------------
+// 命令行参数中的路由表，未设置 --route 时全部游戏协议转发到 --game-service
+func func_CliRoutes(c *CLI.Context) []string {
+	if routes := c.StringSlice("route"); len(routes) > 0 {
+		return routes
+	}
+	return func_DefaultRoutes(c.String("game-service"))
+}
+
+//---------------------------------------------
+// 需要服务发现的后端服务: --services 加上游戏服与路由表中的全部服务
+// --services 为空表示发现全部服务，保持为空
+// 通过 --route-key 在运行时新增的服务不在其中，需要同时加入 --services
+func Func_DiscoveryServices(c *CLI.Context) []string {
+	services := c.StringSlice("services")
+	if len(services) == 0 {
+		return nil
+	}
+	names := []string{c.String("game-service")}
+	if table, err := ROUTE.Parse(STRINGS.Join(func_CliRoutes(c), ",")); err == nil {
+		names = append(names, table.Services()...)
+	}
+	for _, name := range names {
+		found := false
+		for _, s := range services {
+			if STRINGS.TrimSpace(s) == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			services = append(services, name)
+		}
+	}
+	return services
+}
+
+//---------------------------------------------
+// 本Agent的标识
+func Func_AgentId() string {
+	host, _ := OS.Hostname()
+	return FMT.Sprintf("%v-%v", host, OS.Getpid())
+}
+
+//---------------------------------------------
+func (p *game_pool) init(service, strategy, fixed_id string) error {
+	p.service = service
+	p.selector = SELECTOR.NewSelector(strategy, fixed_id)
+	if p.selector == nil {
+		return FMT.Errorf("unknown game select strategy: %v", strategy)
+	}
+	LOG.Println("游戏服选服策略:", strategy)
+	return nil
+}
+
+//---------------------------------------------
+// 服务实例增加或移除时，更新对应的选取策略
+func func_WatchService(d Dialer, service string, selector SELECTOR.Selector) {
+	ch := make(chan string, 16)
+	go func_Watcher(d, service, selector, ch)
+	d.Watch(service, ch)
+}
+
+//---------------------------------------------
+// 监视服务变化
+func func_Watcher(d Dialer, service string, selector SELECTOR.Selector, ch chan string) {
+	defer UTILS.Func_PrintPanicStack()
+	for key := range ch {
+		ids := d.Ids(service)
+		selector.Update(ids)
+		LOG.Println("服务列表变化:", key, "当前可用实例:", ids)
+	}
+}
+
+//---------------------------------------------
+func (p *game_pool) select_game(userid int32) string {
+	id := p.selector.Select(userid)
+	if id == "" {
+		return ""
+	}
+	p.acquire_game(id)
+	return id
+}
+
+//---------------------------------------------
+func (p *game_pool) acquire_game(id string) {
+	if t, ok := p.selector.(SELECTOR.Tracker); ok {
+		t.Acquire(id)
+	}
+}
+
+//---------------------------------------------
+func (p *game_pool) release_game(id string) {
+	if t, ok := p.selector.(SELECTOR.Tracker); ok {
+		t.Release(id)
+	}
+}
+
+//---------------------------------------------
+// 游戏服的服务名
+func (b *Backend) GameService() string {
+	return b.pool.service
+}
+
+//---------------------------------------------
+// 为玩家选取一台游戏服，返回游戏服ID
+func (b *Backend) SelectGame(userid int32) string {
+	return b.pool.select_game(userid)
+}
+
+//---------------------------------------------
+// 玩家进入游戏服，SelectGame已经包含该过程
+func (b *Backend) AcquireGame(id string) {
+	b.pool.acquire_game(id)
+}
+
+//---------------------------------------------
+// 玩家离开游戏服
+func (b *Backend) ReleaseGame(id string) {
+	b.pool.release_game(id)
+}
+
+//---------------------------------------------
@@ -0,0 +1,137 @@
+//---------------------------------------------
+package backend
+
+//---------------------------------------------
+import (
+	FMT "fmt"
+	SYNC "sync"
+	ATOMIC "sync/atomic"
+	TIME "time"
+
+	UTILS "FKGoServer/FKLib_Common/Utils"
+	FANOUT "FKGoServer/FKServer_Agent/Fanout"
+	PROTO "FKGoServer/FKServer_Agent/Proto"
+
+	LOG "github.com/Sirupsen/logrus"
+	CONTEXT "golang.org/x/net/context"
+	METADATA "google.golang.org/grpc/metadata"
+)
+
+//---------------------------------------------
+const (
+	CONTROL_RETRY_INTERVAL = 3 * TIME.Second // 控制流中断后的重连间隔
+)
+
+//---------------------------------------------
+// Agent到每台游戏服的控制流
+// 游戏服的广播、组播帧只在控制流上发送一次，由Agent在本地分发，见FKServer_Agent/Fanout
+type control_pool struct {
+	dialer  Dialer
+	fanout  *FANOUT.Fanout
+	service string          // 游戏服在etcd中的服务名
+	agent   string          // 本Agent的标识
+	streams map[string]bool // 已建立控制流的游戏服ID
+	ctx     CONTEXT.Context // 取消时关闭全部控制流
+	cancel  CONTEXT.CancelFunc
+	SYNC.Mutex
+}
+
+var (
+	_control_count int32 // 进程中已创建的控制流集合
+)
+
+//---------------------------------------------
+func (p *control_pool) init(d Dialer, service string, fanout *FANOUT.Fanout) {
+	p.dialer = d
+	p.fanout = fanout
+	p.service = service
+	p.streams = make(map[string]bool)
+	p.ctx, p.cancel = CONTEXT.WithCancel(CONTEXT.Background())
+	// 游戏服按标识区分Agent，同一进程中的其余Agent加上序号
+	p.agent = Func_AgentId()
+	if n := ATOMIC.AddInt32(&_control_count, 1); n > 1 {
+		p.agent = FMT.Sprintf("%v-%v", p.agent, n)
+	}
+
+	// 游戏服增加时建立控制流
+	ch := make(chan string, 16)
+	go p.watcher(ch)
+	d.Watch(service, ch)
+	p.sync()
+}
+
+//---------------------------------------------
+func (p *control_pool) close() {
+	p.cancel()
+}
+
+//---------------------------------------------
+func (p *control_pool) watcher(ch chan string) {
+	defer UTILS.Func_PrintPanicStack()
+	for range ch {
+		p.sync()
+	}
+}
+
+//---------------------------------------------
+// 为尚未建立控制流的游戏服建立控制流
+func (p *control_pool) sync() {
+	if p.ctx.Err() != nil {
+		return
+	}
+	for _, id := range p.dialer.Ids(p.service) {
+		p.Lock()
+		opened := p.streams[id]
+		p.streams[id] = true
+		p.Unlock()
+		if !opened {
+			go p.run(id)
+		}
+	}
+}
+
+//---------------------------------------------
+// 控制流协程，中断后游戏服仍然存在时重连
+func (p *control_pool) run(id string) {
+	defer UTILS.Func_PrintPanicStack()
+	if err := p.serve(id); err != nil {
+		LOG.Warningf("游戏服控制流中断 游戏服:%v 错误原因:%v", id, err)
+	}
+	p.fanout.ResetGame(id)
+
+	p.Lock()
+	delete(p.streams, id)
+	p.Unlock()
+
+	select {
+	case <-TIME.After(CONTROL_RETRY_INTERVAL):
+		p.sync()
+	case <-p.ctx.Done():
+	}
+}
+
+//---------------------------------------------
+// 建立控制流并分发收到的帧，直到控制流关闭
+func (p *control_pool) serve(id string) error {
+	conn := p.dialer.Dial(p.service, id)
+	if conn == nil {
+		return ERROR_SERVICE_NOT_FOUND
+	}
+	cli := PROTO.NewGameServiceClient(conn)
+	ctx := METADATA.NewContext(p.ctx, METADATA.New(map[string]string{"agent": p.agent}))
+	stream, err := cli.Stream(ctx)
+	if err != nil {
+		return err
+	}
+	LOG.Infof("已建立游戏服控制流 游戏服:%v", id)
+
+	for {
+		frame, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		p.fanout.Dispatch(id, frame)
+	}
+}
+
+//---------------------------------------------
@@ -0,0 +1,36 @@
+//---------------------------------------------
+package backend
+
+//---------------------------------------------
+import (
+	SERVICES "FKGoServer/FKLib_Common/Service"
+
+	GRPC "google.golang.org/grpc"
+)
+
+//---------------------------------------------
+// 后端服务的发现与连接
+// 默认使用etcd服务发现(FKLib_Common/Service)，嵌入Agent或端到端测试时可以替换为进程内的服务实例
+// 每个Backend实例使用自己的Dialer，见NewBackend
+type Dialer interface {
+	Ids(service string) []string              // 服务当前全部的实例ID
+	Dial(service, id string) *GRPC.ClientConn // 到服务实例的连接，实例不存在时返回nil
+	Watch(service string, ch chan string)     // 注册后为已有实例各通知一次，之后实例增加或移除时通知
+}
+
+//---------------------------------------------
+type etcd_dialer struct{}
+
+func (etcd_dialer) Ids(service string) []string {
+	return SERVICES.GetServiceIds(service)
+}
+
+func (etcd_dialer) Dial(service, id string) *GRPC.ClientConn {
+	return SERVICES.GetServiceWithId(service, id)
+}
+
+func (etcd_dialer) Watch(service string, ch chan string) {
+	SERVICES.RegisterCallback(service, ch)
+}
+
+//---------------------------------------------
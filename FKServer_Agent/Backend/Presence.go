@@ -0,0 +1,156 @@
+//---------------------------------------------
+package backend
+
+//---------------------------------------------
+import (
+	FMT "fmt"
+	PATH "path"
+	STRCONV "strconv"
+	TIME "time"
+
+	ETCDCLIENT "FKGoServer/FKLib_Common/ETCDClient"
+	UTILS "FKGoServer/FKLib_Common/Utils"
+	PRESENCE "FKGoServer/FKServer_Agent/Presence"
+	SESSION "FKGoServer/FKServer_Agent/Session"
+
+	LOG "github.com/Sirupsen/logrus"
+	ETCD "github.com/coreos/etcd/client"
+	CONTEXT "golang.org/x/net/context"
+)
+
+//---------------------------------------------
+const (
+	PRESENCE_TIMEOUT = 3 * TIME.Second // 读写etcd在线表的超时
+)
+
+//---------------------------------------------
+var (
+	_default_presence PRESENCE.Registry
+)
+
+//---------------------------------------------
+// 玩家在线表，见 --presence
+// memory: 只发现同一Agent上的重复登陆
+// etcd:   以 --presence-key/userid 记录玩家所在的owner，全部Agent监视该目录
+func func_InitPresence(kind, root string) {
+	switch kind {
+	case "memory":
+		_default_presence = PRESENCE.NewMemory()
+	case "etcd":
+		_default_presence = &etcd_presence{root: root}
+	default:
+		LOG.Fatal("未知的在线表类型:", kind)
+	}
+	LOG.Println("玩家在线表:", kind)
+}
+
+//---------------------------------------------
+// 登陆成功的会话登记到在线表，同一玩家之前的登陆(包括其他Agent上的)会收到通知并被踢掉
+// 登记失败时只记录日志，不影响登陆
+func Func_ClaimUser(sess *SESSION.Session) {
+	sess.Owner = PRESENCE.Func_NewOwner(Func_AgentId())
+	prev, err := _default_presence.Claim(sess.UserId, sess.Owner)
+	if err != nil {
+		LOG.Warningf("登记在线表失败 userid:%v 错误原因:%v", sess.UserId, err)
+		return
+	}
+	if prev != "" {
+		LOG.Infof("玩家重复登陆，踢掉旧会话 userid:%v 旧会话:%v 新会话:%v", sess.UserId, prev, sess.Owner)
+	}
+}
+
+//---------------------------------------------
+// 会话结束时移出在线表
+func Func_ReleaseUser(sess *SESSION.Session) {
+	if sess.Owner == "" {
+		return
+	}
+	if err := _default_presence.Release(sess.UserId, sess.Owner); err != nil {
+		LOG.Warningf("移出在线表失败 userid:%v 错误原因:%v", sess.UserId, err)
+	}
+}
+
+//---------------------------------------------
+// 本Agent上被其他登陆覆盖的会话
+func Func_Evictions() <-chan PRESENCE.Eviction {
+	return _default_presence.Watch(Func_AgentId())
+}
+
+//---------------------------------------------
+// etcd中的在线表
+// Agent异常退出时遗留的记录会在玩家下次登陆时被覆盖
+type etcd_presence struct {
+	root string
+}
+
+//---------------------------------------------
+func (p *etcd_presence) key(userid int32) string {
+	return FMT.Sprintf("%v/%v", p.root, userid)
+}
+
+//---------------------------------------------
+func (p *etcd_presence) Claim(userid int32, owner string) (string, error) {
+	ctx, cancel := CONTEXT.WithTimeout(CONTEXT.Background(), PRESENCE_TIMEOUT)
+	defer cancel()
+	resp, err := ETCDCLIENT.KeysAPI().Set(ctx, p.key(userid), owner, nil)
+	if err != nil {
+		return "", err
+	}
+	if resp.PrevNode != nil {
+		return resp.PrevNode.Value, nil
+	}
+	return "", nil
+}
+
+//---------------------------------------------
+func (p *etcd_presence) Release(userid int32, owner string) error {
+	ctx, cancel := CONTEXT.WithTimeout(CONTEXT.Background(), PRESENCE_TIMEOUT)
+	defer cancel()
+	_, err := ETCDCLIENT.KeysAPI().Delete(ctx, p.key(userid), &ETCD.DeleteOptions{PrevValue: owner})
+	// 已被新的登陆覆盖
+	if e, ok := err.(ETCD.Error); ok && (e.Code == ETCD.ErrorCodeTestFailed || e.Code == ETCD.ErrorCodeKeyNotFound) {
+		return nil
+	}
+	return err
+}
+
+//---------------------------------------------
+func (p *etcd_presence) Watch(agent string) <-chan PRESENCE.Eviction {
+	ch := make(chan PRESENCE.Eviction, PRESENCE.DEFAULT_EVICTION_QUEUE)
+	go p.watcher(agent, ch)
+	return ch
+}
+
+//---------------------------------------------
+// 监视在线表，原owner属于本Agent的记录被覆盖时通知
+func (p *etcd_presence) watcher(agent string, ch chan PRESENCE.Eviction) {
+	defer UTILS.Func_PrintPanicStack()
+	w := ETCDCLIENT.KeysAPI().Watcher(p.root, ETCDCLIENT.NewWatcherOptions(true))
+	for {
+		resp, err := w.Next(CONTEXT.Background())
+		if err != nil {
+			LOG.Println(err)
+			TIME.Sleep(TIME.Second)
+			continue
+		}
+		switch resp.Action {
+		case "set", "update", "compareAndSwap":
+		default:
+			continue
+		}
+		if resp.PrevNode == nil || resp.PrevNode.Value == resp.Node.Value || PRESENCE.Func_AgentOf(resp.PrevNode.Value) != agent {
+			continue
+		}
+		userid, err := STRCONV.ParseInt(PATH.Base(resp.Node.Key), 10, 32)
+		if err != nil {
+			continue
+		}
+		select {
+		case ch <- PRESENCE.Eviction{UserId: int32(userid), Owner: resp.PrevNode.Value, By: resp.Node.Value}:
+		default:
+			LOG.Warningf("重复登陆通知队列已满 userid:%v owner:%v", userid, resp.PrevNode.Value)
+		}
+	}
+}
+
+//---------------------------------------------
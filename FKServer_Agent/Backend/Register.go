@@ -0,0 +1,110 @@
+//---------------------------------------------
+package backend
+
+//---------------------------------------------
+import (
+	NET "net"
+	OS "os"
+	SYNC "sync"
+	TIME "time"
+
+	ETCDCLIENT "FKGoServer/FKLib_Common/ETCDClient"
+	UTILS "FKGoServer/FKLib_Common/Utils"
+
+	LOG "github.com/Sirupsen/logrus"
+	ETCD "github.com/coreos/etcd/client"
+	CONTEXT "golang.org/x/net/context"
+)
+
+//---------------------------------------------
+const (
+	REGISTER_TTL      = 15 * TIME.Second // 登记的过期时间，Agent异常退出后自动移除
+	REGISTER_INTERVAL = 5 * TIME.Second  // 刷新登记的间隔
+)
+
+//---------------------------------------------
+// 把本Agent的对外地址登记到etcd，供登陆服或负载均衡发现，见 --register-key
+// 记录为 --register-key/Agent标识 = 地址，定期刷新，排空时移除
+type agent_register struct {
+	key  string
+	addr string
+	die  chan struct{}
+	once SYNC.Once
+	mu   SYNC.Mutex // 保证移除之后不会再刷新
+}
+
+var (
+	_default_register agent_register
+)
+
+//---------------------------------------------
+// root为空时不登记；addr未指定主机时使用本机名
+func func_InitRegister(root, addr string) {
+	if root == "" {
+		return
+	}
+	if host, port, err := NET.SplitHostPort(addr); err == nil && host == "" {
+		host, _ = OS.Hostname()
+		addr = NET.JoinHostPort(host, port)
+	}
+	p := &_default_register
+	p.key = root + "/" + Func_AgentId()
+	p.addr = addr
+	p.die = make(chan struct{})
+	go p.refresher()
+	LOG.Println("Agent登记到服务发现:", p.key, p.addr)
+}
+
+//---------------------------------------------
+func (p *agent_register) refresher() {
+	defer UTILS.Func_PrintPanicStack()
+	ticker := TIME.NewTicker(REGISTER_INTERVAL)
+	defer ticker.Stop()
+	for {
+		p.refresh()
+		select {
+		case <-ticker.C:
+		case <-p.die:
+			return
+		}
+	}
+}
+
+//---------------------------------------------
+func (p *agent_register) refresh() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.die:
+		return
+	default:
+	}
+	ctx, cancel := CONTEXT.WithTimeout(CONTEXT.Background(), REGISTER_INTERVAL)
+	defer cancel()
+	if _, err := ETCDCLIENT.KeysAPI().Set(ctx, p.key, p.addr, &ETCD.SetOptions{TTL: REGISTER_TTL}); err != nil {
+		LOG.Warning("登记Agent失败:", err)
+	}
+}
+
+//---------------------------------------------
+// 从服务发现中移除本Agent，不再分配新的客户端
+func Func_DeregisterAgent() {
+	p := &_default_register
+	if p.die == nil {
+		return
+	}
+	p.once.Do(func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		close(p.die)
+		ctx, cancel := CONTEXT.WithTimeout(CONTEXT.Background(), REGISTER_INTERVAL)
+		defer cancel()
+		if _, err := ETCDCLIENT.KeysAPI().Delete(ctx, p.key, nil); err != nil {
+			LOG.Warning("移除Agent登记失败:", err)
+			return
+		}
+		LOG.Println("已从服务发现中移除:", p.key)
+	})
+}
+
+//---------------------------------------------
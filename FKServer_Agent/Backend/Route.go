@@ -0,0 +1,124 @@
+//---------------------------------------------
+package backend
+
+//---------------------------------------------
+import (
+	STRINGS "strings"
+	SYNC "sync"
+	ATOMIC "sync/atomic"
+	TIME "time"
+
+	ETCDCLIENT "FKGoServer/FKLib_Common/ETCDClient"
+	UTILS "FKGoServer/FKLib_Common/Utils"
+	PROTO "FKGoServer/FKServer_Agent/Proto"
+	ROUTE "FKGoServer/FKServer_Agent/Route"
+	SELECTOR "FKGoServer/FKServer_Agent/Selector"
+	SESSION "FKGoServer/FKServer_Agent/Session"
+
+	LOG "github.com/Sirupsen/logrus"
+	CONTEXT "golang.org/x/net/context"
+)
+
+//---------------------------------------------
+// 协议号路由
+// 路由表来自命令行参数 --route，设置了 --route-key 时改为从etcd读取并监视该key，修改后立即生效
+// 游戏服以外的后端服务同样实现GameService的Stream接口，每个会话按UserId一致性HASH选取实例
+type route_pool struct {
+	dialer    Dialer
+	table     ATOMIC.Value                 // *ROUTE.Table
+	selectors map[string]SELECTOR.Selector // 服务名 -> 实例选取策略
+	mu        SYNC.Mutex
+}
+
+//---------------------------------------------
+func (p *route_pool) init(d Dialer, rules []string, key string) error {
+	p.dialer = d
+	p.selectors = make(map[string]SELECTOR.Selector)
+
+	table, err := ROUTE.Parse(STRINGS.Join(rules, ","))
+	if err != nil {
+		return err
+	}
+	p.table.Store(table)
+
+	if key != "" {
+		kAPI := ETCDCLIENT.KeysAPI()
+		if resp, err := kAPI.Get(CONTEXT.Background(), key, nil); err != nil {
+			LOG.Warning("读取etcd路由表失败，使用命令行路由表:", err)
+		} else {
+			p.load(resp.Node.Value)
+		}
+		go p.watcher(key)
+	}
+	LOG.Println("协议路由表:", p.get_table())
+	return nil
+}
+
+//---------------------------------------------
+// 加载路由表，格式错误时保留原路由表
+func (p *route_pool) load(spec string) {
+	table, err := ROUTE.Parse(spec)
+	if err != nil {
+		LOG.Error("路由表错误，保留原路由表:", err)
+		return
+	}
+	p.table.Store(table)
+	LOG.Println("更新协议路由表:", table)
+}
+
+//---------------------------------------------
+// 监视etcd中的路由表
+func (p *route_pool) watcher(key string) {
+	defer UTILS.Func_PrintPanicStack()
+	w := ETCDCLIENT.KeysAPI().Watcher(key, ETCDCLIENT.NewWatcherOptions(false))
+	for {
+		resp, err := w.Next(CONTEXT.Background())
+		if err != nil {
+			LOG.Println(err)
+			TIME.Sleep(TIME.Second)
+			continue
+		}
+		switch resp.Action {
+		case "set", "create", "update", "compareAndSwap":
+			p.load(resp.Node.Value)
+		}
+	}
+}
+
+//---------------------------------------------
+func (p *route_pool) get_table() *ROUTE.Table {
+	return p.table.Load().(*ROUTE.Table)
+}
+
+//---------------------------------------------
+// 获取服务的实例选取策略，首次使用时创建并开始监视该服务
+func (p *route_pool) selector(service string) SELECTOR.Selector {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if s := p.selectors[service]; s != nil {
+		return s
+	}
+	s := SELECTOR.NewHashSelector(SELECTOR.DEFAULT_VIRTUAL_NODES)
+	s.Update(p.dialer.Ids(service))
+	p.selectors[service] = s
+	func_WatchService(p.dialer, service, s)
+	return s
+}
+
+//---------------------------------------------
+// 查询协议号对应的后端服务名，由Agent自己处理的协议返回空
+func (b *Backend) Route(proto int16) string {
+	return b.routes.get_table().Lookup(proto)
+}
+
+//---------------------------------------------
+// 为会话开启一条到指定后端服务的流
+func (b *Backend) OpenServiceStream(sess *SESSION.Session, service string) (PROTO.GameService_StreamClient, error) {
+	id := b.routes.selector(service).Select(sess.UserId)
+	if id == "" {
+		return nil, ERROR_SERVICE_NOT_FOUND
+	}
+	return b.open_stream(sess, service, id)
+}
+
+//---------------------------------------------
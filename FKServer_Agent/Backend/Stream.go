@@ -0,0 +1,160 @@
+//---------------------------------------------
+package backend
+
+//---------------------------------------------
+import (
+	ERRORS "errors"
+	FMT "fmt"
+	IO "io"
+	SORT "sort"
+
+	UTILS "FKGoServer/FKLib_Common/Utils"
+	PROTO "FKGoServer/FKServer_Agent/Proto"
+	SESSION "FKGoServer/FKServer_Agent/Session"
+
+	LOG "github.com/Sirupsen/logrus"
+	CONTEXT "golang.org/x/net/context"
+	METADATA "google.golang.org/grpc/metadata"
+)
+
+//---------------------------------------------
+var (
+	ERROR_SERVICE_NOT_FOUND = ERRORS.New("service not found")
+)
+
+//---------------------------------------------
+// 开启流时注册给游戏服的元数据
+// version为协商后的客户端协议版本，游戏服据此区分客户端支持的功能
+func func_Metadata(sess *SESSION.Session) METADATA.MD {
+	return METADATA.New(map[string]string{"userid": FMT.Sprint(sess.UserId), "version": FMT.Sprint(sess.Version)})
+}
+
+//---------------------------------------------
+// 开启一条到指定游戏服的流，并启动读取协程
+// 读取到的消息统一投递到sess.MQ，由会话协程处理
+func (b *Backend) OpenGameStream(sess *SESSION.Session, gsid string) (PROTO.GameService_StreamClient, error) {
+	return b.open_stream(sess, b.pool.service, gsid)
+}
+
+//---------------------------------------------
+// 开启一条到指定服务实例的流
+func (b *Backend) open_stream(sess *SESSION.Session, service, id string) (PROTO.GameService_StreamClient, error) {
+	stream, err := b.dial_stream(sess, service, id)
+	if err != nil {
+		return nil, err
+	}
+	go func_FetcherTask(sess, stream)
+	return stream, nil
+}
+
+//---------------------------------------------
+// 开启流，不启动读取协程
+func (b *Backend) dial_stream(sess *SESSION.Session, service, id string) (PROTO.GameService_StreamClient, error) {
+	conn := b.dialer.Dial(service, id)
+	if conn == nil {
+		return nil, ERROR_SERVICE_NOT_FOUND
+	}
+	cli := PROTO.NewGameServiceClient(conn)
+
+	ctx := METADATA.NewContext(CONTEXT.Background(), func_Metadata(sess))
+	return cli.Stream(ctx)
+}
+
+//---------------------------------------------
+// 开启一条到指定游戏服的流，但不启动读取协程，供会话协程以外的协程使用(例如故障转移的重连)
+// 会话协程接手该流后调用Func_FetchStream开始读取，避免流中断的通知早于会话接手
+func (b *Backend) DialGameStream(sess *SESSION.Session, gsid string) (PROTO.GameService_StreamClient, error) {
+	return b.dial_stream(sess, b.pool.service, gsid)
+}
+
+//---------------------------------------------
+// 启动流的读取协程
+func Func_FetchStream(sess *SESSION.Session, stream PROTO.GameService_StreamClient) {
+	go func_FetcherTask(sess, stream)
+}
+
+//---------------------------------------------
+// 读取GAME返回消息的goroutine
+// 每条流对应一个读取协程，流被切换后旧流由游戏服关闭，协程随之退出
+func func_FetcherTask(sess *SESSION.Session, stream PROTO.GameService_StreamClient) {
+	defer UTILS.Func_PrintPanicStack()
+	for {
+		in, err := stream.Recv()
+		if err == IO.EOF { // 流关闭
+			LOG.Debug(err)
+			return
+		}
+		if err != nil { // 后端服务异常，通知会话协程进行故障转移
+			LOG.Error(err)
+			Func_NotifyStreamLost(sess, stream)
+			return
+		}
+		select {
+		case sess.MQ <- SESSION.Frame{Game_Frame: *in, Stream: stream}:
+		case <-sess.Die:
+			return
+		}
+	}
+}
+
+//---------------------------------------------
+// 通知会话协程流已经中断，会话结束时放弃
+// 会话协程自身发现中断(例如发送失败)时须在新协程中调用，避免阻塞在自己的通知上
+func Func_NotifyStreamLost(sess *SESSION.Session, stream PROTO.GameService_StreamClient) {
+	select {
+	case sess.GameLost <- stream:
+	case <-sess.Die:
+	}
+}
+
+//---------------------------------------------
+// 为玩家重新选取一台游戏服，尽量避开已经失效的游戏服
+// 选服策略尚未感知游戏服下线时(例如etcd中的key还未过期)，从其余游戏服中固定选取一台
+func (b *Backend) SelectGameExcept(userid int32, exclude string) string {
+	id := b.pool.selector.Select(userid)
+	if id != "" && id != exclude {
+		b.pool.acquire_game(id)
+		return id
+	}
+
+	var ids []string
+	for _, v := range b.dialer.Ids(b.pool.service) {
+		if v != exclude {
+			ids = append(ids, v)
+		}
+	}
+	if len(ids) == 0 {
+		return ""
+	}
+	SORT.Strings(ids)
+	id = ids[int(uint32(userid)%uint32(len(ids)))]
+	b.pool.acquire_game(id)
+	return id
+}
+
+//---------------------------------------------
+// 将会话切换到另一台游戏服
+// 必须在会话协程中调用，新流建立成功后才替换sess.Stream，失败时保持原流不变
+func (b *Backend) SwitchGameStream(sess *SESSION.Session, gsid string) error {
+	if gsid == sess.GSID {
+		return nil
+	}
+	stream, err := b.OpenGameStream(sess, gsid)
+	if err != nil {
+		return err
+	}
+	b.AcquireGame(gsid)
+
+	old_gsid, old_stream := sess.GSID, sess.Stream
+	sess.GSID, sess.Stream = gsid, stream
+	if old_stream != nil {
+		old_stream.CloseSend()
+	}
+	if old_gsid != "" {
+		b.ReleaseGame(old_gsid)
+	}
+	LOG.Infof("玩家切换游戏服 userid:%v %v -> %v", sess.UserId, old_gsid, gsid)
+	return nil
+}
+
+//---------------------------------------------
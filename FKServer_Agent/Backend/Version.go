@@ -0,0 +1,70 @@
+//---------------------------------------------
+package backend
+
+//---------------------------------------------
+import (
+	TIME "time"
+
+	ETCDCLIENT "FKGoServer/FKLib_Common/ETCDClient"
+	UTILS "FKGoServer/FKLib_Common/Utils"
+	VERSION "FKGoServer/FKServer_Agent/Version"
+
+	LOG "github.com/Sirupsen/logrus"
+	CONTEXT "golang.org/x/net/context"
+)
+
+//---------------------------------------------
+// 客户端协议版本策略
+// 策略来自命令行参数 --client-version，设置了 --client-version-key 时改为从etcd读取并监视该key，修改后立即生效
+// 已经协商过版本的会话不受影响，见FKServer_Agent/Version
+func func_InitVersion(spec, url string, features []string, key string) {
+	policy, err := VERSION.NewPolicy(spec, url, features)
+	if err != nil {
+		LOG.Fatal("客户端版本策略错误:", err)
+	}
+	VERSION.Func_SetPolicy(policy)
+
+	if key != "" {
+		kAPI := ETCDCLIENT.KeysAPI()
+		if resp, err := kAPI.Get(CONTEXT.Background(), key, nil); err != nil {
+			LOG.Warning("读取etcd客户端版本策略失败，使用命令行参数:", err)
+		} else {
+			func_LoadVersion(resp.Node.Value)
+		}
+		go func_VersionWatcher(key)
+	}
+	LOG.Println("客户端版本策略:", VERSION.Func_Policy())
+}
+
+//---------------------------------------------
+// 加载版本策略，格式错误时保留原策略
+func func_LoadVersion(data string) {
+	policy, err := VERSION.ParsePolicy(data)
+	if err != nil {
+		LOG.Error("客户端版本策略错误，保留原策略:", err)
+		return
+	}
+	VERSION.Func_SetPolicy(policy)
+	LOG.Println("更新客户端版本策略:", policy)
+}
+
+//---------------------------------------------
+// 监视etcd中的版本策略
+func func_VersionWatcher(key string) {
+	defer UTILS.Func_PrintPanicStack()
+	w := ETCDCLIENT.KeysAPI().Watcher(key, ETCDCLIENT.NewWatcherOptions(false))
+	for {
+		resp, err := w.Next(CONTEXT.Background())
+		if err != nil {
+			LOG.Println(err)
+			TIME.Sleep(TIME.Second)
+			continue
+		}
+		switch resp.Action {
+		case "set", "create", "update", "compareAndSwap":
+			func_LoadVersion(resp.Node.Value)
+		}
+	}
+}
+
+//---------------------------------------------
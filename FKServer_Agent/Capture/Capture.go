@@ -0,0 +1,144 @@
+//---------------------------------------------
+package capture
+
+//---------------------------------------------
+/*
+	按玩家的抓包，用于排查问题，默认关闭
+	--capture-dir 指定抓包文件目录，为空则不抓包
+	--capture-users 指定需要抓包的玩家，运维接口 /admin/capture 可以动态增删
+	--capture-sample 按比例随机抓包，0表示不采样
+	玩家登陆成功时决定是否抓包，每个会话一个文件: 目录/userid-时间.cap
+	文件中是解密后的收发数据包，可以通过 FKTools_Simulate 的回放模式重新发给游戏服
+*/
+//---------------------------------------------
+import (
+	FMT "fmt"
+	RAND "math/rand"
+	OS "os"
+	FILEPATH "path/filepath"
+	SORT "sort"
+	SYNC "sync"
+	TIME "time"
+
+	LOG "github.com/Sirupsen/logrus"
+	CLI "gopkg.in/urfave/cli.v2"
+)
+
+//---------------------------------------------
+type capture_policy struct {
+	dir    string
+	users  map[int32]bool
+	sample float64
+	rand   *RAND.Rand
+	mu     SYNC.Mutex
+}
+
+var (
+	_default_policy capture_policy
+	once            SYNC.Once
+)
+
+//---------------------------------------------
+func InitWithCliContext(c *CLI.Context) {
+	once.Do(func() {
+		Init(c.String("capture-dir"), c.IntSlice("capture-users"), c.Float64("capture-sample"))
+		if _default_policy.dir != "" {
+			if err := OS.MkdirAll(_default_policy.dir, 0755); err != nil {
+				LOG.Fatal(err)
+			}
+			LOG.Println("抓包目录:", _default_policy.dir)
+		}
+	})
+}
+
+//---------------------------------------------
+// 直接指定抓包策略，可重复调用，主要用于测试
+func Init(dir string, users []int, sample float64) {
+	p := &_default_policy
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dir = dir
+	p.users = make(map[int32]bool)
+	for _, id := range users {
+		p.users[int32(id)] = true
+	}
+	p.sample = sample
+	p.rand = RAND.New(RAND.NewSource(TIME.Now().UnixNano()))
+}
+
+//---------------------------------------------
+// 是否开启了抓包
+func Func_Enabled() bool {
+	p := &_default_policy
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dir != ""
+}
+
+//---------------------------------------------
+// 玩家登陆时是否需要抓包
+func Func_ShouldCapture(userid int32) bool {
+	p := &_default_policy
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.dir == "" {
+		return false
+	}
+	if p.users[userid] {
+		return true
+	}
+	return p.sample > 0 && p.rand.Float64() < p.sample
+}
+
+//---------------------------------------------
+// 增删需要抓包的玩家，下次登陆时生效
+func Func_SetUser(userid int32, enable bool) {
+	p := &_default_policy
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.users == nil {
+		p.users = make(map[int32]bool)
+	}
+	if enable {
+		p.users[userid] = true
+	} else {
+		delete(p.users, userid)
+	}
+}
+
+//---------------------------------------------
+// 需要抓包的玩家列表
+func Func_Users() []int32 {
+	p := &_default_policy
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	users := make([]int32, 0, len(p.users))
+	for id := range p.users {
+		users = append(users, id)
+	}
+	SORT.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+	return users
+}
+
+//---------------------------------------------
+// 为玩家创建抓包文件
+func Func_Open(userid int32) (*Writer, error) {
+	p := &_default_policy
+	p.mu.Lock()
+	dir := p.dir
+	p.mu.Unlock()
+
+	name := FMT.Sprintf("%v-%v.cap", userid, TIME.Now().Format("20060102-150405.000000"))
+	f, err := OS.Create(FILEPATH.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+//---------------------------------------------
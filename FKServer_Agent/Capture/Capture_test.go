@@ -0,0 +1,108 @@
+//---------------------------------------------
+package capture
+
+//---------------------------------------------
+import (
+	BYTES "bytes"
+	IO "io"
+	IOUTIL "io/ioutil"
+	OS "os"
+	"testing"
+	TIME "time"
+)
+
+//---------------------------------------------
+func TestFile(t *testing.T) {
+	var buf BYTES.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := TIME.Now()
+	records := []Record{
+		{Time: now, Dir: DIR_IN, UserId: 7, Proto: 1001, Data: []byte{0x03, 0xe9, 1, 2, 3}},
+		{Time: now.Add(TIME.Millisecond), Dir: DIR_OUT, UserId: 7, Proto: 1002, Data: []byte{0x03, 0xea}},
+		{Time: now.Add(TIME.Second), Dir: DIR_IN, UserId: 7, Proto: 0, Data: nil},
+	}
+	for i := range records {
+		if err := w.Write(&records[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	r, err := NewReader(BYTES.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range records {
+		got, err := r.Next()
+		if err != nil {
+			t.Fatal(i, err)
+		}
+		want := &records[i]
+		if !got.Time.Equal(want.Time) || got.Dir != want.Dir || got.UserId != want.UserId ||
+			got.Proto != want.Proto || !BYTES.Equal(got.Data, want.Data) {
+			t.Errorf("record %v got %+v want %+v", i, got, want)
+		}
+	}
+	if _, err := r.Next(); err != IO.EOF {
+		t.Error("expect EOF got", err)
+	}
+
+	// 不完整的记录
+	r, _ = NewReader(BYTES.NewReader(buf.Bytes()[:buf.Len()-1]))
+	r.Next()
+	r.Next()
+	if _, err := r.Next(); err != IO.ErrUnexpectedEOF {
+		t.Error("truncated record got", err)
+	}
+
+	if _, err := NewReader(BYTES.NewReader([]byte("FKCAX\x01"))); err != ERROR_BAD_FILE {
+		t.Error("bad magic got", err)
+	}
+}
+
+//---------------------------------------------
+func TestPolicy(t *testing.T) {
+	Init("", []int{1}, 1)
+	if Func_Enabled() || Func_ShouldCapture(1) {
+		t.Error("empty dir should disable capture")
+	}
+
+	dir, err := IOUTIL.TempDir("", "capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer OS.RemoveAll(dir)
+
+	Init(dir, []int{1}, 0)
+	if !Func_ShouldCapture(1) || Func_ShouldCapture(2) {
+		t.Error("user list not applied")
+	}
+	Func_SetUser(2, true)
+	Func_SetUser(1, false)
+	if users := Func_Users(); len(users) != 1 || users[0] != 2 {
+		t.Error("users got", users)
+	}
+
+	Init(dir, nil, 1)
+	if !Func_ShouldCapture(3) {
+		t.Error("sample 1 should capture everyone")
+	}
+
+	w, err := Func_Open(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(&Record{Time: TIME.Now(), UserId: 3, Proto: 1001, Data: []byte{0x03, 0xe9}})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := IOUTIL.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatal("files got", len(files))
+	}
+}
+
+//---------------------------------------------
@@ -0,0 +1,147 @@
+//---------------------------------------------
+package capture
+
+//---------------------------------------------
+/*
+	抓包文件格式，全部为大端
+	文件头: "FKCAP" | 1B 版本
+	记录:   8B 时间(UnixNano) | 1B 方向 | 4B userid | 2B 协议号 | 4B 长度 | DATA
+	DATA为解密、解压后的明文 PROTO|PAYLOAD，客户端数据包去掉了序号，可以直接重新发送
+*/
+//---------------------------------------------
+import (
+	BUFIO "bufio"
+	BINARY "encoding/binary"
+	ERRORS "errors"
+	IO "io"
+	TIME "time"
+)
+
+//---------------------------------------------
+const (
+	FILE_MAGIC   = "FKCAP"
+	FILE_VERSION = 1
+
+	DIR_IN  = 0 // 客户端发给Agent
+	DIR_OUT = 1 // Agent发给客户端
+
+	RECORD_HEADER_LEN = 19
+	MAX_RECORD_LEN    = 64 << 20 // 读取时允许的最大记录长度
+)
+
+//---------------------------------------------
+var (
+	ERROR_BAD_FILE   = ERRORS.New("bad capture file")
+	ERROR_BAD_RECORD = ERRORS.New("bad capture record")
+)
+
+//---------------------------------------------
+// 一条抓包记录
+type Record struct {
+	Time   TIME.Time
+	Dir    byte
+	UserId int32
+	Proto  int16
+	Data   []byte
+}
+
+//---------------------------------------------
+// 抓包文件写入
+type Writer struct {
+	w      *BUFIO.Writer
+	closer IO.Closer
+	header [RECORD_HEADER_LEN]byte
+}
+
+//---------------------------------------------
+// 写入文件头，w实现了IO.Closer时Close一并关闭
+func NewWriter(w IO.Writer) (*Writer, error) {
+	cw := &Writer{w: BUFIO.NewWriter(w)}
+	cw.closer, _ = w.(IO.Closer)
+	if _, err := cw.w.WriteString(FILE_MAGIC); err != nil {
+		return nil, err
+	}
+	if err := cw.w.WriteByte(FILE_VERSION); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+//---------------------------------------------
+func (cw *Writer) Write(r *Record) error {
+	h := cw.header[:]
+	BINARY.BigEndian.PutUint64(h[0:], uint64(r.Time.UnixNano()))
+	h[8] = r.Dir
+	BINARY.BigEndian.PutUint32(h[9:], uint32(r.UserId))
+	BINARY.BigEndian.PutUint16(h[13:], uint16(r.Proto))
+	BINARY.BigEndian.PutUint32(h[15:], uint32(len(r.Data)))
+	if _, err := cw.w.Write(h); err != nil {
+		return err
+	}
+	_, err := cw.w.Write(r.Data)
+	return err
+}
+
+//---------------------------------------------
+func (cw *Writer) Flush() error {
+	return cw.w.Flush()
+}
+
+//---------------------------------------------
+func (cw *Writer) Close() error {
+	err := cw.w.Flush()
+	if cw.closer != nil {
+		if e := cw.closer.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+//---------------------------------------------
+// 抓包文件读取
+type Reader struct {
+	r      *BUFIO.Reader
+	header [RECORD_HEADER_LEN]byte
+}
+
+//---------------------------------------------
+// 读取并检查文件头
+func NewReader(r IO.Reader) (*Reader, error) {
+	cr := &Reader{r: BUFIO.NewReader(r)}
+	head := make([]byte, len(FILE_MAGIC)+1)
+	if _, err := IO.ReadFull(cr.r, head); err != nil {
+		return nil, ERROR_BAD_FILE
+	}
+	if string(head[:len(FILE_MAGIC)]) != FILE_MAGIC || head[len(FILE_MAGIC)] != FILE_VERSION {
+		return nil, ERROR_BAD_FILE
+	}
+	return cr, nil
+}
+
+//---------------------------------------------
+// 读取下一条记录，文件结束时返回IO.EOF
+// 文件末尾不完整的记录(Agent异常退出)返回IO.ErrUnexpectedEOF
+func (cr *Reader) Next() (*Record, error) {
+	h := cr.header[:]
+	if _, err := IO.ReadFull(cr.r, h); err != nil {
+		return nil, err
+	}
+	size := BINARY.BigEndian.Uint32(h[15:])
+	if size > MAX_RECORD_LEN {
+		return nil, ERROR_BAD_RECORD
+	}
+	r := &Record{
+		Time:   TIME.Unix(0, int64(BINARY.BigEndian.Uint64(h[0:]))),
+		Dir:    h[8],
+		UserId: int32(BINARY.BigEndian.Uint32(h[9:])),
+		Proto:  int16(BINARY.BigEndian.Uint16(h[13:])),
+		Data:   make([]byte, size),
+	}
+	if _, err := IO.ReadFull(cr.r, r.Data); err != nil {
+		return nil, IO.ErrUnexpectedEOF
+	}
+	return r, nil
+}
+
+//---------------------------------------------
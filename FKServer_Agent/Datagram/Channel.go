@@ -0,0 +1,134 @@
+//---------------------------------------------
+package datagram
+
+//---------------------------------------------
+import (
+	AES "crypto/aes"
+	CIPHER "crypto/cipher"
+	RAND "crypto/rand"
+	BINARY "encoding/binary"
+	NET "net"
+	SYNC "sync"
+)
+
+//---------------------------------------------
+const (
+	DIR_IN  = 0 // 客户端发给Agent
+	DIR_OUT = 1 // Agent发给客户端
+
+	ID_LEN     = 8
+	KEY_LEN    = 16
+	HEADER_LEN = ID_LEN + 4 // 通道ID + 序号
+
+	DEFAULT_IN_QUEUE = 64 // 等待会话协程转发的数据报，队列满时丢弃
+)
+
+//---------------------------------------------
+// 绑定到一个已登陆会话的不可靠数据报通道
+// 通道ID与密钥在登陆成功时生成，通过可靠连接(已加密)下发给客户端
+// 每个方向的序号从1开始严格递增，收到的序号不大于已收到的最大序号时丢弃(乱序或重放)
+type Channel struct {
+	Id  uint64
+	Key []byte
+
+	aead CIPHER.AEAD
+	in   chan []byte
+	recv uint32       // 已收到的最大序号
+	send uint32       // 已发送的最大序号
+	addr *NET.UDPAddr // 客户端最近一次发送数据报的地址
+	mu   SYNC.Mutex
+}
+
+//---------------------------------------------
+// 生成随机的通道ID与密钥
+func NewChannel() (*Channel, error) {
+	buf := make([]byte, ID_LEN+KEY_LEN)
+	if _, err := RAND.Read(buf); err != nil {
+		return nil, err
+	}
+	return func_NewChannel(BINARY.BigEndian.Uint64(buf), buf[ID_LEN:])
+}
+
+//---------------------------------------------
+func func_NewChannel(id uint64, key []byte) (*Channel, error) {
+	block, err := AES.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := CIPHER.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Channel{Id: id, Key: key, aead: aead, in: make(chan []byte, DEFAULT_IN_QUEUE)}, nil
+}
+
+//---------------------------------------------
+// 下发给客户端的凭证: 8B 通道ID | 16B 密钥，未开启通道时为空
+func (ch *Channel) Token() string {
+	if ch == nil {
+		return ""
+	}
+	buf := make([]byte, ID_LEN, ID_LEN+KEY_LEN)
+	BINARY.BigEndian.PutUint64(buf, ch.Id)
+	return string(append(buf, ch.Key...))
+}
+
+//---------------------------------------------
+// 等待转发的数据报，未开启通道时为nil，在select中永远不会就绪
+func (ch *Channel) Recv() <-chan []byte {
+	if ch == nil {
+		return nil
+	}
+	return ch.in
+}
+
+//---------------------------------------------
+func func_Nonce(dir byte, seq uint32) []byte {
+	nonce := make([]byte, 12)
+	nonce[0] = dir
+	BINARY.BigEndian.PutUint32(nonce[8:], seq)
+	return nonce
+}
+
+//---------------------------------------------
+// 解密客户端发来的数据报，返回明文 PROTO|PAYLOAD
+// 校验通过后记录序号与客户端地址，客户端切换网络后自动使用新地址
+func (ch *Channel) Open(seq uint32, sealed []byte, from *NET.UDPAddr) ([]byte, error) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if seq <= ch.recv {
+		return nil, ERROR_STALE
+	}
+	data, err := ch.aead.Open(nil, func_Nonce(DIR_IN, seq), sealed, nil)
+	if err != nil {
+		return nil, ERROR_BAD_DATAGRAM
+	}
+	ch.recv = seq
+	ch.addr = from
+	return data, nil
+}
+
+//---------------------------------------------
+// 加密发给客户端的数据报，返回完整的数据报与目标地址，客户端还未发送过数据报时地址为nil
+func (ch *Channel) Seal(data []byte) ([]byte, *NET.UDPAddr) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.send++
+	packet := make([]byte, HEADER_LEN, HEADER_LEN+len(data)+ch.aead.Overhead())
+	BINARY.BigEndian.PutUint64(packet, ch.Id)
+	BINARY.BigEndian.PutUint32(packet[ID_LEN:], ch.send)
+	return ch.aead.Seal(packet, func_Nonce(DIR_OUT, ch.send), data, nil), ch.addr
+}
+
+//---------------------------------------------
+// 压入等待转发的队列，队列已满时返回false
+func (ch *Channel) func_Push(data []byte) bool {
+	select {
+	case ch.in <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+//---------------------------------------------
@@ -0,0 +1,226 @@
+//---------------------------------------------
+package datagram
+
+//---------------------------------------------
+/*
+	与可靠会话并行的不可靠UDP通道，用于位置、移动等只关心最新状态的数据
+	客户端登陆成功后，从user_login_succeed_ack中的datagram_token取得通道ID与密钥
+	向 --datagram-listen 发送数据报，格式如下，全部为大端:
+	| 8B 通道ID | 4B 序号 | AES-128-GCM(PROTO|PAYLOAD) |
+	nonce为 1B 方向(客户端发出为0，Agent发出为1) | 7B 0 | 4B 序号
+	Agent丢弃乱序、重放、无法解密的数据报，其余以Datagram帧转发给游戏服
+	游戏服的Datagram帧按同样格式发往客户端最近一次发送数据报的地址
+	统计导出为/debug/vars中的datagram
+*/
+//---------------------------------------------
+import (
+	BINARY "encoding/binary"
+	ERRORS "errors"
+	EXPVAR "expvar"
+	NET "net"
+	SYNC "sync"
+
+	LOG "github.com/Sirupsen/logrus"
+	CLI "gopkg.in/urfave/cli.v2"
+)
+
+//---------------------------------------------
+const (
+	MAX_DATAGRAM = 1400 // 单个数据报的最大长度，避免IP分片
+)
+
+//---------------------------------------------
+var (
+	ERROR_STALE        = ERRORS.New("stale datagram")
+	ERROR_BAD_DATAGRAM = ERRORS.New("bad datagram")
+	ERROR_TOO_LARGE    = ERRORS.New("datagram too large")
+	ERROR_NO_ADDR      = ERRORS.New("datagram peer unknown")
+
+	_counters = EXPVAR.NewMap("datagram") // received, stale, bad, unknown, dropped, sent, unsent
+)
+
+//---------------------------------------------
+// 数据报服务，按通道ID找到所属会话
+type Server struct {
+	conn     *NET.UDPConn
+	channels map[uint64]*Channel
+	mu       SYNC.Mutex
+}
+
+var (
+	_default_server *Server
+	once            SYNC.Once
+)
+
+//---------------------------------------------
+func InitWithCliContext(c *CLI.Context) {
+	once.Do(func() {
+		addr := c.String("datagram-listen")
+		if addr == "" {
+			return
+		}
+		s, err := Listen(addr)
+		if err != nil {
+			LOG.Fatal("数据报通道监听失败:", err)
+		}
+		_default_server = s
+		LOG.Info("正在监听数据报地址:", s.Addr())
+		go s.Serve()
+	})
+}
+
+//---------------------------------------------
+func Listen(addr string) (*Server, error) {
+	udpaddr, err := NET.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := NET.ListenUDP("udp", udpaddr)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{conn: conn, channels: make(map[uint64]*Channel)}, nil
+}
+
+//---------------------------------------------
+func (s *Server) Addr() NET.Addr {
+	return s.conn.LocalAddr()
+}
+
+//---------------------------------------------
+func (s *Server) Close() error {
+	return s.conn.Close()
+}
+
+//---------------------------------------------
+// 为会话开启通道
+func (s *Server) Open() (*Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		ch, err := NewChannel()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := s.channels[ch.Id]; !ok {
+			s.channels[ch.Id] = ch
+			return ch, nil
+		}
+	}
+}
+
+//---------------------------------------------
+// 会话结束时关闭通道，之后收到的数据报被丢弃
+func (s *Server) Remove(ch *Channel) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.channels, ch.Id)
+}
+
+//---------------------------------------------
+func (s *Server) func_Lookup(id uint64) *Channel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.channels[id]
+}
+
+//---------------------------------------------
+// 接收数据报，直到监听关闭
+func (s *Server) Serve() {
+	buf := make([]byte, MAX_DATAGRAM+1)
+	for {
+		n, from, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			if nerr, ok := err.(NET.Error); ok && nerr.Temporary() {
+				continue
+			}
+			return
+		}
+		s.func_Handle(buf[:n], from)
+	}
+}
+
+//---------------------------------------------
+func (s *Server) func_Handle(packet []byte, from *NET.UDPAddr) {
+	if len(packet) <= HEADER_LEN || len(packet) > MAX_DATAGRAM {
+		_counters.Add("bad", 1)
+		return
+	}
+	ch := s.func_Lookup(BINARY.BigEndian.Uint64(packet))
+	if ch == nil {
+		_counters.Add("unknown", 1)
+		return
+	}
+	data, err := ch.Open(BINARY.BigEndian.Uint32(packet[ID_LEN:]), packet[HEADER_LEN:], from)
+	switch err {
+	case nil:
+	case ERROR_STALE:
+		_counters.Add("stale", 1)
+		return
+	default:
+		_counters.Add("bad", 1)
+		return
+	}
+	if len(data) < 2 {
+		_counters.Add("bad", 1)
+		return
+	}
+	if !ch.func_Push(data) {
+		_counters.Add("dropped", 1)
+		return
+	}
+	_counters.Add("received", 1)
+}
+
+//---------------------------------------------
+// 发送数据报给客户端，PROTO|PAYLOAD 加密后不能超过MAX_DATAGRAM
+func (s *Server) Send(ch *Channel, data []byte) error {
+	if HEADER_LEN+len(data)+ch.aead.Overhead() > MAX_DATAGRAM {
+		_counters.Add("unsent", 1)
+		return ERROR_TOO_LARGE
+	}
+	packet, addr := ch.Seal(data)
+	if addr == nil {
+		_counters.Add("unsent", 1)
+		return ERROR_NO_ADDR
+	}
+	if _, err := s.conn.WriteToUDP(packet, addr); err != nil {
+		_counters.Add("unsent", 1)
+		return err
+	}
+	_counters.Add("sent", 1)
+	return nil
+}
+
+//---------------------------------------------
+// 为已登陆的会话开启通道，未配置 --datagram-listen 时返回nil
+func Func_Open() *Channel {
+	if _default_server == nil {
+		return nil
+	}
+	ch, err := _default_server.Open()
+	if err != nil {
+		LOG.Error("开启数据报通道失败:", err)
+		return nil
+	}
+	return ch
+}
+
+//---------------------------------------------
+func Func_Close(ch *Channel) {
+	if _default_server != nil && ch != nil {
+		_default_server.Remove(ch)
+	}
+}
+
+//---------------------------------------------
+// 发送数据报，会话没有通道时丢弃
+func Func_Send(ch *Channel, data []byte) error {
+	if _default_server == nil || ch == nil {
+		_counters.Add("unsent", 1)
+		return ERROR_NO_ADDR
+	}
+	return _default_server.Send(ch, data)
+}
+
+//---------------------------------------------
@@ -0,0 +1,131 @@
+//---------------------------------------------
+package datagram
+
+//---------------------------------------------
+import (
+	BYTES "bytes"
+	BINARY "encoding/binary"
+	NET "net"
+	"testing"
+	TIME "time"
+)
+
+//---------------------------------------------
+// 模拟客户端，用凭证中的通道ID与密钥收发数据报
+type fake_client struct {
+	conn *NET.UDPConn
+	peer *Channel // 与Agent共享密钥，方向相反
+	seq  uint32
+}
+
+func func_NewClient(t *testing.T, token string, server NET.Addr) *fake_client {
+	if len(token) != ID_LEN+KEY_LEN {
+		t.Fatal("token length", len(token))
+	}
+	peer, err := func_NewChannel(BINARY.BigEndian.Uint64([]byte(token)), []byte(token[ID_LEN:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := NET.DialUDP("udp", nil, server.(*NET.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fake_client{conn: conn, peer: peer}
+}
+
+func (c *fake_client) send(seq uint32, data []byte) {
+	packet := make([]byte, HEADER_LEN)
+	BINARY.BigEndian.PutUint64(packet, c.peer.Id)
+	BINARY.BigEndian.PutUint32(packet[ID_LEN:], seq)
+	c.conn.Write(c.peer.aead.Seal(packet, func_Nonce(DIR_IN, seq), data, nil))
+}
+
+func (c *fake_client) recv(t *testing.T) []byte {
+	buf := make([]byte, MAX_DATAGRAM)
+	c.conn.SetReadDeadline(TIME.Now().Add(5 * TIME.Second))
+	n, err := c.conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq := BINARY.BigEndian.Uint32(buf[ID_LEN:])
+	data, err := c.peer.aead.Open(nil, func_Nonce(DIR_OUT, seq), buf[HEADER_LEN:n], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+//---------------------------------------------
+func func_Expect(t *testing.T, ch *Channel, want []byte) {
+	select {
+	case data := <-ch.Recv():
+		if !BYTES.Equal(data, want) {
+			t.Errorf("recv got %v want %v", data, want)
+		}
+	case <-TIME.After(5 * TIME.Second):
+		t.Fatalf("recv timeout, want %v", want)
+	}
+}
+
+//---------------------------------------------
+func TestDatagram(t *testing.T) {
+	s, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	go s.Serve()
+
+	ch, err := s.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := func_NewClient(t, ch.Token(), s.Addr())
+	defer c.conn.Close()
+
+	// 客户端还未发送过数据报，Agent不知道地址
+	if err := s.Send(ch, []byte{0x07, 0xd1}); err != ERROR_NO_ADDR {
+		t.Error("send before recv got", err)
+	}
+
+	// 乱序到达的旧数据报被丢弃
+	c.send(2, []byte{0x07, 0xd1, 2})
+	func_Expect(t, ch, []byte{0x07, 0xd1, 2})
+	c.send(1, []byte{0x07, 0xd1, 1})
+	c.send(3, []byte{0x07, 0xd1, 3})
+	func_Expect(t, ch, []byte{0x07, 0xd1, 3})
+
+	// 篡改的数据报被丢弃
+	packet := make([]byte, HEADER_LEN+20)
+	BINARY.BigEndian.PutUint64(packet, ch.Id)
+	BINARY.BigEndian.PutUint32(packet[ID_LEN:], 10)
+	c.conn.Write(packet)
+	c.send(4, []byte{0x07, 0xd1, 4})
+	func_Expect(t, ch, []byte{0x07, 0xd1, 4})
+
+	if err := s.Send(ch, []byte{0x07, 0xd2, 9}); err != nil {
+		t.Fatal(err)
+	}
+	if data := c.recv(t); !BYTES.Equal(data, []byte{0x07, 0xd2, 9}) {
+		t.Error("client got", data)
+	}
+	if err := s.Send(ch, make([]byte, MAX_DATAGRAM)); err != ERROR_TOO_LARGE {
+		t.Error("large datagram got", err)
+	}
+
+	// 关闭后的通道不再接收
+	s.Remove(ch)
+	c.send(5, []byte{0x07, 0xd1, 5})
+	select {
+	case data := <-ch.Recv():
+		t.Error("removed channel got", data)
+	case <-TIME.After(100 * TIME.Millisecond):
+	}
+
+	var none *Channel
+	if none.Token() != "" || none.Recv() != nil {
+		t.Error("nil channel should be inert")
+	}
+}
+
+//---------------------------------------------
@@ -0,0 +1,174 @@
+//---------------------------------------------
+package fanout
+
+//---------------------------------------------
+/*
+	游戏服经Agent控制流发来的广播、组播帧，由Agent在本地分发给会话
+	Broadcast:  投递给全部已登陆会话，由会话协程判断是否位于该游戏服
+	Multicast:  投递给UserIds中的玩家，以及Group中的成员
+	GroupJoin:  UserIds加入Group
+	GroupLeave: UserIds离开Group，UserIds为空时解散Group
+	组按游戏服区分，控制流中断后该游戏服的组全部清空，由游戏服在控制流重新建立时补发GroupJoin
+	每个Agent的后端服务各有一个Fanout，只投递给属于该Agent的会话，见FKServer_Agent/Backend
+	投递不等待会话，会话消息队列已满时丢弃，次数通过expvar导出，见/debug/vars中的fanout
+*/
+//---------------------------------------------
+import (
+	EXPVAR "expvar"
+	SYNC "sync"
+
+	PROTO "FKGoServer/FKServer_Agent/Proto"
+	SESSION "FKGoServer/FKServer_Agent/Session"
+
+	LOG "github.com/Sirupsen/logrus"
+)
+
+//---------------------------------------------
+var (
+	_counters = EXPVAR.NewMap("fanout") // delivered, dropped
+)
+
+//---------------------------------------------
+// 组成员表
+type Groups struct {
+	records map[string]map[string]map[int32]struct{} // gsid -> group -> userids
+	SYNC.RWMutex
+}
+
+//---------------------------------------------
+// 加入组
+func (g *Groups) Join(gsid, group string, ids []int32) {
+	g.Lock()
+	defer g.Unlock()
+	groups := g.records[gsid]
+	if groups == nil {
+		groups = make(map[string]map[int32]struct{})
+		g.records[gsid] = groups
+	}
+	members := groups[group]
+	if members == nil {
+		members = make(map[int32]struct{})
+		groups[group] = members
+	}
+	for _, id := range ids {
+		members[id] = struct{}{}
+	}
+}
+
+//---------------------------------------------
+// 离开组，ids为空时解散组
+func (g *Groups) Leave(gsid, group string, ids []int32) {
+	g.Lock()
+	defer g.Unlock()
+	groups := g.records[gsid]
+	if groups == nil {
+		return
+	}
+	if len(ids) == 0 {
+		delete(groups, group)
+		return
+	}
+	members := groups[group]
+	for _, id := range ids {
+		delete(members, id)
+	}
+	if len(members) == 0 {
+		delete(groups, group)
+	}
+}
+
+//---------------------------------------------
+// 组成员
+func (g *Groups) Members(gsid, group string) []int32 {
+	g.RLock()
+	defer g.RUnlock()
+	members := g.records[gsid][group]
+	ids := make([]int32, 0, len(members))
+	for id := range members {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+//---------------------------------------------
+// 清空游戏服的全部组
+func (g *Groups) Reset(gsid string) {
+	g.Lock()
+	delete(g.records, gsid)
+	g.Unlock()
+}
+
+//---------------------------------------------
+// 一个Agent的本地分发，owner为会话所属的后端服务
+type Fanout struct {
+	owner  SESSION.Backend
+	groups Groups
+}
+
+//---------------------------------------------
+func NewFanout(owner SESSION.Backend) *Fanout {
+	return &Fanout{owner: owner, groups: Groups{records: make(map[string]map[string]map[int32]struct{})}}
+}
+
+//---------------------------------------------
+// 处理游戏服gsid控制流上的一帧
+func (f *Fanout) Dispatch(gsid string, frame *PROTO.Game_Frame) {
+	switch frame.Type {
+	case PROTO.Game_Broadcast:
+		broadcast := PROTO.Game_Frame{Type: PROTO.Game_Broadcast, Message: frame.Message, Target: gsid}
+		for _, sess := range SESSION.Func_AllUsers() {
+			if sess.Backend == f.owner {
+				func_Deliver(sess, broadcast)
+			}
+		}
+	case PROTO.Game_Multicast:
+		ids := frame.UserIds
+		if frame.Group != "" {
+			ids = append(ids, f.groups.Members(gsid, frame.Group)...)
+		}
+		message := PROTO.Game_Frame{Type: PROTO.Game_Message, Message: frame.Message}
+		seen := make(map[int32]bool, len(ids))
+		for _, id := range ids {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			if sess := SESSION.Func_QueryUser(id); sess != nil && sess.Backend == f.owner {
+				func_Deliver(sess, message)
+			}
+		}
+	case PROTO.Game_GroupJoin:
+		f.groups.Join(gsid, frame.Group, frame.UserIds)
+	case PROTO.Game_GroupLeave:
+		f.groups.Leave(gsid, frame.Group, frame.UserIds)
+	default:
+		LOG.Warningf("控制流上未知的帧类型 游戏服:%v 类型:%v", gsid, frame.Type)
+	}
+}
+
+//---------------------------------------------
+// 游戏服控制流中断，清空该游戏服的组
+func (f *Fanout) ResetGame(gsid string) {
+	f.groups.Reset(gsid)
+}
+
+//---------------------------------------------
+// 组成员
+func (f *Fanout) Members(gsid, group string) []int32 {
+	return f.groups.Members(gsid, group)
+}
+
+//---------------------------------------------
+// 投递到会话消息队列，不等待
+func func_Deliver(sess *SESSION.Session, frame PROTO.Game_Frame) {
+	select {
+	case sess.MQ <- SESSION.Frame{Game_Frame: frame}:
+		_counters.Add("delivered", 1)
+	case <-sess.Die:
+	default:
+		_counters.Add("dropped", 1)
+		LOG.Warningf("会话消息队列已满，丢弃广播消息 userid:%v", sess.UserId)
+	}
+}
+
+//---------------------------------------------
@@ -0,0 +1,88 @@
+//---------------------------------------------
+package fanout
+
+//---------------------------------------------
+import (
+	"testing"
+
+	PROTO "FKGoServer/FKServer_Agent/Proto"
+	SESSION "FKGoServer/FKServer_Agent/Session"
+)
+
+//---------------------------------------------
+func func_FakeUser(id int32) *SESSION.Session {
+	sess := &SESSION.Session{UserId: id, MQ: make(chan SESSION.Frame, 4), Die: make(chan struct{})}
+	SESSION.Func_RegisterUser(id, sess)
+	return sess
+}
+
+//---------------------------------------------
+// 其他Agent的后端服务
+type other_backend struct{}
+
+func (*other_backend) SelectGame(userid int32) string { return "" }
+func (*other_backend) OpenGameStream(sess *SESSION.Session, gsid string) (PROTO.GameService_StreamClient, error) {
+	return nil, nil
+}
+func (*other_backend) ReleaseGame(gsid string) {}
+
+//---------------------------------------------
+func TestDispatch(t *testing.T) {
+	a, b, c := func_FakeUser(1), func_FakeUser(2), func_FakeUser(3)
+	other := func_FakeUser(4)
+	other.Backend = &other_backend{}
+	defer func() {
+		for _, sess := range []*SESSION.Session{a, b, c, other} {
+			SESSION.Func_UnregisterUser(sess.UserId, sess)
+		}
+	}()
+
+	fo := NewFanout(nil)
+	fo.Dispatch("game1", &PROTO.Game_Frame{Type: PROTO.Game_Broadcast, Message: []byte("all")})
+	for _, sess := range []*SESSION.Session{a, b, c} {
+		if f := <-sess.MQ; f.Type != PROTO.Game_Broadcast || f.Target != "game1" || string(f.Message) != "all" {
+			t.Error("broadcast got", f)
+		}
+	}
+
+	// 组播: UserIds与组成员去重合并
+	fo.Dispatch("game1", &PROTO.Game_Frame{Type: PROTO.Game_GroupJoin, Group: "guild", UserIds: []int32{2, 3}})
+	fo.Dispatch("game1", &PROTO.Game_Frame{Type: PROTO.Game_Multicast, Group: "guild", UserIds: []int32{1, 2, 4}, Message: []byte("m")})
+	for _, sess := range []*SESSION.Session{a, b, c} {
+		if len(sess.MQ) != 1 {
+			t.Error("multicast userid", sess.UserId, "got", len(sess.MQ))
+		}
+		if f := <-sess.MQ; f.Type != PROTO.Game_Message {
+			t.Error("multicast should deliver message frame:", f)
+		}
+	}
+
+	// 其他Agent的会话不在本Fanout投递
+	if len(other.MQ) != 0 {
+		t.Error("delivered to session of another backend:", len(other.MQ))
+	}
+
+	// 组按游戏服区分
+	if n := len(fo.Members("game2", "guild")); n != 0 {
+		t.Error("groups leaked across games:", n)
+	}
+
+	fo.Dispatch("game1", &PROTO.Game_Frame{Type: PROTO.Game_GroupLeave, Group: "guild", UserIds: []int32{2}})
+	if ids := fo.Members("game1", "guild"); len(ids) != 1 || ids[0] != 3 {
+		t.Error("leave got", ids)
+	}
+	fo.ResetGame("game1")
+	if n := len(fo.Members("game1", "guild")); n != 0 {
+		t.Error("reset got", n)
+	}
+
+	// 队列已满时丢弃，不阻塞
+	for i := 0; i < cap(a.MQ)+2; i++ {
+		fo.Dispatch("game1", &PROTO.Game_Frame{Type: PROTO.Game_Multicast, UserIds: []int32{1}})
+	}
+	if len(a.MQ) != cap(a.MQ) {
+		t.Error("queue got", len(a.MQ))
+	}
+}
+
+//---------------------------------------------
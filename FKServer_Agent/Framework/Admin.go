@@ -0,0 +1,64 @@
+//---------------------------------------------
+package framework
+
+//---------------------------------------------
+import (
+	TIME "time"
+
+	MSGDEFINE "FKGoServer/FKLib_Common/MsgDefine"
+	PACKET "FKGoServer/FKLib_Common/Packet"
+	SESSION "FKGoServer/FKServer_Agent/Session"
+
+	LOG "github.com/Sirupsen/logrus"
+)
+
+//---------------------------------------------
+// 执行运维接口投递的指令，在会话协程中执行
+// out为nil表示连接已断开，会话正在等待客户端恢复，此时公告只记录到重传缓冲
+func func_OnAdminCommand(sess *SESSION.Session, out *Buffer, cmd SESSION.Command) {
+	if !cmd.Filter.Match(sess) {
+		cmd.Reply <- nil
+		return
+	}
+	info := sess.Snapshot(out == nil)
+	if out != nil {
+		info.QueuePackets, info.QueueBytes = out.queue.Len()
+	}
+
+	switch cmd.Type {
+	case SESSION.CMD_KICK:
+		// 未指定错误码的为运维踢人，例如重复登陆指定了ERR_KICK_DUPLICATE_LOGIN
+		code := cmd.Code
+		if code == 0 {
+			code = MSGDEFINE.ERR_KICK_ADMIN
+		}
+		LOG.Warningf("踢掉客户端 userid:%v 会话IP:%v 错误码:%v 原因:%v", sess.UserId, sess.IP, code, cmd.Text)
+		sess.Kick(code, cmd.Text)
+	case SESSION.CMD_MIGRATE:
+		// 已登陆的客户端收到通知后可以在强制断开前自行重连
+		// 已断开等待恢复的会话无法再恢复到本Agent(监听已经关闭)，直接结束
+		if out == nil {
+			sess.Kick(MSGDEFINE.ERR_KICK_MAINTENANCE, "server draining")
+		} else if sess.UserId != 0 {
+			deadline := int32(cmd.Deadline.Sub(TIME.Now()) / TIME.Second)
+			if deadline < 0 {
+				deadline = 0
+			}
+			out.func_CreateAndSendMsgPacket(sess, PACKET.Func_Pack(MSGDEFINE.Code["server_migrate_ack"],
+				MSGDEFINE.S_migrate_info{F_msg: cmd.Text, F_addr: cmd.Addr, F_deadline: deadline}, nil))
+		} else {
+			info = nil
+		}
+	case SESSION.CMD_NOTICE:
+		// 未完成握手的连接无法下发公告
+		if sess.UserId != 0 {
+			out.func_CreateAndSendMsgPacket(sess, PACKET.Func_Pack(MSGDEFINE.Code["server_notice_ack"],
+				MSGDEFINE.S_notice_info{F_msg: cmd.Text}, nil))
+		} else {
+			info = nil
+		}
+	}
+	cmd.Reply <- info
+}
+
+//---------------------------------------------
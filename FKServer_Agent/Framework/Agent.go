@@ -0,0 +1,272 @@
+//---------------------------------------------
+package framework
+
+//---------------------------------------------
+/*
+	Agent服务对象
+	每个Agent拥有自己的监听、会话协程、排空与关闭过程，以及后端服务(选服、路由、控制流)，同一进程中可以运行多个Agent(例如端到端测试)
+	握手、鉴权、发包频率限制、在线表等子系统在进程内共享，由Func_InitApp或各子系统的Init初始化
+	1. NewAgent(cfg) 创建Agent，零值参数使用默认值
+	2. Start() 开始监听，监听失败时返回错误
+	3. Drain() 排空后关闭，见Drain.go；Stop(ctx) 立即踢掉全部会话并等待会话协程结束
+	4. Done() 在全部会话协程结束后关闭
+*/
+//---------------------------------------------
+import (
+	TLS "crypto/tls"
+	NET "net"
+	HTTP "net/http"
+	SYNC "sync"
+	TIME "time"
+
+	MSGDEFINE "FKGoServer/FKLib_Common/MsgDefine"
+	PACKET "FKGoServer/FKLib_Common/Packet"
+	BACKEND "FKGoServer/FKServer_Agent/Backend"
+	SESSION "FKGoServer/FKServer_Agent/Session"
+	UDP "FKGoServer/FKServer_Agent/Udp"
+
+	LOG "github.com/Sirupsen/logrus"
+	KCP "github.com/xtaci/kcp-go"
+	CONTEXT "golang.org/x/net/context"
+)
+
+//---------------------------------------------
+// Agent配置，对应同名的命令行参数，见Func_NewConfig
+type Config struct {
+	Listen   string   // TCP与KCP的监听地址，为空则只使用注入的监听
+	WSListen string   // WebSocket监听地址，为空则不启用
+	WSPath   string   // WebSocket路径
+	WSOrigin []string // 允许的WebSocket来源，为空则不限制
+	WSSCert  string   // WSS证书，与WSSKey同时设置时启用WSS
+	WSSKey   string   // WSS证书私钥
+
+	WSHandshakeTimeout TIME.Duration // WebSocket升级握手(包括读取HTTP请求头)的最长时间
+
+	// 注入的监听，不为nil时代替对应的监听地址，由Agent负责关闭
+	TCPListener NET.Listener
+	KCPListener *KCP.Listener
+	WSListener  NET.Listener
+
+	// 后端服务，Start时按以下配置为本Agent创建，见BACKEND.NewBackend
+	Dialer      BACKEND.Dialer // 后端服务的发现与连接，为nil时使用etcd服务发现
+	GameService string         // 游戏服的服务名
+	GameSelect  string         // 游戏服选服策略
+	GameId      string         // fixed选服策略下固定选取的游戏服ID
+	Routes      []string       // 协议号路由表，为空则全部游戏协议转发到GameService
+	RouteKey    string         // etcd中的路由表key，为空则不监视
+
+	IdleTimeout  TIME.Duration // 连接没有收到任何数据包的最长时间
+	PingInterval TIME.Duration // 已登陆的客户端静默超过该时间后主动发起ping
+	MessageLimit int           // 客户端消息的最大长度
+	DrainTimeout TIME.Duration // 排空时等待会话自然结束的最长时间，0表示立即踢掉全部会话
+	DrainAddr    string        // 排空时建议客户端重连的地址
+}
+
+//---------------------------------------------
+type Agent struct {
+	cfg Config
+
+	tcp NET.Listener
+	kcp *KCP.Listener
+	ws  NET.Listener
+
+	ws_server *HTTP.Server // WebSocket的HTTP服务，未启用WebSocket时为nil
+
+	backend *BACKEND.Backend // 本Agent的后端服务，Start时创建
+
+	wg     SYNC.WaitGroup  // 会话协程
+	online *SESSION.Online // 本Agent的会话，包括已断开等待恢复的会话
+	die    chan struct{}   // 关闭信号，会话收到后踢掉客户端
+	drain  chan struct{}   // 停止接受新连接
+	done   chan struct{}   // 全部会话协程已结束
+
+	draining   int32
+	drain_once SYNC.Once
+	close_once SYNC.Once
+	stop_once  SYNC.Once
+}
+
+//---------------------------------------------
+func NewAgent(cfg Config) *Agent {
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = CONST_ReadDeadline * TIME.Second
+	}
+	if cfg.PingInterval <= 0 {
+		cfg.PingInterval = CONST_PingInterval * TIME.Second
+	}
+	if cfg.MessageLimit <= 0 {
+		cfg.MessageLimit = PACKET.DEFAULT_MESSAGE_LIMIT
+	}
+	if cfg.WSHandshakeTimeout <= 0 {
+		cfg.WSHandshakeTimeout = CONST_WSHandshake * TIME.Second
+	}
+	if cfg.WSPath == "" {
+		cfg.WSPath = "/ws"
+	}
+	if cfg.GameService == "" {
+		cfg.GameService = BACKEND.DEFAULT_GAME_SERVICE
+	}
+	if cfg.GameSelect == "" {
+		cfg.GameSelect = "fixed"
+	}
+	if cfg.GameId == "" {
+		cfg.GameId = MSGDEFINE.DEFAULT_GSID
+	}
+	if cfg.PingInterval >= cfg.IdleTimeout {
+		LOG.Warningf("--ping-interval(%v)应小于--idle-timeout(%v)，否则静默的客户端会在ping之前断开", cfg.PingInterval, cfg.IdleTimeout)
+	}
+	return &Agent{
+		cfg:    cfg,
+		online: SESSION.NewOnline(),
+		die:    make(chan struct{}),
+		drain:  make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+//---------------------------------------------
+// 创建后端服务，开始监听并接受连接，任何一个监听失败时关闭已开启的监听与后端服务并返回错误
+func (a *Agent) Start() error {
+	backend, err := BACKEND.NewBackend(a.cfg.Dialer, a.cfg.GameService, a.cfg.GameSelect, a.cfg.GameId, a.cfg.Routes, a.cfg.RouteKey)
+	if err != nil {
+		return err
+	}
+	a.backend = backend
+	if err := a.func_Listen(); err != nil {
+		a.func_CloseListeners()
+		a.backend.Close()
+		return err
+	}
+	if a.tcp != nil {
+		LOG.Info("正在监听TCP地址:", a.tcp.Addr())
+		go a.func_ServeTcp()
+	}
+	if a.kcp != nil {
+		LOG.Info("正在监听UDP地址:", a.kcp.Addr())
+		go a.func_ServeUdp()
+	}
+	if a.ws != nil {
+		if a.cfg.WSSCert != "" {
+			LOG.Info("正在监听WSS地址:", a.ws.Addr())
+		} else {
+			LOG.Info("正在监听WebSocket地址:", a.ws.Addr())
+		}
+		a.ws_server = a.func_NewWebSocketServer()
+		go a.func_ServeWebSocket()
+	}
+	return nil
+}
+
+//---------------------------------------------
+func (a *Agent) func_Listen() (err error) {
+	a.tcp, a.kcp, a.ws = a.cfg.TCPListener, a.cfg.KCPListener, a.cfg.WSListener
+	if a.cfg.Listen != "" {
+		if a.tcp == nil {
+			if a.tcp, err = NET.Listen("tcp4", a.cfg.Listen); err != nil {
+				return err
+			}
+		}
+		// 按 --kcp-crypt 与 --kcp-data-shards 启用包加密与前向纠错
+		if a.kcp == nil {
+			if a.kcp, err = UDP.Func_Listen(a.cfg.Listen); err != nil {
+				return err
+			}
+			// 设置Socket缓冲与DSCP，失败时只记录日志
+			if err := a.kcp.SetReadBuffer(CONST_UdpBuffer); err != nil {
+				LOG.Println(err)
+			}
+			if err := a.kcp.SetWriteBuffer(CONST_UdpBuffer); err != nil {
+				LOG.Println(err)
+			}
+			if err := a.kcp.SetDSCP(CONST_TosEF); err != nil {
+				LOG.Println(err)
+			}
+		}
+	}
+	if a.ws == nil && a.cfg.WSListen != "" {
+		if a.ws, err = NET.Listen("tcp", a.cfg.WSListen); err != nil {
+			return err
+		}
+		if a.cfg.WSSCert != "" {
+			pair, err := TLS.LoadX509KeyPair(a.cfg.WSSCert, a.cfg.WSSKey)
+			if err != nil {
+				return err
+			}
+			a.ws = TLS.NewListener(a.ws, &TLS.Config{Certificates: []TLS.Certificate{pair}})
+		}
+	}
+	return nil
+}
+
+//---------------------------------------------
+// 停止接受新连接，只有第一次调用生效
+func (a *Agent) func_CloseListeners() {
+	a.close_once.Do(func() {
+		close(a.drain)
+		if a.tcp != nil {
+			a.tcp.Close()
+		}
+		if a.kcp != nil {
+			a.kcp.Close()
+		}
+		if a.ws_server != nil {
+			// 关闭监听与未完成握手的连接，已升级的连接由会话自行结束
+			a.ws_server.Close()
+		}
+		if a.ws != nil {
+			a.ws.Close()
+		}
+	})
+}
+
+//---------------------------------------------
+// TCP监听地址，未开启TCP监听时为nil
+func (a *Agent) Addr() NET.Addr {
+	if a.tcp == nil {
+		return nil
+	}
+	return a.tcp.Addr()
+}
+
+//---------------------------------------------
+// 本Agent的会话个数
+func (a *Agent) SessionCount() int {
+	return a.online.Count()
+}
+
+//---------------------------------------------
+// 全部会话协程结束后关闭
+func (a *Agent) Done() <-chan struct{} {
+	return a.done
+}
+
+//---------------------------------------------
+// 关闭Agent: 停止接受新连接，踢掉全部会话(原因为服务器维护)，等待会话协程结束
+// ctx到期时返回ctx.Err()，关闭过程继续在后台进行
+func (a *Agent) Stop(ctx CONTEXT.Context) error {
+	go a.func_Shutdown()
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//---------------------------------------------
+// 踢掉剩余会话，等待全部会话协程结束
+func (a *Agent) func_Shutdown() {
+	a.stop_once.Do(func() {
+		a.func_CloseListeners()
+		LOG.Infof("请等待Agent关闭... 剩余会话:%v", a.online.Count())
+		close(a.die)
+		a.wg.Wait()
+		if a.backend != nil {
+			a.backend.Close()
+		}
+		LOG.Info("Agent已关闭")
+		close(a.done)
+	})
+}
+
+//---------------------------------------------
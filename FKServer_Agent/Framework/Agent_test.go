@@ -0,0 +1,873 @@
+//---------------------------------------------
+package framework
+
+//---------------------------------------------
+import (
+	ERRORS "errors"
+	FMT "fmt"
+	BIG "math/big"
+	NET "net"
+	STRCONV "strconv"
+	SYNC "sync"
+	"testing"
+	TIME "time"
+
+	CIPHER "FKGoServer/FKLib_Common/Cipher"
+	DH "FKGoServer/FKLib_Common/DH"
+	MSGDEFINE "FKGoServer/FKLib_Common/MsgDefine"
+	PACKET "FKGoServer/FKLib_Common/Packet"
+	WEBSOCKET "FKGoServer/FKLib_Common/WebSocket"
+	AUTH "FKGoServer/FKServer_Agent/Auth"
+	BACKEND "FKGoServer/FKServer_Agent/Backend"
+	HANDSHAKE "FKGoServer/FKServer_Agent/Handshake"
+	LIMITER "FKGoServer/FKServer_Agent/Limiter"
+	PROTO "FKGoServer/FKServer_Agent/Proto"
+	PROXY "FKGoServer/FKServer_Agent/Proxy"
+	VERSION "FKGoServer/FKServer_Agent/Version"
+
+	CONTEXT "golang.org/x/net/context"
+	GRPC "google.golang.org/grpc"
+	METADATA "google.golang.org/grpc/metadata"
+)
+
+//---------------------------------------------
+const (
+	TEST_GAME_SERVICE = "game-10000"
+	TEST_GAME_ID      = "game1"
+	TEST_GAME_ID2     = "game2" // 故障转移的目标，与game1是同一个进程内的游戏服
+	TEST_PROTO_FAIL   = 1003    // 游戏服收到后中断该流
+	TEST_PROTO_CLOSE  = 1004    // 游戏服收到后正常关闭该流，Agent只能在下一次发送时发现
+	TEST_SERVICE      = "other-10000"
+	TEST_SERVICE_ID   = "other1"
+	TEST_PROTO_OTHER  = 32001 // 路由到TEST_SERVICE，该服务收到后下发踢人与切换游戏服，Agent应当忽略
+	TEST_TIMEOUT      = 5 * TIME.Second
+)
+
+//---------------------------------------------
+// 进程内的游戏服，同时作为Agent的Dialer
+// 回显proto_ping_req，收到TEST_PROTO_FAIL时中断流，收到TEST_PROTO_CLOSE时正常关闭流，按玩家ID记录流，用于下发踢人帧，同时记录元数据中的客户端版本
+type fake_game struct {
+	conn     *GRPC.ClientConn
+	streams  map[int32]PROTO.GameService_StreamServer
+	versions map[int32]string
+	closed   chan int32    // 收到TEST_PROTO_CLOSE后关闭了流的玩家
+	opened   map[int32]int // 按玩家ID记录开启的流的个数
+	mu       SYNC.Mutex
+}
+
+func (g *fake_game) Stream(stream PROTO.GameService_StreamServer) error {
+	md, _ := METADATA.FromContext(stream.Context())
+	if len(md["agent"]) > 0 { // 控制流，本测试不使用
+		<-stream.Context().Done()
+		return nil
+	}
+	userid, err := STRCONV.Atoi(md["userid"][0])
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	g.streams[int32(userid)] = stream
+	g.versions[int32(userid)] = md["version"][0]
+	g.opened[int32(userid)]++
+	g.mu.Unlock()
+
+	for {
+		frame, err := stream.Recv()
+		if err != nil {
+			return nil
+		}
+		reader := PACKET.Reader(frame.Message)
+		proto, _ := reader.ReadS16()
+		if frame.Type == PROTO.Game_Message && proto == MSGDEFINE.Code["proto_ping_req"] {
+			tbl, _ := MSGDEFINE.PKT_auto_id(reader)
+			stream.Send(&PROTO.Game_Frame{Type: PROTO.Game_Message, Message: PACKET.Func_Pack(MSGDEFINE.Code["proto_ping_ack"], tbl, nil)})
+		}
+		if frame.Type == PROTO.Game_Message && proto == TEST_PROTO_FAIL {
+			return ERRORS.New("game failure")
+		}
+		if frame.Type == PROTO.Game_Message && proto == TEST_PROTO_OTHER {
+			stream.Send(&PROTO.Game_Frame{Type: PROTO.Game_Kick, Reason: "other service"})
+			stream.Send(&PROTO.Game_Frame{Type: PROTO.Game_Redirect, Target: TEST_GAME_ID2})
+		}
+		if frame.Type == PROTO.Game_Message && proto == TEST_PROTO_CLOSE {
+			defer func() { g.closed <- int32(userid) }()
+			return nil
+		}
+	}
+}
+
+func (g *fake_game) Ids(service string) []string {
+	switch service {
+	case TEST_GAME_SERVICE:
+		return []string{TEST_GAME_ID, TEST_GAME_ID2}
+	case TEST_SERVICE:
+		return []string{TEST_SERVICE_ID}
+	}
+	return nil
+}
+
+func (g *fake_game) Dial(service, id string) *GRPC.ClientConn {
+	if service == TEST_GAME_SERVICE && (id == TEST_GAME_ID || id == TEST_GAME_ID2) {
+		return g.conn
+	}
+	if service == TEST_SERVICE && id == TEST_SERVICE_ID {
+		return g.conn
+	}
+	return nil
+}
+
+func (g *fake_game) Watch(service string, ch chan string) {
+	for _, id := range g.Ids(service) {
+		ch <- service + "/" + id
+	}
+}
+
+// 游戏服主动踢掉玩家
+func (g *fake_game) kick(t *testing.T, userid int32) {
+	g.mu.Lock()
+	stream := g.streams[userid]
+	g.mu.Unlock()
+	if stream == nil {
+		t.Fatal("no game stream for", userid)
+	}
+	if err := stream.Send(&PROTO.Game_Frame{Type: PROTO.Game_Kick, Reason: "test"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//---------------------------------------------
+var (
+	_test_game  *fake_game
+	_test_setup SYNC.Once
+)
+
+// 初始化进程内共享的子系统，全部测试使用同一个游戏服
+func func_Setup(t *testing.T) *fake_game {
+	_test_setup.Do(func() {
+		lis, err := NET.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := GRPC.NewServer()
+		game := &fake_game{streams: make(map[int32]PROTO.GameService_StreamServer), versions: make(map[int32]string), closed: make(chan int32, 16), opened: make(map[int32]int)}
+		PROTO.RegisterGameServiceServer(server, game)
+		go server.Serve(lis)
+		if game.conn, err = GRPC.Dial(lis.Addr().String(), GRPC.WithInsecure()); err != nil {
+			t.Fatal(err)
+		}
+
+		HANDSHAKE.Init([]string{"v1"}, "", nil, 0, PACKET.DEFAULT_MESSAGE_LIMIT)
+		AUTH.Init([]string{"udid"}, AUTH.NewMemoryStore(), "", true)
+		BACKEND.Init()
+		go func_HandleEvictions()
+		_test_game = game
+	})
+	if _test_game == nil {
+		t.Fatal("setup failed")
+	}
+	return _test_game
+}
+
+// 连接进程内游戏服的Agent配置，不含监听
+func func_TestConfig(game *fake_game) Config {
+	return Config{
+		Dialer:      game,
+		GameService: TEST_GAME_SERVICE,
+		GameSelect:  "fixed",
+		GameId:      TEST_GAME_ID,
+		Routes:      []string{"1001-32000:" + TEST_GAME_SERVICE, "32001-32767:" + TEST_SERVICE},
+	}
+}
+
+// 在随机端口上启动一个只开启TCP监听的Agent
+func func_StartAgent(t *testing.T, game *fake_game) *Agent {
+	lis, err := NET.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := func_TestConfig(game)
+	cfg.TCPListener = lis
+	agent := NewAgent(cfg)
+	if err := agent.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return agent
+}
+
+func func_StopAgent(t *testing.T, agent *Agent) {
+	ctx, cancel := CONTEXT.WithTimeout(CONTEXT.Background(), TEST_TIMEOUT)
+	defer cancel()
+	if err := agent.Stop(ctx); err != nil {
+		t.Error("stop agent:", err)
+	}
+}
+
+//---------------------------------------------
+// 模拟客户端，完成v1握手后加密收发
+type test_client struct {
+	t       *testing.T
+	conn    NET.Conn
+	seq     uint32
+	encoder CIPHER.Codec
+	decoder CIPHER.Codec
+}
+
+func func_Dial(t *testing.T, agent *Agent) *test_client {
+	conn, err := NET.Dial("tcp", agent.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func_Handshake(t, conn)
+}
+
+// 在已经建立的连接上完成v1握手
+func func_Handshake(t *testing.T, conn NET.Conn) *test_client {
+	c := &test_client{t: t, conn: conn}
+
+	S1, M1 := DH.DHExchange()
+	S2, M2 := DH.DHExchange()
+	c.send(MSGDEFINE.Code["get_seed_req"], MSGDEFINE.S_seed_info{F_client_send_seed: int32(M1.Int64()), F_client_receive_seed: int32(M2.Int64())})
+	seed, _ := MSGDEFINE.PKT_seed_info(c.expect(MSGDEFINE.Code["get_seed_ack"]))
+	K1 := DH.DHKey(S1, BIG.NewInt(int64(seed.F_client_send_seed)))
+	K2 := DH.DHKey(S2, BIG.NewInt(int64(seed.F_client_receive_seed)))
+	c.encoder, _ = CIPHER.NewRC4Codec([]byte(FMT.Sprintf("%v%v", MSGDEFINE.SALT, K1)))
+	c.decoder, _ = CIPHER.NewRC4Codec([]byte(FMT.Sprintf("%v%v", MSGDEFINE.SALT, K2)))
+	return c
+}
+
+func (c *test_client) send(proto int16, info interface{}) {
+	c.seq++
+	w := PACKET.Writer()
+	w.WriteU32(c.seq)
+	w.WriteRawBytes(PACKET.Func_Pack(proto, info, nil))
+	data := w.Data()
+	if c.encoder != nil {
+		data = c.encoder.Seal(data)
+	}
+	if _, err := c.conn.Write(PACKET.AppendFrames(nil, data)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *test_client) recv() (int16, *PACKET.Packet, error) {
+	return c.recv_timeout(TEST_TIMEOUT)
+}
+
+func (c *test_client) recv_timeout(timeout TIME.Duration) (int16, *PACKET.Packet, error) {
+	c.conn.SetReadDeadline(TIME.Now().Add(timeout))
+	data, err := PACKET.ReadMessage(c.conn, make([]byte, 2), PACKET.DEFAULT_MESSAGE_LIMIT)
+	if err != nil {
+		return 0, nil, err
+	}
+	if c.decoder != nil {
+		if data, err = c.decoder.Open(data); err != nil {
+			return 0, nil, err
+		}
+	}
+	reader := PACKET.Reader(data)
+	proto, err := reader.ReadS16()
+	return proto, reader, err
+}
+
+// 读取下一个指定协议的数据包，跳过Agent主动发起的ping
+func (c *test_client) expect(want int16) *PACKET.Packet {
+	for {
+		proto, reader, err := c.recv()
+		if err != nil {
+			c.t.Fatalf("waiting for %v: %v", MSGDEFINE.RCode[want], err)
+		}
+		if proto == MSGDEFINE.Code["server_ping_ack"] {
+			continue
+		}
+		if proto != want {
+			c.t.Fatalf("got %v want %v", MSGDEFINE.RCode[proto], MSGDEFINE.RCode[want])
+		}
+		return reader
+	}
+}
+
+// 等待被踢下线，检查原因后连接被关闭
+func (c *test_client) expect_kick(code int32) {
+	info, _ := MSGDEFINE.PKT_error_info(c.expect(MSGDEFINE.Code["user_kicked_ack"]))
+	if info.F_code != code {
+		c.t.Errorf("kick code got %v want %v (%v)", info.F_code, code, info.F_msg)
+	}
+	if proto, _, err := c.recv(); err == nil {
+		c.t.Errorf("connection still open after kick, got %v", MSGDEFINE.RCode[proto])
+	}
+}
+
+func (c *test_client) login(udid string) int32 {
+	c.send(MSGDEFINE.Code["user_login_req"], MSGDEFINE.S_user_login_info{F_login_way: MSGDEFINE.LOGIN_WAY_UDID, F_open_udid: udid})
+	snapshot, _ := MSGDEFINE.PKT_user_snapshot(c.expect(MSGDEFINE.Code["user_login_succeed_ack"]))
+	if snapshot.F_uid == 0 || snapshot.F_resume_token == "" {
+		c.t.Fatal("bad login ack", snapshot)
+	}
+	return snapshot.F_uid
+}
+
+func (c *test_client) ping(id int32) {
+	c.send(MSGDEFINE.Code["proto_ping_req"], MSGDEFINE.S_auto_id{F_id: id})
+	ack, _ := MSGDEFINE.PKT_auto_id(c.expect(MSGDEFINE.Code["proto_ping_ack"]))
+	if ack.F_id != id {
+		c.t.Errorf("ping ack got %v want %v", ack.F_id, id)
+	}
+}
+
+//---------------------------------------------
+func TestAgentForward(t *testing.T) {
+	game := func_Setup(t)
+	agent := func_StartAgent(t, game)
+	defer func_StopAgent(t, agent)
+
+	c := func_Dial(t, agent)
+	defer c.conn.Close()
+
+	// 登陆前不允许游戏协议
+	c.send(MSGDEFINE.Code["proto_ping_req"], MSGDEFINE.S_auto_id{F_id: 1})
+	info, _ := MSGDEFINE.PKT_error_info(c.expect(MSGDEFINE.Code["client_error_ack"]))
+	if info.F_code != MSGDEFINE.ERR_PROTO_NOT_ALLOWED {
+		t.Error("proto before login got", info)
+	}
+
+	c.login("forward")
+	c.send(MSGDEFINE.Code["heart_beat_req"], MSGDEFINE.S_auto_id{F_id: 7})
+	c.expect(MSGDEFINE.Code["heart_beat_ack"])
+	for i := int32(1); i <= 3; i++ {
+		c.ping(i)
+	}
+	if n := agent.SessionCount(); n != 1 {
+		t.Error("session count got", n)
+	}
+}
+
+//---------------------------------------------
+func TestAgentKick(t *testing.T) {
+	game := func_Setup(t)
+	agent := func_StartAgent(t, game)
+	defer func_StopAgent(t, agent)
+
+	c := func_Dial(t, agent)
+	defer c.conn.Close()
+	userid := c.login("kick")
+	c.ping(1) // 确保游戏服已经收到流
+
+	game.kick(t, userid)
+	c.expect_kick(MSGDEFINE.ERR_KICK_GAME)
+}
+
+//---------------------------------------------
+// 发包频率超限延迟处理的数据包不阻塞会话，等待期间游戏服的踢人立即生效
+func TestAgentLimitDelay(t *testing.T) {
+	game := func_Setup(t)
+	agent := func_StartAgent(t, game)
+	defer func_StopAgent(t, agent)
+
+	if err := LIMITER.Init("", "", []string{"1001=1:1:delay"}); err != nil {
+		t.Fatal(err)
+	}
+	defer LIMITER.Init("", "", nil)
+
+	c := func_Dial(t, agent)
+	defer c.conn.Close()
+	userid := c.login("delay")
+	c.ping(1)
+	// 第二个ping需要等待1秒，确保会话已经收到后再踢人
+	c.send(MSGDEFINE.Code["proto_ping_req"], MSGDEFINE.S_auto_id{F_id: 2})
+	TIME.Sleep(100 * TIME.Millisecond)
+
+	start := TIME.Now()
+	game.kick(t, userid)
+	c.expect_kick(MSGDEFINE.ERR_KICK_GAME)
+	if elapsed := TIME.Since(start); elapsed > 500*TIME.Millisecond {
+		t.Error("kick blocked by delayed packet:", elapsed)
+	}
+}
+
+//---------------------------------------------
+// 游戏服流异常中断后切换到另一台游戏服，客户端连接保持不变
+func TestAgentFailover(t *testing.T) {
+	game := func_Setup(t)
+	agent := func_StartAgent(t, game)
+	defer func_StopAgent(t, agent)
+
+	c := func_Dial(t, agent)
+	defer c.conn.Close()
+	c.login("failover")
+	c.ping(1)
+
+	c.send(TEST_PROTO_FAIL, MSGDEFINE.S_auto_id{})
+	c.expect(MSGDEFINE.Code["game_lost_ack"])
+	info, _ := MSGDEFINE.PKT_error_info(c.expect(MSGDEFINE.Code["game_restored_ack"]))
+	if info.F_msg != TEST_GAME_ID2 {
+		t.Error("restored to", info.F_msg)
+	}
+	c.ping(2)
+}
+
+//---------------------------------------------
+// 发送到游戏服失败时同样进行故障转移，失败的消息被拒绝，客户端不会被踢掉
+func TestAgentFailoverSend(t *testing.T) {
+	game := func_Setup(t)
+	agent := func_StartAgent(t, game)
+	defer func_StopAgent(t, agent)
+
+	c := func_Dial(t, agent)
+	defer c.conn.Close()
+	userid := c.login("failover-send")
+	c.ping(1)
+
+	// 流被正常关闭，读取协程不会通知中断
+	c.send(TEST_PROTO_CLOSE, MSGDEFINE.S_auto_id{})
+	select {
+	case id := <-game.closed:
+		if id != userid {
+			t.Fatal("closed stream of", id)
+		}
+	case <-TIME.After(TEST_TIMEOUT):
+		t.Fatal("game stream not closed")
+	}
+
+	// 流结束后gRPC的发送仍可能成功(消息被丢弃)，重复发送直到Agent发现发送失败
+	for id := int32(2); ; id++ {
+		if id > 20 {
+			t.Fatal("send failure not detected")
+		}
+		c.send(MSGDEFINE.Code["proto_ping_req"], MSGDEFINE.S_auto_id{F_id: id})
+		proto, reader, err := c.recv_timeout(100 * TIME.Millisecond)
+		if err, ok := err.(NET.Error); ok && err.Timeout() {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if proto == MSGDEFINE.Code["server_ping_ack"] {
+			continue
+		}
+		if proto != MSGDEFINE.Code["client_error_ack"] {
+			t.Fatal("got", MSGDEFINE.RCode[proto])
+		}
+		if info, _ := MSGDEFINE.PKT_error_info(reader); info.F_code != MSGDEFINE.ERR_GAME_SERVICE_LOST {
+			t.Error("error code got", info.F_code)
+		}
+		break
+	}
+	c.expect(MSGDEFINE.Code["game_lost_ack"])
+	c.expect(MSGDEFINE.Code["game_restored_ack"])
+	c.ping(100)
+}
+
+//---------------------------------------------
+// 游戏服以外的后端服务发来的踢人与切换游戏服被忽略
+func TestAgentServiceFrames(t *testing.T) {
+	game := func_Setup(t)
+	agent := func_StartAgent(t, game)
+	defer func_StopAgent(t, agent)
+
+	c := func_Dial(t, agent)
+	defer c.conn.Close()
+	userid := c.login("service-frames")
+	c.ping(1)
+	game.mu.Lock()
+	before := game.opened[userid]
+	game.mu.Unlock()
+
+	c.send(TEST_PROTO_OTHER, MSGDEFINE.S_auto_id{})
+	TIME.Sleep(100 * TIME.Millisecond)
+	c.ping(2)
+
+	game.mu.Lock()
+	opened := game.opened[userid] - before
+	game.mu.Unlock()
+	if opened != 1 { // 只有到TEST_SERVICE的流，没有因切换游戏服开启新的流
+		t.Error("streams opened got", opened)
+	}
+}
+
+//---------------------------------------------
+// 原连接还未断开时在新连接上恢复会话，原连接被直接关闭，不下发踢人原因
+func TestAgentResume(t *testing.T) {
+	game := func_Setup(t)
+	agent := func_StartAgent(t, game)
+	defer func_StopAgent(t, agent)
+
+	c1 := func_Dial(t, agent)
+	defer c1.conn.Close()
+	c1.send(MSGDEFINE.Code["user_login_req"], MSGDEFINE.S_user_login_info{F_login_way: MSGDEFINE.LOGIN_WAY_UDID, F_open_udid: "resume"})
+	snapshot, _ := MSGDEFINE.PKT_user_snapshot(c1.expect(MSGDEFINE.Code["user_login_succeed_ack"]))
+	c1.ping(1)
+
+	c2 := func_Dial(t, agent)
+	defer c2.conn.Close()
+	c2.send(MSGDEFINE.Code["session_resume_req"], MSGDEFINE.S_resume_info{F_token: snapshot.F_resume_token, F_count: 2})
+	ack, _ := MSGDEFINE.PKT_resume_info(c2.expect(MSGDEFINE.Code["session_resume_ack"]))
+	c2.seq = uint32(ack.F_count)
+	c2.ping(2)
+
+	if proto, _, err := c1.recv(); err == nil {
+		t.Error("old connection still open, got", MSGDEFINE.RCode[proto])
+	}
+}
+
+//---------------------------------------------
+// 来自可信网段的TCP连接必须以PROXY协议头开始，WebSocket连接不解析协议头
+func TestAgentProxyTrusted(t *testing.T) {
+	game := func_Setup(t)
+	if err := PROXY.Init([]string{"127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	defer PROXY.Init(nil)
+
+	tcp, err := NET.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, err := NET.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := func_TestConfig(game)
+	cfg.TCPListener, cfg.WSListener = tcp, ws
+	agent := NewAgent(cfg)
+	if err := agent.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func_StopAgent(t, agent)
+
+	conn, err := NET.Dial("tcp", tcp.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("PROXY TCP4 10.1.2.3 127.0.0.1 40000 8888\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	c := func_Handshake(t, conn)
+	c.login("proxy-tcp")
+	c.ping(1)
+
+	raw, err := NET.Dial("tcp", ws.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	wsconn, err := WEBSOCKET.Client(raw, ws.Addr().String(), "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = func_Handshake(t, wsconn)
+	c.login("proxy-ws")
+	c.ping(1)
+}
+
+//---------------------------------------------
+// 未完成WebSocket升级握手的连接超时后被关闭，已升级的连接不受握手超时影响
+func TestAgentWebSocketHandshakeTimeout(t *testing.T) {
+	game := func_Setup(t)
+	ws, err := NET.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := func_TestConfig(game)
+	cfg.WSListener, cfg.WSHandshakeTimeout = ws, 100*TIME.Millisecond
+	agent := NewAgent(cfg)
+	if err := agent.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func_StopAgent(t, agent)
+
+	// 只发送一半请求头
+	slow, err := NET.Dial("tcp", ws.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Close()
+	if _, err := slow.Write([]byte("GET /ws HTTP/1.1\r\nHost: test\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	slow.SetReadDeadline(TIME.Now().Add(TEST_TIMEOUT))
+	if _, err := slow.Read(make([]byte, 1)); err == nil {
+		t.Error("incomplete handshake got a response")
+	} else if e, ok := err.(NET.Error); ok && e.Timeout() {
+		t.Error("incomplete handshake not closed")
+	}
+
+	raw, err := NET.Dial("tcp", ws.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	wsconn, err := WEBSOCKET.Client(raw, ws.Addr().String(), "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	TIME.Sleep(3 * cfg.WSHandshakeTimeout)
+	c := func_Handshake(t, wsconn)
+	c.login("ws-timeout")
+	c.ping(1)
+}
+
+//---------------------------------------------
+// 会话状态不允许的协议同样受发包频率限制
+func TestAgentACLLimited(t *testing.T) {
+	game := func_Setup(t)
+	agent := func_StartAgent(t, game)
+	defer func_StopAgent(t, agent)
+
+	if err := LIMITER.Init("1:3:kick", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	defer LIMITER.Init("", "", nil)
+
+	c := func_Dial(t, agent) // 握手消耗一个令牌
+	defer c.conn.Close()
+	for i := int32(1); i <= 2; i++ {
+		c.send(MSGDEFINE.Code["proto_ping_req"], MSGDEFINE.S_auto_id{F_id: i})
+		info, _ := MSGDEFINE.PKT_error_info(c.expect(MSGDEFINE.Code["client_error_ack"]))
+		if info.F_code != MSGDEFINE.ERR_PROTO_NOT_ALLOWED {
+			t.Error("error code got", info.F_code)
+		}
+	}
+	c.send(MSGDEFINE.Code["proto_ping_req"], MSGDEFINE.S_auto_id{F_id: 3})
+	c.expect_kick(MSGDEFINE.ERR_KICK_RATE_LIMITED)
+}
+
+//---------------------------------------------
+// 同一进程中的两个Agent共享在线表，在另一个Agent上重复登陆时踢掉旧会话
+func TestAgentDuplicateLogin(t *testing.T) {
+	game := func_Setup(t)
+	a1 := func_StartAgent(t, game)
+	defer func_StopAgent(t, a1)
+	a2 := func_StartAgent(t, game)
+	defer func_StopAgent(t, a2)
+
+	c1 := func_Dial(t, a1)
+	defer c1.conn.Close()
+	uid1 := c1.login("duplicate")
+
+	c2 := func_Dial(t, a2)
+	defer c2.conn.Close()
+	if uid2 := c2.login("duplicate"); uid2 != uid1 {
+		t.Fatalf("same udid got userid %v and %v", uid1, uid2)
+	}
+
+	c1.expect_kick(MSGDEFINE.ERR_KICK_DUPLICATE_LOGIN)
+	c2.ping(1)
+}
+
+//---------------------------------------------
+func TestAgentStop(t *testing.T) {
+	game := func_Setup(t)
+	agent := func_StartAgent(t, game)
+	other := func_StartAgent(t, game)
+	defer func_StopAgent(t, other)
+
+	c := func_Dial(t, agent)
+	defer c.conn.Close()
+	c.login("stop")
+	c2 := func_Dial(t, other)
+	defer c2.conn.Close()
+	c2.login("stop-other")
+
+	func_StopAgent(t, agent)
+	c.expect_kick(MSGDEFINE.ERR_KICK_MAINTENANCE)
+	if n := agent.SessionCount(); n != 0 {
+		t.Error("session count after stop got", n)
+	}
+	if conn, err := NET.Dial("tcp", agent.Addr().String()); err == nil {
+		conn.Close()
+		t.Error("listener still open after stop")
+	}
+
+	// 其他Agent不受影响
+	c2.ping(1)
+}
+
+//---------------------------------------------
+func TestAgentDrain(t *testing.T) {
+	game := func_Setup(t)
+	agent := func_StartAgent(t, game)
+	defer func_StopAgent(t, agent)
+
+	c := func_Dial(t, agent)
+	defer c.conn.Close()
+	c.login("drain")
+
+	if !agent.Drain(TIME.Millisecond, "127.0.0.1:9999", "") || agent.Drain(0, "", "") {
+		t.Error("drain should start only once")
+	}
+	info, _ := MSGDEFINE.PKT_migrate_info(c.expect(MSGDEFINE.Code["server_migrate_ack"]))
+	if info.F_addr != "127.0.0.1:9999" || info.F_msg != DEFAULT_MIGRATE_MSG {
+		t.Error("migrate got", info)
+	}
+	c.expect_kick(MSGDEFINE.ERR_KICK_MAINTENANCE)
+
+	select {
+	case <-agent.Done():
+	case <-TIME.After(TEST_TIMEOUT):
+		t.Fatal("agent not closed after drain")
+	}
+	if !agent.Draining() {
+		t.Error("agent should be draining")
+	}
+}
+
+//---------------------------------------------
+// 排空期间断开的客户端无法再恢复到本Agent，会话直接结束，不必等到超时
+func TestAgentDrainDetached(t *testing.T) {
+	game := func_Setup(t)
+	agent := func_StartAgent(t, game)
+	defer func_StopAgent(t, agent)
+
+	detached := func_Dial(t, agent)
+	detached.login("drain-detached")
+	detached.conn.Close()
+	c := func_Dial(t, agent)
+	defer c.conn.Close()
+	c.login("drain-migrate")
+	TIME.Sleep(100 * TIME.Millisecond) // 等待已断开的会话进入等待恢复
+
+	start := TIME.Now()
+	agent.Drain(2*TEST_TIMEOUT, "", "")
+	c.expect(MSGDEFINE.Code["server_migrate_ack"])
+	c.conn.Close()
+
+	select {
+	case <-agent.Done():
+	case <-TIME.After(TEST_TIMEOUT):
+		t.Fatal("drain waited for detached sessions")
+	}
+	if elapsed := TIME.Since(start); elapsed > 3*TIME.Second {
+		t.Error("drain took", elapsed)
+	}
+}
+
+//---------------------------------------------
+// 低于最低版本的客户端收到下载地址并且无法登陆，更高版本的客户端按最高版本通信
+func TestAgentVersion(t *testing.T) {
+	game := func_Setup(t)
+	agent := func_StartAgent(t, game)
+	defer func_StopAgent(t, agent)
+
+	policy, err := VERSION.NewPolicy("2-3", "https://example.com/download", []string{"datagram:3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer VERSION.Func_SetPolicy(VERSION.Func_Policy())
+	VERSION.Func_SetPolicy(policy)
+
+	old := func_Dial(t, agent)
+	defer old.conn.Close()
+	old.send(MSGDEFINE.Code["client_version_req"], MSGDEFINE.S_version_info{F_version: 1})
+	update, _ := MSGDEFINE.PKT_update_info(old.expect(MSGDEFINE.Code["client_version_faild_ack"]))
+	if update.F_code != MSGDEFINE.ERR_VERSION_TOO_OLD || update.F_url != policy.URL {
+		t.Error("update got", update)
+	}
+	old.send(MSGDEFINE.Code["user_login_req"], MSGDEFINE.S_user_login_info{F_login_way: MSGDEFINE.LOGIN_WAY_UDID, F_open_udid: "version-old", F_client_version: 1})
+	info, _ := MSGDEFINE.PKT_error_info(old.expect(MSGDEFINE.Code["user_login_faild_ack"]))
+	if info.F_code != MSGDEFINE.ERR_VERSION_TOO_OLD || info.F_msg != policy.URL {
+		t.Error("login got", info)
+	}
+
+	c := func_Dial(t, agent)
+	defer c.conn.Close()
+	c.send(MSGDEFINE.Code["client_version_req"], MSGDEFINE.S_version_info{F_version: 5})
+	ack, _ := MSGDEFINE.PKT_version_info(c.expect(MSGDEFINE.Code["client_version_ack"]))
+	if ack.F_version != 3 || ack.F_min_version != 2 || ack.F_max_version != 3 {
+		t.Error("version ack got", ack)
+	}
+	userid := c.login("version-new")
+	c.ping(1)
+
+	game.mu.Lock()
+	version := game.versions[userid]
+	game.mu.Unlock()
+	if version != "3" {
+		t.Errorf("game got version %q want 3", version)
+	}
+}
+
+//---------------------------------------------
+// Agent只向配置了server_ping的客户端版本主动发起ping，旧客户端不会收到无法识别的协议
+func TestAgentServerPing(t *testing.T) {
+	game := func_Setup(t)
+	lis, err := NET.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := func_TestConfig(game)
+	cfg.TCPListener, cfg.PingInterval = lis, 50*TIME.Millisecond
+	agent := NewAgent(cfg)
+	if err := agent.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func_StopAgent(t, agent)
+
+	old := func_Dial(t, agent)
+	defer old.conn.Close()
+	old.login("server-ping-old")
+	TIME.Sleep(200 * TIME.Millisecond)
+	old.send(MSGDEFINE.Code["heart_beat_req"], MSGDEFINE.S_auto_id{F_id: 1})
+	if proto, _, err := old.recv(); err != nil || proto != MSGDEFINE.Code["heart_beat_ack"] {
+		t.Error("legacy client got", MSGDEFINE.RCode[proto], err)
+	}
+
+	policy, err := VERSION.NewPolicy("", "", []string{"server_ping:2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer VERSION.Func_SetPolicy(VERSION.Func_Policy())
+	VERSION.Func_SetPolicy(policy)
+
+	c := func_Dial(t, agent)
+	defer c.conn.Close()
+	c.send(MSGDEFINE.Code["client_version_req"], MSGDEFINE.S_version_info{F_version: 2})
+	c.expect(MSGDEFINE.Code["client_version_ack"])
+	c.login("server-ping-new")
+	if proto, _, err := c.recv(); err != nil || proto != MSGDEFINE.Code["server_ping_ack"] {
+		t.Error("client with server_ping got", MSGDEFINE.RCode[proto], err)
+	}
+}
+
+//---------------------------------------------
+// 没有任何后端服务实例的Dialer
+type empty_dialer struct{}
+
+func (empty_dialer) Ids(service string) []string              { return nil }
+func (empty_dialer) Dial(service, id string) *GRPC.ClientConn { return nil }
+func (empty_dialer) Watch(service string, ch chan string)     {}
+
+//---------------------------------------------
+// 同一进程中的两个Agent各自使用自己的Dialer，后启动的Agent不影响先启动的Agent
+func TestAgentDialer(t *testing.T) {
+	game := func_Setup(t)
+	agent := func_StartAgent(t, game)
+	defer func_StopAgent(t, agent)
+
+	lis, err := NET.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := func_TestConfig(game)
+	cfg.TCPListener, cfg.Dialer = lis, empty_dialer{}
+	empty := NewAgent(cfg)
+	if err := empty.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func_StopAgent(t, empty)
+
+	e := func_Dial(t, empty)
+	defer e.conn.Close()
+	e.send(MSGDEFINE.Code["user_login_req"], MSGDEFINE.S_user_login_info{F_login_way: MSGDEFINE.LOGIN_WAY_UDID, F_open_udid: "dialer-empty"})
+	info, _ := MSGDEFINE.PKT_error_info(e.expect(MSGDEFINE.Code["user_login_faild_ack"]))
+	if info.F_code != MSGDEFINE.ERR_LOGIN_NO_GAME_SERVER {
+		t.Error("login without game got", info)
+	}
+
+	c := func_Dial(t, agent)
+	defer c.conn.Close()
+	c.login("dialer")
+	c.ping(1)
+}
+
+//---------------------------------------------
@@ -4,44 +4,142 @@ package framework
 //---------------------------------------------
 import (
 	BINARY "encoding/binary"
+	EXPVAR "expvar"
 	NET "net"
+	TIME "time"
 
+	MSGDEFINE "FKGoServer/FKLib_Common/MsgDefine"
 	PACKET "FKGoServer/FKLib_Common/Packet"
 	UTILS "FKGoServer/FKLib_Common/Utils"
+	CAPTURE "FKGoServer/FKServer_Agent/Capture"
 	SESSION "FKGoServer/FKServer_Agent/Session"
 
 	LOG "github.com/Sirupsen/logrus"
+	CLI "gopkg.in/urfave/cli.v2"
+)
+
+//---------------------------------------------
+var (
+	// 发送队列配置，见 --out-queue-packets 等参数
+	_queue_config = SESSION.QueueConfig{
+		MaxPackets: SESSION.DEFAULT_QUEUE_PACKETS,
+		MaxBytes:   SESSION.DEFAULT_QUEUE_BYTES,
+	}
+	// 写入超时
+	_write_timeout = CONST_WriteDeadline * TIME.Second
+	// dropped, coalesced, kicked, write_failed
+	_queue_counters = EXPVAR.NewMap("outqueue")
 )
 
 //---------------------------------------------
 // 发送给客户端的数据包对象
 type Buffer struct {
-	ctrl    chan struct{} // 用以接收exit消息
-	pending chan []byte   // 实际需要发送的数据缓冲
-	conn    NET.Conn      // 网络连接对象
-	cache   []byte        // 留作系统写入的缓冲
+	ctrl   chan struct{}  // 用以接收连接关闭消息
+	queue  *SESSION.Queue // 有界发送队列
+	conn   NET.Conn       // 网络连接对象
+	cache  []byte         // 留作系统写入的缓冲
+	plain  []byte         // 加密用的缓冲，发送协程复用
+	failed bool           // 写入失败后连接已关闭，丢弃之后的数据包
+}
+
+//---------------------------------------------
+// 读取发送队列配置
+func func_InitSendQueue(c *CLI.Context) {
+	policy, err := SESSION.ParsePolicy(c.String("out-policy"))
+	if err != nil {
+		LOG.Fatal("未知的慢客户端处理策略:", c.String("out-policy"))
+	}
+	droppable, err := SESSION.ParseRanges(c.StringSlice("out-droppable"))
+	if err != nil {
+		LOG.Fatal("可丢弃协议号区间格式错误:", c.StringSlice("out-droppable"))
+	}
+	_queue_config = SESSION.QueueConfig{
+		MaxPackets: c.Int("out-queue-packets"),
+		MaxBytes:   c.Int("out-queue-bytes"),
+		Policy:     policy,
+		Droppable:  droppable,
+	}
+	_write_timeout = c.Duration("write-timeout")
+	LOG.Printf("发送队列上限:%v个/%v字节 慢客户端策略:%v 写入超时:%v", _queue_config.MaxPackets, _queue_config.MaxBytes, c.String("out-policy"), _write_timeout)
 }
 
 //---------------------------------------------
 // 组包并压入发送栈
+// 已登陆的会话同时记录到重传缓冲；连接断开等待恢复期间buf为nil，只记录不发送
+// 客户端接收过慢导致队列已满时，按 --out-policy 丢弃、覆盖数据包或踢掉客户端
 func (buf *Buffer) func_CreateAndSendMsgPacket(sess *SESSION.Session, data []byte) {
 	// 如果需要发送的数据为空
 	if data == nil {
 		return
 	}
+	func_CapturePacket(sess, CAPTURE.DIR_OUT, data)
+	if buf == nil {
+		// 记录明文，客户端恢复会话时补发
+		if sess.Outbox != nil {
+			sess.Outbox.Push(data)
+		}
+		return
+	}
+
+	p := buf.func_NewPacket(sess, data)
+	if sess.Outbox != nil {
+		p.Seq = sess.Outbox.Count() + 1
+	}
+	result, old := buf.queue.Offer(p)
+	switch result {
+	case SESSION.QUEUE_OK:
+		if sess.Outbox != nil {
+			sess.Outbox.Push(data)
+		}
+	case SESSION.QUEUE_COALESCED: // 重传缓冲中被覆盖的包同样替换为最新内容
+		_queue_counters.Add("coalesced", 1)
+		if sess.Outbox != nil {
+			sess.Outbox.Replace(old.Seq, data)
+		}
+	case SESSION.QUEUE_DROPPED:
+		_queue_counters.Add("dropped", 1)
+	case SESSION.QUEUE_FULL:
+		_queue_counters.Add("kicked", 1)
+		packets, bytes := buf.queue.Len()
+		LOG.Warningf("客户端接收过慢，发送队列已满，踢掉客户端 userid:%v 会话IP:%v 队列:%v个/%v字节", sess.UserId, sess.IP, packets, bytes)
+		sess.Kick(MSGDEFINE.ERR_KICK_SLOW_CLIENT, "send queue full")
+	}
+}
+
+//---------------------------------------------
+// 压入发送栈，不记录到重传缓冲，也不受队列上限限制
+func (buf *Buffer) func_EncryptAndSendPacket(sess *SESSION.Session, data []byte) {
+	buf.queue.Push(buf.func_NewPacket(sess, data))
+}
+
+//---------------------------------------------
+// 被踢掉的会话在关闭连接前下发原因，不记录到重传缓冲
+func (buf *Buffer) func_SendKickPacket(sess *SESSION.Session) {
+	if sess.Flag&SESSION.SESS_KICKED_OUT == 0 || sess.KickCode == 0 {
+		return
+	}
+	p := buf.func_NewPacket(sess, PACKET.Func_Pack(MSGDEFINE.Code["user_kicked_ack"],
+		MSGDEFINE.S_error_info{F_code: sess.KickCode, F_msg: sess.KickReason}, nil))
+	p.Final = true
+	buf.queue.Push(p)
+}
 
-	// 进行加密
-	// (NOT_ENCRYPTED) -> KEYEXCG -> ENCRYPT
-	if sess.Flag&SESSION.SESS_ENCRYPT != 0 { // 开启加密
-		sess.Encoder.XORKeyStream(data, data)
+//---------------------------------------------
+// 生成待发送的数据包，决定是否加密
+// (NOT_ENCRYPTED) -> KEYEXCG -> ENCRYPT
+// 加密在发送协程中按发送顺序进行，被丢弃或覆盖的包不会打乱加密器的状态
+func (buf *Buffer) func_NewPacket(sess *SESSION.Session, data []byte) *SESSION.Packet {
+	p := &SESSION.Packet{Data: data}
+	if len(data) >= 2 {
+		p.Proto = int16(BINARY.BigEndian.Uint16(data))
+	}
+	if sess.Flag&SESSION.SESS_ENCRYPT != 0 { // 开启加密，协商了压缩算法时先压缩再加密
+		p.Encoder, p.Compressor = sess.Encoder, sess.Compressor
 	} else if sess.Flag&SESSION.SESS_KEYEXCG != 0 { // Key发生更变，当前还不能进行加密
 		sess.Flag &^= SESSION.SESS_KEYEXCG
 		sess.Flag |= SESSION.SESS_ENCRYPT
 	}
-
-	// 将数据压送到发送队列中
-	buf.pending <- data
-	return
+	return p
 }
 
 //---------------------------------------------
@@ -50,10 +148,17 @@ func (buf *Buffer) func_StartSendPacket() {
 	defer UTILS.Func_PrintPanicStack()
 	for {
 		select {
-		case data := <-buf.pending:
-			buf.func_EncapsulationAndSendPacket(data)
-		case <-buf.ctrl: // 接收到会话结束消息
-			close(buf.pending)
+		case <-buf.queue.Wait():
+			for _, p := range buf.queue.Pop() {
+				buf.func_SealAndSendPacket(p)
+			}
+		case <-buf.ctrl: // 接收到连接关闭消息
+			// 未发送的数据包中只发出踢掉原因，其余丢弃
+			for _, p := range buf.queue.Pop() {
+				if p.Final {
+					buf.func_SealAndSendPacket(p)
+				}
+			}
 			// 关闭本连接
 			buf.conn.Close()
 			return
@@ -61,18 +166,40 @@ func (buf *Buffer) func_StartSendPacket() {
 	}
 }
 
+//---------------------------------------------
+// 压缩、加密后发送
+func (buf *Buffer) func_SealAndSendPacket(p *SESSION.Packet) {
+	data := p.Data
+	if p.Encoder != nil {
+		if p.Compressor != nil {
+			data = p.Compressor.Compress(data)
+		}
+		// 加密在原缓冲上进行，而明文同时保存在重传缓冲中，所以加密副本
+		buf.plain = p.Encoder.Seal(append(buf.plain[:0], data...))
+		data = buf.plain
+	}
+	buf.func_EncapsulationAndSendPacket(data)
+}
+
 //---------------------------------------------
 // 进行包封装并发送
+// 写入超时或失败时关闭连接，读取协程随之退出，会话进入断线流程
 func (buf *Buffer) func_EncapsulationAndSendPacket(data []byte) bool {
-	// 进行包组装
-	sz := len(data)
-	BINARY.BigEndian.PutUint16(buf.cache, uint16(sz))
-	copy(buf.cache[2:], data)
+	if buf.failed {
+		return false
+	}
+
+	// 进行包组装，超过65535字节的消息使用扩展帧
+	frames := PACKET.AppendFrames(buf.cache[:0], data)
 
 	// 写入包
-	n, err := buf.conn.Write(buf.cache[:sz+2])
+	buf.conn.SetWriteDeadline(TIME.Now().Add(_write_timeout))
+	n, err := buf.conn.Write(frames)
 	if err != nil {
 		LOG.Warningf("写入发送包失败, 写入大小: %v 错误原因: %v", n, err)
+		_queue_counters.Add("write_failed", 1)
+		buf.failed = true
+		buf.conn.Close()
 		return false
 	}
 
@@ -83,7 +210,7 @@ func (buf *Buffer) func_EncapsulationAndSendPacket(data []byte) bool {
 // 为一个会话创建一个写入缓冲区
 func func_CreateWriteBuffer(conn NET.Conn, ctrl chan struct{}) *Buffer {
 	buf := Buffer{conn: conn}
-	buf.pending = make(chan []byte)
+	buf.queue = SESSION.NewQueue(&_queue_config)
 	buf.ctrl = ctrl
 	buf.cache = make([]byte, PACKET.PACKET_LIMIT+2)
 	return &buf
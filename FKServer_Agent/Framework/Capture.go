@@ -0,0 +1,46 @@
+//---------------------------------------------
+package framework
+
+//---------------------------------------------
+import (
+	BINARY "encoding/binary"
+	TIME "time"
+
+	CAPTURE "FKGoServer/FKServer_Agent/Capture"
+	SESSION "FKGoServer/FKServer_Agent/Session"
+
+	LOG "github.com/Sirupsen/logrus"
+)
+
+//---------------------------------------------
+// 记录一个明文数据包 PROTO|PAYLOAD，会话未开启抓包时忽略
+// 写入失败时停止本会话的抓包，不影响正常收发
+func func_CapturePacket(sess *SESSION.Session, dir byte, data []byte) {
+	if sess.Capture == nil || len(data) < 2 {
+		return
+	}
+	r := &CAPTURE.Record{
+		Time:   TIME.Now(),
+		Dir:    dir,
+		UserId: sess.UserId,
+		Proto:  int16(BINARY.BigEndian.Uint16(data)),
+		Data:   data,
+	}
+	if err := sess.Capture.Write(r); err != nil {
+		LOG.Warningf("写入抓包文件失败，停止抓包 userid:%v 错误原因:%v", sess.UserId, err)
+		func_CloseCapture(sess)
+	}
+}
+
+//---------------------------------------------
+func func_CloseCapture(sess *SESSION.Session) {
+	if sess.Capture == nil {
+		return
+	}
+	if err := sess.Capture.Close(); err != nil {
+		LOG.Warningf("关闭抓包文件失败 userid:%v 错误原因:%v", sess.UserId, err)
+	}
+	sess.Capture = nil
+}
+
+//---------------------------------------------
@@ -5,67 +5,176 @@ package framework
 import (
 	TIME "time"
 
+	MSGDEFINE "FKGoServer/FKLib_Common/MsgDefine"
 	UTILS "FKGoServer/FKLib_Common/Utils"
+	BACKEND "FKGoServer/FKServer_Agent/Backend"
+	DATAGRAM "FKGoServer/FKServer_Agent/Datagram"
+	LIMITER "FKGoServer/FKServer_Agent/Limiter"
 	PROTO "FKGoServer/FKServer_Agent/Proto"
 	SESSION "FKGoServer/FKServer_Agent/Session"
+
+	LOG "github.com/Sirupsen/logrus"
 )
 
 //---------------------------------------------
 // 处理一个客户端会话的全部事务
-func func_ClientSessionHandler(sess *SESSION.Session, in chan []byte, out *Buffer) {
-	defer SYNC_WAITGROUP.Done()        // 无论如何，最终要删除一个引用，避免程序无法退出
+// ctrl为当前连接的关闭信号，连接断开后已登陆的会话保留CONST_ResumeGrace秒，等待客户端在新连接上恢复
+func (a *Agent) func_ClientSessionHandler(sess *SESSION.Session, in chan []byte, out *Buffer, ctrl chan struct{}) {
+	defer a.wg.Done()                  // 无论如何，最终要删除一个引用，避免程序无法退出
 	defer UTILS.Func_PrintPanicStack() // 无论如何，最重要打印引发异常的堆栈
 
 	// 初始化会话
-	sess.MQ = make(chan PROTO.Game_Frame, 512)
+	sess.Backend = a.backend
+	sess.MQ = make(chan SESSION.Frame, 512)
+	sess.Streams = make(map[string]PROTO.GameService_StreamClient)
+	sess.GameLost = make(chan PROTO.GameService_StreamClient, 1)
+	sess.GameRestored = make(chan SESSION.GameStream)
+	sess.Takeover = make(chan chan struct{})
+	sess.Limiter = LIMITER.NewSession()
+	sess.Admin = make(chan SESSION.Command, SESSION.DEFAULT_ADMIN_QUEUE)
 	sess.ConnectTime = TIME.Now()
 	sess.LastPacketTime = TIME.Now()
 	// 创建一分钟定时器消息
 	min_timer := TIME.After(TIME.Minute)
+	// 客户端ping定时器
+	ping_timer := TIME.After(a.cfg.PingInterval)
+	// 连接断开后等待恢复的超时
+	var grace <-chan TIME.Time
+	// 会话是否已经交给新连接
+	handover := false
+	// 发包频率超限而延迟处理的数据包，等待期间暂停读取客户端消息(recv为nil)以保持顺序
+	recv := in
+	var pending *pending_msg
+	var pending_timer <-chan TIME.Time
+
+	// 加入在线表，供运维接口查询与排空
+	SESSION.Func_AddOnline(sess)
+	a.online.Add(sess)
 
 	// 线程创建完毕，无论如何，最终要进行清理行为
 	defer func() {
-		close(sess.Die)
-		if sess.Stream != nil {
-			sess.Stream.CloseSend()
+		if ctrl != nil {
+			// 踢掉的原因作为最后一个数据包，在关闭连接前发出
+			out.func_SendKickPacket(sess)
+			close(ctrl)
+		}
+		if !handover {
+			a.func_CloseSession(sess)
 		}
 	}()
 
 	/* 主消息循环
 	1： 负责接收客户端发来的消息
-	2： 负责接收游戏服务器发来的消息
-	3： 负责定时器
-	4： 负责服务器关闭信号处理
+	2： 负责延迟处理发包频率超限的数据包
+	3： 负责接收游戏服务器发来的消息
+	4： 负责转发不可靠通道收到的数据报
+	5： 负责游戏服故障转移
+	6： 负责新连接恢复会话
+	7： 负责运维指令
+	8： 负责定时器(包括主动ping)
+	9： 负责服务器关闭信号处理
 	*/
 	for {
 		select {
-		case msg, ok := <-in: // 从网络来的客户端消息
+		case msg, ok := <-recv: // 从网络来的客户端消息
 			if !ok {
-				return
+				// 未登陆的会话直接结束，排空期间监听已经关闭，会话无法再恢复到本Agent，同样直接结束
+				if sess.Outbox == nil || a.Draining() {
+					return
+				}
+				// 关闭连接，保留会话等待客户端恢复
+				close(ctrl)
+				in, recv, out, ctrl = nil, nil, nil, nil
+				grace = TIME.After(CONST_ResumeGrace * TIME.Second)
+				LOG.Infof("连接断开，等待客户端恢复会话 userid:%v", sess.UserId)
+				continue
 			}
 
 			sess.PacketCount++
 			sess.PacketTime = TIME.Now()
 
-			if result := func_UserMsgHandler(sess, msg); result != nil {
-				out.func_CreateAndSendMsgPacket(sess, result)
+			result, p := a.func_UserMsgHandler(sess, msg)
+			if p != nil {
+				pending, recv = p, nil
+				pending_timer = TIME.After(p.delay)
+				continue
 			}
-			sess.LastPacketTime = sess.PacketTime
+			sess = a.func_OnUserMsgResult(sess, out, result)
+
+		case <-pending_timer: // 延迟的数据包到时处理，恢复读取客户端消息
+			result := a.func_DispatchMsg(sess, pending.proto, pending.data, pending.start)
+			pending, pending_timer, recv = nil, nil, in
+			sess = a.func_OnUserMsgResult(sess, out, result)
 
 		case frame := <-sess.MQ: // 从游戏服务器来的消息
 			switch frame.Type {
 			case PROTO.Game_Message:
 				out.func_CreateAndSendMsgPacket(sess, frame.Message)
-			case PROTO.Game_Kick:
-				sess.Flag |= SESSION.SESS_KICKED_OUT
+			case PROTO.Game_Broadcast: // 游戏服广播，只发给位于该游戏服的玩家
+				if frame.Target == sess.GSID {
+					out.func_CreateAndSendMsgPacket(sess, frame.Message)
+				}
+			case PROTO.Game_Datagram: // 通过不可靠通道发给客户端，客户端还未开启通道时丢弃
+				if err := DATAGRAM.Func_Send(sess.Datagram, frame.Message); err != nil {
+					LOG.Debugf("下发数据报失败 userid:%v 错误原因:%v", sess.UserId, err)
+				}
+			case PROTO.Game_Kick: // 游戏服未指定原因时使用默认错误码
+				if frame.Stream == nil || frame.Stream != sess.Stream {
+					LOG.Warningf("忽略非当前游戏服流发来的踢人 userid:%v", sess.UserId)
+					break
+				}
+				code := frame.Code
+				if code == 0 {
+					code = MSGDEFINE.ERR_KICK_GAME
+				}
+				sess.Kick(code, frame.Reason)
+			case PROTO.Game_Redirect: // 游戏服要求切换到另一台游戏服，客户端连接保持不变
+				if frame.Stream == nil || frame.Stream != sess.Stream {
+					LOG.Warningf("忽略非当前游戏服流发来的切换游戏服 userid:%v 目标游戏服:%v", sess.UserId, frame.Target)
+					break
+				}
+				if err := a.backend.SwitchGameStream(sess, frame.Target); err != nil {
+					LOG.Errorf("切换游戏服失败 userid:%v 目标游戏服:%v 错误原因:%v", sess.UserId, frame.Target, err)
+				}
 			}
 
+		case data := <-sess.Datagram.Recv(): // 不可靠通道收到的数据报
+			a.func_ForwardDatagram(sess, data)
+
+		case stream := <-sess.GameLost: // 游戏服流异常中断
+			a.func_OnGameStreamLost(sess, out, stream)
+
+		case r := <-sess.GameRestored: // 游戏服故障转移的重连结果
+			a.func_OnGameRestored(sess, out, r)
+
+		case done := <-sess.Takeover: // 客户端在新连接上恢复了本会话，交出会话后退出
+			handover = true
+			a.online.Remove(sess) // 会话改由接管的Agent记录
+			// 交出前关闭原连接，不下发踢人原因，交出后本协程不再访问会话
+			if ctrl != nil {
+				close(ctrl)
+				ctrl = nil
+			}
+			close(done)
+			return
+
+		case cmd := <-sess.Admin: // 运维指令
+			func_OnAdminCommand(sess, out, cmd)
+
+		case <-grace: // 等待恢复超时
+			LOG.Infof("等待恢复会话超时 userid:%v", sess.UserId)
+			sess.Flag |= SESSION.SESS_KICKED_OUT // 连接已断开，无需下发原因
+
 		case <-min_timer: // 一分钟定时器事件
 			func_OnTimer_OneMinute(sess, out)
 			min_timer = TIME.After(TIME.Minute)
 
-		case <-DIE_SIGN: // 服务器关闭信号
-			sess.Flag |= SESSION.SESS_KICKED_OUT
+		case <-ping_timer: // 客户端ping定时器事件
+			a.func_OnTimer_Ping(sess, out)
+			ping_timer = TIME.After(a.cfg.PingInterval)
+
+		case <-a.die: // 服务器关闭信号
+			sess.Kick(MSGDEFINE.ERR_KICK_MAINTENANCE, "server shutting down")
 		}
 
 		// 被标记本客户端必须被踢掉
@@ -76,3 +185,42 @@ func func_ClientSessionHandler(sess *SESSION.Session, in chan []byte, out *Buffe
 }
 
 //---------------------------------------------
+// 下发客户端消息的处理结果
+// 客户端请求恢复原会话时，成功后返回原会话，由本协程接管
+func (a *Agent) func_OnUserMsgResult(sess *SESSION.Session, out *Buffer, result []byte) *SESSION.Session {
+	if result != nil {
+		out.func_CreateAndSendMsgPacket(sess, result)
+	}
+	if sess.Flag&SESSION.SESS_RESUME != 0 {
+		sess = a.func_ResumeSession(sess, out)
+	}
+	sess.LastPacketTime = sess.PacketTime
+	return sess
+}
+
+//---------------------------------------------
+// 结束会话，释放后端服务资源
+func (a *Agent) func_CloseSession(sess *SESSION.Session) {
+	sess.SetState(SESSION.STATE_CLOSING)
+	close(sess.Die)
+	SESSION.Func_RemoveOnline(sess)
+	a.online.Remove(sess)
+	if sess.Stream != nil {
+		sess.Stream.CloseSend()
+	}
+	if sess.GSID != "" {
+		a.backend.ReleaseGame(sess.GSID)
+	}
+	for _, stream := range sess.Streams {
+		stream.CloseSend()
+	}
+	if sess.Outbox != nil {
+		SESSION.Func_UnregisterResumable(sess.ResumeToken, sess)
+		SESSION.Func_UnregisterUser(sess.UserId, sess)
+		BACKEND.Func_ReleaseUser(sess)
+	}
+	DATAGRAM.Func_Close(sess.Datagram)
+	func_CloseCapture(sess)
+}
+
+//---------------------------------------------
@@ -3,14 +3,21 @@ package framework
 
 //---------------------------------------------
 const (
-	CONST_ReadDeadline         = 15       // 秒(没有网络包进入的最大间隔)
-	CONST_ReceiveBuffer        = 32767    // 每个连接的接收缓冲区
-	CONST_SendBuffer           = 65535    // 每个连接的发送缓冲区
-	CONST_UdpBuffer            = 16777216 // UDP监听器的缓冲区
-	CONST_TosEF                = 46       // Expedited Forwarding (EF)
-	CONST_RpmLimit             = 200      // 每分钟许可的最大请求数
-	CONST_ListerPort           = ":8888"  // TCP/UDP监听连接端口
-	CONST_GameServerMsgIDBegin = 1000     // 转发给游戏服务器的MsgID起始值
+	CONST_ReadDeadline      = 15       // 秒(没有网络包进入的最大间隔)
+	CONST_WriteDeadline     = 10       // 秒(单次写入的最长时间，超过视为客户端接收过慢)
+	CONST_ReceiveBuffer     = 32767    // 每个连接的接收缓冲区
+	CONST_SendBuffer        = 65535    // 每个连接的发送缓冲区
+	CONST_UdpBuffer         = 16777216 // UDP监听器的缓冲区
+	CONST_TosEF             = 46       // Expedited Forwarding (EF)
+	CONST_RpmLimit          = 200      // 每分钟许可的最大请求数
+	CONST_GameRetryTimes    = 5        // 游戏服流中断后的最大重连次数
+	CONST_GameRetryInterval = 1        // 秒(游戏服重连间隔)
+	CONST_ResumeGrace       = 60       // 秒(连接断开后会话等待客户端恢复的时间)
+	CONST_TakeoverTimeout   = 5        // 秒(等待原会话协程交出会话的最长时间)
+	CONST_KickTimeout       = 5        // 秒(向会话投递踢人指令的最长等待时间)
+	CONST_PingInterval      = 5        // 秒(客户端静默多久后Agent主动发起ping)
+	CONST_RttRefresh        = 30       // 秒(往返时延采样的最长间隔，客户端不静默时也定期ping)
+	CONST_WSHandshake       = 10       // 秒(WebSocket升级握手的最长时间，包括读取HTTP请求头)
 )
 
 //---------------------------------------------
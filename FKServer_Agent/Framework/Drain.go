@@ -0,0 +1,85 @@
+//---------------------------------------------
+package framework
+
+//---------------------------------------------
+/*
+	排空Agent，用于滚动重启
+	1. 关闭全部监听，不再接受新连接
+	2. 从服务发现中移除本Agent(见 --register-key)
+	3. 向已登陆的客户端下发server_migrate_ack{说明, 建议的重连地址, 强制断开前的剩余秒数}
+	4. 等待会话自然结束，最多等待timeout，排空期间连接断开的会话不再等待恢复，直接结束
+	5. 踢掉剩余会话(原因为服务器维护)，全部会话协程结束后关闭Agent，见Agent.Done
+	由SIGTERM或运维接口 POST /admin/drain 触发，只有第一次触发生效
+*/
+//---------------------------------------------
+import (
+	ATOMIC "sync/atomic"
+	TIME "time"
+
+	UTILS "FKGoServer/FKLib_Common/Utils"
+	BACKEND "FKGoServer/FKServer_Agent/Backend"
+	SESSION "FKGoServer/FKServer_Agent/Session"
+
+	LOG "github.com/Sirupsen/logrus"
+)
+
+//---------------------------------------------
+const (
+	DEFAULT_MIGRATE_MSG = "server migrating"
+)
+
+//---------------------------------------------
+// 开始排空，timeout为0或addr为空时使用 --drain-timeout 与 --drain-addr
+// 已在排空中时返回false
+func (a *Agent) Drain(timeout TIME.Duration, addr, msg string) bool {
+	started := false
+	a.drain_once.Do(func() {
+		started = true
+		ATOMIC.StoreInt32(&a.draining, 1)
+		if timeout <= 0 {
+			timeout = a.cfg.DrainTimeout
+		}
+		if addr == "" {
+			addr = a.cfg.DrainAddr
+		}
+		if msg == "" {
+			msg = DEFAULT_MIGRATE_MSG
+		}
+		go a.func_RunDrain(timeout, addr, msg)
+	})
+	return started
+}
+
+//---------------------------------------------
+func (a *Agent) Draining() bool {
+	return ATOMIC.LoadInt32(&a.draining) != 0
+}
+
+//---------------------------------------------
+func (a *Agent) func_RunDrain(timeout TIME.Duration, addr, msg string) {
+	defer UTILS.Func_PrintPanicStack()
+	LOG.Infof("开始排空Agent 最长等待:%v 建议重连地址:%v", timeout, addr)
+
+	// 停止接受新连接，从服务发现中移除
+	a.func_CloseListeners()
+	BACKEND.Func_DeregisterAgent()
+
+	// 通知本Agent的客户端迁移
+	deadline := TIME.Now().Add(timeout)
+	infos, missed := a.online.Dispatch(SESSION.Command{Type: SESSION.CMD_MIGRATE, Text: msg, Addr: addr, Deadline: deadline}, CONST_KickTimeout*TIME.Second)
+	LOG.Infof("已通知客户端迁移:%v 未响应:%v", len(infos), missed)
+
+	// 等待会话自然结束
+	ticker := TIME.NewTicker(TIME.Second)
+	defer ticker.Stop()
+	for a.online.Count() > 0 && TIME.Now().Before(deadline) {
+		select {
+		case <-ticker.C:
+		case <-a.die: // 排空期间被Stop关闭
+			return
+		}
+	}
+	a.func_Shutdown()
+}
+
+//---------------------------------------------
@@ -0,0 +1,113 @@
+//---------------------------------------------
+package framework
+
+//---------------------------------------------
+import (
+	TIME "time"
+
+	MSGDEFINE "FKGoServer/FKLib_Common/MsgDefine"
+	PACKET "FKGoServer/FKLib_Common/Packet"
+	UTILS "FKGoServer/FKLib_Common/Utils"
+	BACKEND "FKGoServer/FKServer_Agent/Backend"
+	PROTO "FKGoServer/FKServer_Agent/Proto"
+	SESSION "FKGoServer/FKServer_Agent/Session"
+
+	LOG "github.com/Sirupsen/logrus"
+)
+
+//---------------------------------------------
+// 游戏服流异常中断(读取或发送失败)的故障转移
+// 重连在单独的协程中进行，结果通过sess.GameRestored交回会话协程，重连期间会话照常处理其他事务
+// 重连期间会话处于failover状态，客户端发来的游戏协议与登陆被拒绝，收到game_restored_ack后再继续发送
+func (a *Agent) func_OnGameStreamLost(sess *SESSION.Session, out *Buffer, stream PROTO.GameService_StreamClient) {
+	if stream != sess.Stream {
+		// 其他后端服务的流中断，移除后由下一条消息重新建立
+		for service, s := range sess.Streams {
+			if s == stream {
+				LOG.Warningf("后端服务流中断 userid:%v 服务:%v", sess.UserId, service)
+				delete(sess.Streams, service)
+			}
+		}
+		// 已经被切换掉的旧游戏服流，忽略
+		return
+	}
+
+	lost := sess.GSID
+	LOG.Warningf("游戏服流中断 userid:%v 游戏服:%v", sess.UserId, lost)
+	sess.Stream = nil
+	sess.GSID = ""
+	sess.SetState(SESSION.STATE_FAILOVER)
+	a.backend.ReleaseGame(lost)
+
+	// 通知客户端正在重连
+	out.func_CreateAndSendMsgPacket(sess, PACKET.Func_Pack(MSGDEFINE.Code["game_lost_ack"],
+		MSGDEFINE.S_error_info{F_code: MSGDEFINE.ERR_GAME_SERVICE_LOST, F_msg: "game service lost"}, nil))
+
+	go a.func_ReconnectGame(sess, sess.UserId, lost)
+}
+
+//---------------------------------------------
+// 有限次数重连游戏服，每次重新选服
+// 只读取不变的UserId，会话结束时放弃重连并关闭已经建立的流
+func (a *Agent) func_ReconnectGame(sess *SESSION.Session, userid int32, lost string) {
+	defer UTILS.Func_PrintPanicStack()
+	var r SESSION.GameStream
+	for i := 0; i < CONST_GameRetryTimes; i++ {
+		if i > 0 {
+			select {
+			case <-TIME.After(CONST_GameRetryInterval * TIME.Second):
+			case <-sess.Die:
+				return
+			}
+		}
+
+		gsid := a.backend.SelectGameExcept(userid, lost)
+		if gsid == "" {
+			continue
+		}
+		s, err := a.backend.DialGameStream(sess, gsid)
+		if err != nil {
+			LOG.Warningf("重连游戏服失败 userid:%v 游戏服:%v 第%v次 错误原因:%v", userid, gsid, i+1, err)
+			a.backend.ReleaseGame(gsid)
+			continue
+		}
+		r = SESSION.GameStream{GSID: gsid, Stream: s}
+		break
+	}
+
+	select {
+	case sess.GameRestored <- r:
+	case <-sess.Die: // 会话已经结束
+		if r.Stream != nil {
+			r.Stream.CloseSend()
+			a.backend.ReleaseGame(r.GSID)
+		}
+	}
+}
+
+//---------------------------------------------
+// 故障转移结束，在会话协程中执行
+func (a *Agent) func_OnGameRestored(sess *SESSION.Session, out *Buffer, r SESSION.GameStream) {
+	if r.Stream == nil {
+		// 没有任何可用的游戏服，踢掉客户端
+		LOG.Errorf("没有可用的游戏服，踢掉客户端 userid:%v", sess.UserId)
+		sess.Kick(MSGDEFINE.ERR_KICK_SERVICE_LOST, "no game server")
+		return
+	}
+	// 正常情况下重连期间不会建立新的游戏服流，若已存在则先关闭，避免泄漏
+	if sess.Stream != nil {
+		sess.Stream.CloseSend()
+	}
+	if sess.GSID != "" {
+		a.backend.ReleaseGame(sess.GSID)
+	}
+	sess.GSID = r.GSID
+	sess.Stream = r.Stream
+	sess.SetState(SESSION.STATE_INGAME)
+	BACKEND.Func_FetchStream(sess, r.Stream)
+	LOG.Infof("游戏服故障转移完成 userid:%v -> %v", sess.UserId, r.GSID)
+	out.func_CreateAndSendMsgPacket(sess, PACKET.Func_Pack(MSGDEFINE.Code["game_restored_ack"],
+		MSGDEFINE.S_error_info{F_code: 0, F_msg: r.GSID}, nil))
+}
+
+//---------------------------------------------
@@ -3,8 +3,12 @@ package framework
 
 //---------------------------------------------
 import (
+	BINARY "encoding/binary"
 	ERRORS "errors"
+	TIME "time"
 
+	BACKEND "FKGoServer/FKServer_Agent/Backend"
+	LIMITER "FKGoServer/FKServer_Agent/Limiter"
 	PROTO "FKGoServer/FKServer_Agent/Proto"
 	SESSION "FKGoServer/FKServer_Agent/Session"
 
@@ -12,24 +16,93 @@ import (
 )
 
 //---------------------------------------------
-// 向游戏服务器推送消息
-func func_ForwardMsgToGameServer(sess *SESSION.Session, p []byte) error {
+var (
+	ERROR_GAME_STREAM_LOST = ERRORS.New("game stream lost")
+)
+
+//---------------------------------------------
+// 向后端服务推送消息
+// 发送到游戏服失败时与读取失败一样进行故障转移，返回ERROR_GAME_STREAM_LOST，会话保持
+func (a *Agent) func_ForwardMsg(sess *SESSION.Session, service string, p []byte) error {
 	frame := &PROTO.Game_Frame{
 		Type:    PROTO.Game_Message,
 		Message: p,
 	}
 
 	// 检查流
-	if sess.Stream == nil {
-		return ERRORS.New("尚未开启流")
+	stream, err := a.func_GetStream(sess, service)
+	if err != nil {
+		return err
 	}
 
-	// 推送消息帧给GameServer
-	if err := sess.Stream.Send(frame); err != nil {
+	// 推送消息帧给后端服务
+	if err := stream.Send(frame); err != nil {
 		LOG.Error(err)
+		if service == a.backend.GameService() {
+			go BACKEND.Func_NotifyStreamLost(sess, stream)
+			return ERROR_GAME_STREAM_LOST
+		}
+		delete(sess.Streams, service)
 		return err
 	}
 	return nil
 }
 
 //---------------------------------------------
+// 转发不可靠通道收到的数据报 PROTO|PAYLOAD，见FKServer_Agent/Datagram
+// 只转发游戏中允许并且有路由的协议，超出发包频率限制或转发失败时直接丢弃
+func (a *Agent) func_ForwardDatagram(sess *SESSION.Session, p []byte) {
+	proto := int16(BINARY.BigEndian.Uint16(p))
+	if sess.State != SESSION.STATE_INGAME || !sess.State.Allowed(proto) {
+		LOG.Debugf("会话状态不允许该数据报 userid:%v 状态:%v 协议:%v", sess.UserId, sess.State, proto)
+		return
+	}
+	service := a.backend.Route(proto)
+	if service == "" {
+		LOG.Debugf("数据报没有路由 userid:%v 协议:%v", sess.UserId, proto)
+		return
+	}
+	if action, _ := sess.Limiter.Check(sess.IP.String(), proto, TIME.Now()); action != LIMITER.ACTION_PASS {
+		return
+	}
+
+	stream, err := a.func_GetStream(sess, service)
+	if err != nil {
+		return
+	}
+	if err := stream.Send(&PROTO.Game_Frame{Type: PROTO.Game_Datagram, Message: p}); err != nil {
+		LOG.Warningf("转发数据报失败 userid:%v 服务:%v 错误原因:%v", sess.UserId, service, err)
+		if service == a.backend.GameService() {
+			go BACKEND.Func_NotifyStreamLost(sess, stream)
+		} else {
+			delete(sess.Streams, service)
+		}
+	}
+}
+
+//---------------------------------------------
+// 获取会话到后端服务的流
+// 游戏服的流在登陆时建立，其他服务的流在第一条消息到达时建立
+func (a *Agent) func_GetStream(sess *SESSION.Session, service string) (PROTO.GameService_StreamClient, error) {
+	if service == a.backend.GameService() {
+		if sess.Stream == nil {
+			return nil, ERRORS.New("尚未开启流")
+		}
+		return sess.Stream, nil
+	}
+
+	if stream := sess.Streams[service]; stream != nil {
+		return stream, nil
+	}
+	if sess.UserId == 0 {
+		return nil, ERRORS.New("尚未登陆")
+	}
+	stream, err := a.backend.OpenServiceStream(sess, service)
+	if err != nil {
+		return nil, err
+	}
+	sess.Streams[service] = stream
+	return stream, nil
+}
+
+//---------------------------------------------
@@ -1,17 +0,0 @@
-//---------------------------------------------
-package framework
-
-//---------------------------------------------
-import (
-	SYNC "sync"
-)
-
-//---------------------------------------------
-var (
-	// 阻塞主线程的进行，等待全部协程执行完毕
-	SYNC_WAITGROUP SYNC.WaitGroup
-	// 自定义全服务器关闭消息
-	DIE_SIGN = make(chan struct{})
-)
-
-//---------------------------------------------
@@ -3,114 +3,154 @@ package framework
 
 //---------------------------------------------
 import (
-	BINARY "encoding/binary"
-	IO "io"
 	NET "net"
-	OS "os"
 	TIME "time"
 
+	ETCDCLIENT "FKGoServer/FKLib_Common/ETCDClient"
+	PACKET "FKGoServer/FKLib_Common/Packet"
 	SERVICES "FKGoServer/FKLib_Common/Service"
 	UTILS "FKGoServer/FKLib_Common/Utils"
+	ADMIN "FKGoServer/FKServer_Agent/Admin"
+	AUTH "FKGoServer/FKServer_Agent/Auth"
+	BACKEND "FKGoServer/FKServer_Agent/Backend"
+	CAPTURE "FKGoServer/FKServer_Agent/Capture"
+	DATAGRAM "FKGoServer/FKServer_Agent/Datagram"
+	HANDSHAKE "FKGoServer/FKServer_Agent/Handshake"
+	LIMITER "FKGoServer/FKServer_Agent/Limiter"
+	PROXY "FKGoServer/FKServer_Agent/Proxy"
 	SESSION "FKGoServer/FKServer_Agent/Session"
+	UDP "FKGoServer/FKServer_Agent/Udp"
 
 	LOG "github.com/Sirupsen/logrus"
-	KCP "github.com/xtaci/kcp-go"
 	CLI "gopkg.in/urfave/cli.v2"
 )
 
 //---------------------------------------------
-// 启动
-func Func_InitApp(c *CLI.Context) {
-	// 启动新协程处理Unix内部信号
-	go func_HandlerUnixSign()
-	// 服务实际初始化
-	SERVICES.InitWithCliContext(c)
+// 按命令行参数初始化进程内共享的子系统，返回按命令行参数创建的Agent，由调用者启动
+func Func_InitApp(c *CLI.Context) *Agent {
+	// 服务实际初始化，游戏服与路由表中的服务自动加入服务发现
+	SERVICES.InitWithHostServices(c.String("etcd-root"), c.StringSlice("etcd-hosts"), BACKEND.Func_DiscoveryServices(c))
+	ETCDCLIENT.Init(c.StringSlice("etcd-hosts"))
+	// 握手配置初始化
+	HANDSHAKE.InitWithCliContext(c)
+	// 登陆鉴权初始化
+	AUTH.InitWithCliContext(c)
+	// 发包频率限制初始化
+	LIMITER.InitWithCliContext(c)
+	// PROXY协议初始化
+	PROXY.InitWithCliContext(c)
+	// KCP配置初始化
+	UDP.InitWithCliContext(c)
+	// 不可靠数据报通道初始化
+	DATAGRAM.InitWithCliContext(c)
+	// 抓包策略初始化
+	CAPTURE.InitWithCliContext(c)
+	// 发送队列初始化
+	func_InitSendQueue(c)
+	// 会话状态协议许可表初始化
+	acl, err := SESSION.ParseACL(c.StringSlice("acl"))
+	if err != nil {
+		LOG.Fatal("协议许可表格式错误:", c.StringSlice("acl"))
+	}
+	SESSION.Func_SetACL(acl)
+	// 在线表、Agent登记与客户端版本策略初始化，选服与协议路由由Agent启动时创建
+	BACKEND.InitWithCliContext(c)
+	// 重复登陆检测
+	go func_HandleEvictions()
+
+	agent := NewAgent(Func_NewConfig(c))
+	// 启动新协程处理Unix内部信号，SIGTERM时排空该Agent
+	go func_HandlerUnixSign(agent)
+	// 运维接口初始化
+	ADMIN.InitWithCliContext(c)
+	ADMIN.Func_SetDrainer(agent)
+	return agent
 }
 
 //---------------------------------------------
-// 新线程，开启TCP服务器监听
-func Func_StartTcpServer() {
-	// 获取一个TCP地址
-	tcpAddr, err := NET.ResolveTCPAddr("tcp4", CONST_ListerPort)
-	func_CheckError(err)
-	// 创建一个该地址的监听
-	listener, err := NET.ListenTCP("tcp", tcpAddr)
-	func_CheckError(err)
-
-	LOG.Info("正在监听TCP地址:", listener.Addr())
+// 读取命令行参数中的Agent配置
+func Func_NewConfig(c *CLI.Context) Config {
+	return Config{
+		Listen:       c.String("listen"),
+		WSListen:     c.String("ws-listen"),
+		WSPath:       c.String("ws-path"),
+		WSOrigin:     c.StringSlice("ws-origin"),
+		WSSCert:      c.String("wss-cert"),
+		WSSKey:       c.String("wss-key"),
+		IdleTimeout:  c.Duration("idle-timeout"),
+		PingInterval: c.Duration("ping-interval"),
+		MessageLimit: c.Int("max-message"),
+		DrainTimeout: c.Duration("drain-timeout"),
+		DrainAddr:    c.String("drain-addr"),
+		GameService:  c.String("game-service"),
+		GameSelect:   c.String("game-select"),
+		GameId:       c.String("game-id"),
+		Routes:       c.StringSlice("route"),
+		RouteKey:     c.String("route-key"),
+
+		WSHandshakeTimeout: c.Duration("ws-handshake-timeout"),
+	}
+}
 
+//---------------------------------------------
+// 新线程，接受TCP连接，直到监听关闭
+func (a *Agent) func_ServeTcp() {
 	// 死循环接收连接
 	for {
 		// 始终在accept等待
-		conn, err := listener.AcceptTCP()
+		conn, err := a.tcp.Accept()
 		if err != nil {
+			select {
+			case <-a.drain: // 监听已关闭
+				return
+			default:
+			}
 			LOG.Warning("接收客户端连接失败:", err)
 			continue
 		}
-		// 设置Socket读取缓冲
-		conn.SetReadBuffer(CONST_SendBuffer)
-		// 设置Socket发送缓冲
-		conn.SetWriteBuffer(CONST_ReceiveBuffer)
-		// 开启新协程处理这次连接接收的数据
-		go func_HandleNewClientConnect(conn)
-
-		// 收到服务器的死亡消息
-		select {
-		case <-DIE_SIGN:
-			listener.Close() // 关闭监听
-			return           // 退出循环
-		default:
+		if tcp, ok := conn.(*NET.TCPConn); ok {
+			// 设置Socket读取缓冲
+			tcp.SetReadBuffer(CONST_SendBuffer)
+			// 设置Socket发送缓冲
+			tcp.SetWriteBuffer(CONST_ReceiveBuffer)
 		}
+		// 开启新协程处理这次连接接收的数据
+		go a.func_HandleTcpConnect(conn)
 	}
 }
 
 //---------------------------------------------
-// 新线程，开启UDP服务器监听
-func Func_StartUdpServer() {
-	// 直接监听一个端口
-	l, err := KCP.Listen(CONST_ListerPort)
-	func_CheckError(err)
-
-	LOG.Info("正在监听UDP地址:", l.Addr())
-
-	// 获取连接对象
-	lis := l.(*KCP.Listener)
-	// 设置Socket读取缓冲
-	if err := lis.SetReadBuffer(CONST_UdpBuffer); err != nil {
-		LOG.Println(err)
-	}
-	// 设置Socket发送缓冲
-	if err := lis.SetWriteBuffer(CONST_UdpBuffer); err != nil {
-		LOG.Println(err)
-	}
-	if err := lis.SetDSCP(CONST_TosEF); err != nil {
-		LOG.Println(err)
+// 处理TCP连接
+// 来自负载均衡器的TCP连接，从PROXY协议头中取得客户端真实地址，见 --proxy-trusted
+// 只作用于TCP监听，WebSocket连接虽然同样基于TCP，但协议头不会出现在WebSocket数据中
+func (a *Agent) func_HandleTcpConnect(conn NET.Conn) {
+	proxied, err := PROXY.Func_Accept(conn)
+	if err != nil {
+		LOG.Warningf("读取PROXY协议头失败 来源:%v 错误原因:%v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
 	}
+	a.func_HandleNewClientConnect(proxied)
+}
 
+//---------------------------------------------
+// 新线程，接受KCP连接，直到监听关闭
+func (a *Agent) func_ServeUdp() {
 	// 死循环接收连接
 	for {
 		// 始终在accept等待
-		conn, err := lis.AcceptKCP()
+		conn, err := a.kcp.AcceptKCP()
 		if err != nil {
+			select {
+			case <-a.drain: // 监听已关闭
+				return
+			default:
+			}
 			LOG.Warning("接收客户端连接失败:", err)
 			continue
 		}
-		// 设置KCP参数
-		conn.SetWindowSize(32, 32)
-		conn.SetNoDelay(1, 20, 1, 1)
-		conn.SetKeepAlive(0)
-		conn.SetStreamMode(true)
-
-		// 开启新协程处理这次连接接收的数据
-		go func_HandleNewClientConnect(conn)
-
-		// 收到服务器的死亡消息
-		select {
-		case <-DIE_SIGN:
-			lis.Close() // 关闭监听
-			return      // 退出循环
-		default:
-		}
+		// 按 --kcp-profile 设置KCP参数，开启新协程处理这次连接接收的数据
+		go a.func_HandleNewClientConnect(UDP.Func_Accept(conn))
 	}
 }
 
@@ -119,8 +159,8 @@ func Func_StartUdpServer() {
 // 这个函数是在单独一个协程中执行的，进行接入包解析
 // 每个消息包格式定义如下：头两个字节为DATA数据大小
 // | 2B size |     DATA       |
-//
-func func_HandleNewClientConnect(conn NET.Conn) {
+// size为0时表示扩展帧，后面是4字节的长度，消息不能超过 --max-message
+func (a *Agent) func_HandleNewClientConnect(conn NET.Conn) {
 	// 无论如何，最后退出时总要打印产生panic时的调用栈
 	defer UTILS.Func_PrintPanicStack()
 
@@ -140,60 +180,47 @@ func func_HandleNewClientConnect(conn NET.Conn) {
 		return
 	}
 	sess.IP = NET.ParseIP(host)
+	sess.KCP, _ = conn.(*UDP.Conn)
 	LOG.Infof("接收到远程连接地址:%v 端口:%v", host, port)
 
 	// 对话死亡消息
 	sess.Die = make(chan struct{})
+	// 连接关闭消息，会话可以在连接断开后被新连接恢复，所以连接与会话的生命周期分开
+	ctrl := make(chan struct{})
 
 	// 创建一个写入缓冲区
-	out := func_CreateWriteBuffer(conn, sess.Die)
+	out := func_CreateWriteBuffer(conn, ctrl)
 	// 创建新协程进行包发送
 	go out.func_StartSendPacket()
 
 	// 增加一个引用
-	SYNC_WAITGROUP.Add(1)
+	a.wg.Add(1)
 	// 为这个会话启动一个协程进行事务处理
-	go func_ClientSessionHandler(&sess, in, out)
+	go a.func_ClientSessionHandler(&sess, in, out, ctrl)
 
 	// 死循环接收连接
+	// 会话可能被新连接恢复并改写，本协程之后不再访问sess
 	for {
 		// 如果客户端和服务器之间的物理通讯出现故障，将导致读取时出现持续Block
 		// 所以这里增加TimeOut用来解决类似的死链接
-		conn.SetReadDeadline(TIME.Now().Add(CONST_ReadDeadline * TIME.Second))
+		// 客户端静默时Agent会主动ping，正常的客户端回复后不会超时，见 --idle-timeout
+		conn.SetReadDeadline(TIME.Now().Add(a.cfg.IdleTimeout))
 
-		// 读取两字节头
-		n, err := IO.ReadFull(conn, header)
+		// 读取一条消息，超过65535字节的消息使用扩展帧，见FKLib_Common/Packet/Frame.go
+		payload, err := PACKET.ReadMessage(conn, header, a.cfg.MessageLimit)
 		if err != nil {
-			LOG.Warningf("读取两字节头失败,会话IP:%v 错误原因:%v 实际数据包大小:%v", sess.IP, err, n)
-			return
-		}
-		size := BINARY.BigEndian.Uint16(header)
-
-		// 分配一块内存用来进行数据读取
-		payload := make([]byte, size)
-		n, err = IO.ReadFull(conn, payload)
-		if err != nil {
-			LOG.Warningf("读取数据失败,会话IP:%v 错误原因:%v 预期数据包大小:%v", sess.IP, err, n)
+			LOG.Warningf("读取数据失败,会话IP:%v 错误原因:%v", host, err)
 			return
 		}
 
 		// 将收到的数据进行压栈
 		select {
 		case in <- payload: // 将读取到的数据进行压栈
-		case <-sess.Die: // 收到关闭死亡消息
-			LOG.Warningf("逻辑发布死亡消息,连接被关闭,会话标示:%v 会话IP:%v", sess.Flag, sess.IP)
+		case <-ctrl: // 收到关闭死亡消息
+			LOG.Warningf("逻辑发布死亡消息,连接被关闭,会话IP:%v", host)
 			return
 		}
 	}
 }
 
 //---------------------------------------------
-// 对严重错误进行处理
-func func_CheckError(err error) {
-	if err != nil {
-		LOG.Fatal(err)
-		OS.Exit(-1)
-	}
-}
-
-//---------------------------------------------
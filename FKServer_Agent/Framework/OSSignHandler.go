@@ -14,7 +14,7 @@ import (
 
 //---------------------------------------------
 // 处理Unix内部信号
-func func_HandlerUnixSign() {
+func func_HandlerUnixSign(agent *Agent) {
 	// 退出前必须产生panic时的调用栈打印
 	defer UTILS.Func_PrintPanicStack()
 
@@ -26,13 +26,11 @@ func func_HandlerUnixSign() {
 	for {
 		msg := <-ch // 将channel中数据填充至msg中
 		switch msg {
-		case SYSCALL.SIGTERM: // 如果收到了SIGTERM消息，则关闭Anget
-			close(DIE_SIGN)
+		case SYSCALL.SIGTERM: // 如果收到了SIGTERM消息，则排空后关闭Agent
 			LOG.Info("收到Unix关闭信号")
-			LOG.Info("请等待Agent关闭...")
-			SYNC_WAITGROUP.Wait() // 阻塞主线程的进行，等待全部协程执行完毕
-			LOG.Info("Agent已关闭")
-			OS.Exit(0)
+			if !agent.Drain(0, "", "") {
+				LOG.Info("Agent已在排空中")
+			}
 		}
 	}
 }
@@ -0,0 +1,42 @@
+//---------------------------------------------
+package framework
+
+//---------------------------------------------
+import (
+	TIME "time"
+
+	MSGDEFINE "FKGoServer/FKLib_Common/MsgDefine"
+	UTILS "FKGoServer/FKLib_Common/Utils"
+	BACKEND "FKGoServer/FKServer_Agent/Backend"
+	SESSION "FKGoServer/FKServer_Agent/Session"
+
+	LOG "github.com/Sirupsen/logrus"
+)
+
+//---------------------------------------------
+// 新线程，踢掉本Agent上被重复登陆覆盖的旧会话，见FKServer_Agent/Presence
+func func_HandleEvictions() {
+	defer UTILS.Func_PrintPanicStack()
+	for ev := range BACKEND.Func_Evictions() {
+		sess := SESSION.Func_QueryOwner(ev.Owner)
+		if sess == nil { // 旧会话已经结束
+			continue
+		}
+		LOG.Infof("重复登陆，踢掉旧会话 userid:%v 旧会话:%v 新会话:%v", ev.UserId, ev.Owner, ev.By)
+		go func_PostKick(sess, MSGDEFINE.ERR_KICK_DUPLICATE_LOGIN, "duplicate login")
+	}
+}
+
+//---------------------------------------------
+// 向会话投递踢人指令，由会话协程执行
+func func_PostKick(sess *SESSION.Session, code int32, text string) {
+	cmd := SESSION.Command{Type: SESSION.CMD_KICK, Code: code, Text: text, Reply: make(chan *SESSION.Info, 1)}
+	select {
+	case sess.Admin <- cmd:
+	case <-sess.Die:
+	case <-TIME.After(CONST_KickTimeout * TIME.Second):
+		LOG.Warningf("踢人指令投递超时 userid:%v", sess.UserId)
+	}
+}
+
+//---------------------------------------------
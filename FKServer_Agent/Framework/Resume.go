@@ -0,0 +1,94 @@
+//---------------------------------------------
+package framework
+
+//---------------------------------------------
+import (
+	TIME "time"
+
+	MSGDEFINE "FKGoServer/FKLib_Common/MsgDefine"
+	PACKET "FKGoServer/FKLib_Common/Packet"
+	SESSION "FKGoServer/FKServer_Agent/Session"
+
+	LOG "github.com/Sirupsen/logrus"
+)
+
+//---------------------------------------------
+/*
+	断线重连恢复会话，TCP与KCP连接之间可以互相恢复
+	1. 登陆成功时下发恢复凭证，此后下发给客户端的数据包都会记录到重传缓冲(从登陆成功回复开始计数)
+	2. 连接断开后会话保留CONST_ResumeGrace秒，期间游戏服的消息只记录不发送
+	3. 客户端建立新连接，完成密钥交换后发送session_resume_req{凭证, 已收到的数据包个数}
+	4. 新连接的会话协程从原会话协程手中接管原会话，沿用新连接的密钥与压缩算法，游戏服流保持不变
+	5. 回复session_resume_ack{凭证, 服务器已处理的客户端数据包个数}，客户端的数据包序号从该值继续递增
+	6. 补发客户端尚未收到的数据包。新连接上的get_seed_ack与session_resume_ack不计入数据包个数
+*/
+//---------------------------------------------
+// 新连接上的临时会话请求恢复原会话
+// 成功时返回原会话，由当前协程继续处理；失败时回复客户端并返回临时会话
+func (a *Agent) func_ResumeSession(temp *SESSION.Session, out *Buffer) *SESSION.Session {
+	temp.Flag &^= SESSION.SESS_RESUME
+
+	old := SESSION.Func_TakeResumable(temp.ResumeToken)
+	if old == nil {
+		LOG.Warningf("恢复会话失败，凭证无效 会话IP:%v", temp.IP)
+		func_SendResumeFaild(temp, out, MSGDEFINE.ERR_RESUME_INVALID_TOKEN, "invalid resume token")
+		return temp
+	}
+
+	// 等待原会话协程交出会话，此后原会话只由当前协程访问
+	done := make(chan struct{})
+	select {
+	case old.Takeover <- done:
+		<-done
+	case <-old.Die: // 原会话已经结束
+		LOG.Warningf("恢复会话失败，原会话已结束 userid:%v", old.UserId)
+		func_SendResumeFaild(temp, out, MSGDEFINE.ERR_RESUME_INVALID_TOKEN, "session closed")
+		return temp
+	case <-TIME.After(CONST_TakeoverTimeout * TIME.Second):
+		LOG.Warningf("恢复会话失败，原会话无响应 userid:%v", old.UserId)
+		SESSION.Func_RegisterResumable(old.ResumeToken, old)
+		func_SendResumeFaild(temp, out, MSGDEFINE.ERR_RESUME_INVALID_TOKEN, "session busy")
+		return temp
+	case <-a.die:
+		temp.Kick(MSGDEFINE.ERR_KICK_MAINTENANCE, "server shutting down")
+		return temp
+	}
+
+	// 客户端缺失的数据包已经无法补齐，原会话没有继续的意义
+	replay, ok := old.Outbox.Since(temp.ResumeCount)
+	if !ok {
+		LOG.Warningf("恢复会话失败，重传缓冲无法补齐 userid:%v 客户端已收到:%v 已发送:%v", old.UserId, temp.ResumeCount, old.Outbox.Count())
+		a.func_CloseSession(old)
+		func_SendResumeFaild(temp, out, MSGDEFINE.ERR_RESUME_PACKET_LOST, "packet lost")
+		return temp
+	}
+
+	// 接管原会话，沿用新连接上协商的密钥
+	old.IP = temp.IP
+	old.Encoder, old.Decoder, old.Compressor = temp.Encoder, temp.Decoder, temp.Compressor
+	old.KCP = temp.KCP
+	old.Flag = old.Flag&^(SESSION.SESS_KEYEXCG|SESSION.SESS_ENCRYPT) | temp.Flag&(SESSION.SESS_KEYEXCG|SESSION.SESS_ENCRYPT)
+	old.PacketTime = temp.PacketTime
+	temp.SetState(SESSION.STATE_CLOSING)
+	close(temp.Die)
+	SESSION.Func_RemoveOnline(temp)
+	a.online.Remove(temp)
+	a.online.Add(old) // 原会话可能属于同一进程中的其他Agent
+	SESSION.Func_RegisterResumable(old.ResumeToken, old)
+
+	out.func_EncryptAndSendPacket(old, PACKET.Func_Pack(MSGDEFINE.Code["session_resume_ack"],
+		MSGDEFINE.S_resume_info{F_token: old.ResumeToken, F_count: int32(old.PacketCount)}, nil))
+	for _, p := range replay {
+		out.func_EncryptAndSendPacket(old, p)
+	}
+	LOG.Infof("恢复会话成功 userid:%v 会话IP:%v 补发数据包:%v", old.UserId, old.IP, len(replay))
+	return old
+}
+
+//---------------------------------------------
+func func_SendResumeFaild(sess *SESSION.Session, out *Buffer, code int32, msg string) {
+	out.func_CreateAndSendMsgPacket(sess, PACKET.Func_Pack(MSGDEFINE.Code["session_resume_faild_ack"],
+		MSGDEFINE.S_error_info{F_code: code, F_msg: msg}, nil))
+}
+
+//---------------------------------------------
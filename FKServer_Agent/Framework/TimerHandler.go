@@ -5,7 +5,10 @@ package framework
 import (
 	TIME "time"
 
+	MSGDEFINE "FKGoServer/FKLib_Common/MsgDefine"
+	PACKET "FKGoServer/FKLib_Common/Packet"
 	SESSION "FKGoServer/FKServer_Agent/Session"
+	VERSION "FKGoServer/FKServer_Agent/Version"
 
 	LOG "github.com/Sirupsen/logrus"
 )
@@ -13,6 +16,11 @@ import (
 //---------------------------------------------
 // 客户端1分钟定时器
 func func_OnTimer_OneMinute(sess *SESSION.Session, out *Buffer) {
+	// 抓包文件定期落盘
+	if sess.Capture != nil {
+		sess.Capture.Flush()
+	}
+
 	// 客户端登陆时间
 	interval := TIME.Now().Sub(sess.ConnectTime).Minutes()
 
@@ -21,7 +29,7 @@ func func_OnTimer_OneMinute(sess *SESSION.Session, out *Buffer) {
 
 		// 发包频率控制，太高的RPM直接踢掉
 		if rpm > CONST_RpmLimit {
-			sess.Flag |= SESSION.SESS_KICKED_OUT
+			sess.Kick(MSGDEFINE.ERR_KICK_RATE_LIMITED, "too many requests")
 			LOG.WithFields(LOG.Fields{
 				"userid": sess.UserId,
 				"rpm":    rpm,
@@ -32,3 +40,29 @@ func func_OnTimer_OneMinute(sess *SESSION.Session, out *Buffer) {
 }
 
 //---------------------------------------------
+// 客户端ping定时器
+// 已登陆的客户端静默超过 --ping-interval，或者往返时延采样已过期时，Agent主动发起ping
+// 客户端回复server_pong_req后更新往返时延，见Msg中的P_server_pong_req
+func (a *Agent) func_OnTimer_Ping(sess *SESSION.Session, out *Buffer) {
+	// 连接已断开或还未登陆
+	if out == nil || (sess.State != SESSION.STATE_AUTHENTICATED && sess.State != SESSION.STATE_INGAME && sess.State != SESSION.STATE_FAILOVER) {
+		return
+	}
+	// 客户端协议版本不支持回复ping，未配置server_ping的最低版本时全部客户端都不发送
+	if !sess.Supports(VERSION.FEATURE_SERVER_PING) {
+		return
+	}
+	now := TIME.Now()
+	if now.Sub(sess.LastPacketTime) < a.cfg.PingInterval && now.Sub(sess.RTTTime) < CONST_RttRefresh*TIME.Second {
+		return
+	}
+	// 上一次ping还未回复时不重复发送，超时由 --idle-timeout 处理
+	if !sess.PingTime.IsZero() && now.Sub(sess.PingTime) < a.cfg.IdleTimeout {
+		return
+	}
+	sess.PingId++
+	sess.PingTime = now
+	out.func_CreateAndSendMsgPacket(sess, PACKET.Func_Pack(MSGDEFINE.Code["server_ping_ack"], MSGDEFINE.S_auto_id{F_id: sess.PingId}, nil))
+}
+
+//---------------------------------------------
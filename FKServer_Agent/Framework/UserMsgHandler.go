@@ -8,22 +8,48 @@ import (
 	MSGDEFINE "FKGoServer/FKLib_Common/MsgDefine"
 	PACKET "FKGoServer/FKLib_Common/Packet"
 	UTILS "FKGoServer/FKLib_Common/Utils"
+	CAPTURE "FKGoServer/FKServer_Agent/Capture"
+	LIMITER "FKGoServer/FKServer_Agent/Limiter"
 	MSG "FKGoServer/FKServer_Agent/Msg"
 	SESSION "FKGoServer/FKServer_Agent/Session"
 
 	LOG "github.com/Sirupsen/logrus"
 )
 
+//---------------------------------------------
+// 发包频率超限(delay方式)而延迟处理的数据包
+// 会话协程暂存该数据包并暂停读取客户端消息，到时再处理，等待期间照常处理其他事务
+type pending_msg struct {
+	proto int16
+	data  []byte        // 去掉序号后的明文: PROTO|PAYLOAD
+	delay TIME.Duration // 需要等待的时间
+	start TIME.Time     // 数据包的到达时间
+}
+
 //---------------------------------------------
 // 客户端消息处理代理
-func func_UserMsgHandler(sess *SESSION.Session, p []byte) []byte {
+// 需要延迟处理时返回pending_msg，由会话协程到时调用func_DispatchMsg
+func (a *Agent) func_UserMsgHandler(sess *SESSION.Session, p []byte) ([]byte, *pending_msg) {
 	// 记录当前时间
 	start := TIME.Now()
 	// 无论如何，最终打印引发错误的日志
 	defer UTILS.Func_PrintPanicStack(sess, p)
 	// 解密
 	if sess.Flag&SESSION.SESS_ENCRYPT != 0 {
-		sess.Decoder.XORKeyStream(p, p)
+		var err error
+		if p, err = sess.Decoder.Open(p); err != nil {
+			LOG.Errorf("数据包解密失败 会话IP:%v 错误原因:%v", sess.IP, err)
+			sess.Kick(MSGDEFINE.ERR_KICK_PROTOCOL, "decrypt failed")
+			return nil, nil
+		}
+		// 解压
+		if sess.Compressor != nil {
+			if p, err = sess.Compressor.Decompress(p); err != nil {
+				LOG.Errorf("数据包解压失败 会话IP:%v 错误原因:%v", sess.IP, err)
+				sess.Kick(MSGDEFINE.ERR_KICK_PROTOCOL, "decompress failed")
+				return nil, nil
+			}
+		}
 	}
 	// 封装为reader
 	reader := PACKET.Reader(p)
@@ -34,32 +60,69 @@ func func_UserMsgHandler(sess *SESSION.Session, p []byte) []byte {
 	seq_id, err := reader.ReadU32()
 	if err != nil {
 		LOG.Error("读取客户端数据包序列号失败:", err)
-		sess.Flag |= SESSION.SESS_KICKED_OUT
-		return nil
+		sess.Kick(MSGDEFINE.ERR_KICK_PROTOCOL, "bad packet")
+		return nil, nil
 	}
 
 	// 数据包序列号验证
 	if seq_id != sess.PacketCount {
 		LOG.Errorf("数据包序列号错误 实际包ID:%v 期望包ID:%v 包大小:%v", seq_id, sess.PacketCount, len(p)-6)
-		sess.Flag |= SESSION.SESS_KICKED_OUT
-		return nil
+		sess.Kick(MSGDEFINE.ERR_KICK_PROTOCOL, "bad packet sequence")
+		return nil, nil
 	}
 
 	// 读协议号
 	b, err := reader.ReadS16()
 	if err != nil {
 		LOG.Error("读取协议号失败.")
-		sess.Flag |= SESSION.SESS_KICKED_OUT
-		return nil
+		sess.Kick(MSGDEFINE.ERR_KICK_PROTOCOL, "bad packet")
+		return nil, nil
+	}
+
+	// 抓包记录去掉序号后的明文
+	func_CapturePacket(sess, CAPTURE.DIR_IN, p[4:])
+
+	// 发包频率限制
+	switch action, delay := sess.Limiter.Check(sess.IP.String(), b, start); action {
+	case LIMITER.ACTION_DELAY:
+		return nil, &pending_msg{proto: b, data: p[4:], delay: delay, start: start}
+	case LIMITER.ACTION_DROP:
+		LOG.Debugf("发包频率超限，丢弃数据包 userid:%v 会话IP:%v 协议:%v", sess.UserId, sess.IP, b)
+		return nil, nil
+	case LIMITER.ACTION_KICK:
+		LOG.Warningf("发包频率超限，踢掉客户端 userid:%v 会话IP:%v 协议:%v", sess.UserId, sess.IP, b)
+		sess.Kick(MSGDEFINE.ERR_KICK_RATE_LIMITED, "rate limited")
+		return nil, nil
+	}
+
+	return a.func_DispatchMsg(sess, b, p[4:], start), nil
+}
+
+//---------------------------------------------
+// 按协议号处理客户端消息，data为去掉序号后的明文
+func (a *Agent) func_DispatchMsg(sess *SESSION.Session, b int16, data []byte, start TIME.Time) []byte {
+	defer UTILS.Func_PrintPanicStack(sess, data)
+	reader := PACKET.Reader(data)
+	reader.ReadS16() // 协议号已经读出
+
+	// 当前会话状态不允许的协议直接拒绝，例如登陆前发送游戏协议、登陆后再次交换密钥
+	// 在发包频率限制之后检查，被拒绝的数据包同样消耗令牌
+	if !sess.State.Allowed(b) {
+		LOG.Debugf("会话状态不允许该协议 userid:%v 会话IP:%v 状态:%v 协议:%v", sess.UserId, sess.IP, sess.State, b)
+		return PACKET.Func_Pack(MSGDEFINE.Code["client_error_ack"], MSGDEFINE.S_error_info{F_code: MSGDEFINE.ERR_PROTO_NOT_ALLOWED, F_msg: "proto not allowed"}, nil)
 	}
 
 	// 根据协议号断做服务划分
-	// 协议号的划分采用分割协议区间, 用户可以自定义多个区间，用于转发到不同的后端服务
+	// 协议号的划分采用分割协议区间, 用户可以自定义多个区间，用于转发到不同的后端服务，见 --route
 	var ret []byte
-	if b > CONST_GameServerMsgIDBegin {
-		if err := func_ForwardMsgToGameServer(sess, p[4:]); err != nil {
+	if service := a.backend.Route(b); service != "" {
+		if err := a.func_ForwardMsg(sess, service, data); err == ERROR_GAME_STREAM_LOST {
+			// 游戏服正在故障转移，拒绝该消息，客户端收到game_restored_ack后重发
+			LOG.Warningf("游戏服流中断，拒绝消息 userid:%v 协议:%v", sess.UserId, b)
+			return PACKET.Func_Pack(MSGDEFINE.Code["client_error_ack"], MSGDEFINE.S_error_info{F_code: MSGDEFINE.ERR_GAME_SERVICE_LOST, F_msg: "game service lost"}, nil)
+		} else if err != nil {
 			LOG.Errorf("服务 ID:%v 执行失败, 错误信息:%v", b, err)
-			sess.Flag |= SESSION.SESS_KICKED_OUT
+			sess.Kick(MSGDEFINE.ERR_KICK_SERVICE_LOST, "service unavailable")
 			return nil
 		}
 	} else {
@@ -67,7 +130,7 @@ func func_UserMsgHandler(sess *SESSION.Session, p []byte) []byte {
 			ret = h(sess, reader)
 		} else {
 			LOG.Errorf("服务 ID:%v 没有注册处理函数", b)
-			sess.Flag |= SESSION.SESS_KICKED_OUT
+			sess.Kick(MSGDEFINE.ERR_KICK_PROTOCOL, "unknown proto")
 			return nil
 		}
 	}
@@ -0,0 +1,60 @@
+//---------------------------------------------
+package framework
+
+//---------------------------------------------
+import (
+	HTTP "net/http"
+
+	WEBSOCKET "FKGoServer/FKLib_Common/WebSocket"
+
+	LOG "github.com/Sirupsen/logrus"
+)
+
+//---------------------------------------------
+// 新线程，处理WebSocket连接，供无法使用原始Socket的H5客户端接入，直到监听关闭
+// 客户端通过二进制帧发送与TCP完全相同的 SIZE|DATA 字节流，之后的会话处理与TCP连接一致
+// 设置了 --wss-cert 和 --wss-key 时监听已在Start中包装为WSS
+func (a *Agent) func_ServeWebSocket() {
+	a.ws_server.Serve(a.ws)
+}
+
+//---------------------------------------------
+// 创建WebSocket的HTTP服务
+// 未完成升级握手的连接在 --ws-handshake-timeout 后关闭，避免未鉴权的客户端一直占用连接(slowloris)
+// 升级后的连接由HTTP服务交出，之后的读超时见 --idle-timeout；关闭监听时未完成握手的连接一并关闭
+func (a *Agent) func_NewWebSocketServer() *HTTP.Server {
+	upgrader := &WEBSOCKET.Upgrader{CheckOrigin: func_CheckOrigin(a.cfg.WSOrigin)}
+	mux := HTTP.NewServeMux()
+	mux.HandleFunc(a.cfg.WSPath, func(w HTTP.ResponseWriter, r *HTTP.Request) {
+		conn, err := upgrader.Upgrade(w, r)
+		if err != nil {
+			LOG.Warning("WebSocket握手失败:", r.RemoteAddr, err)
+			return
+		}
+		// 连接已被接管，直接在当前协程中处理
+		a.func_HandleNewClientConnect(conn)
+	})
+	return &HTTP.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: a.cfg.WSHandshakeTimeout,
+		ReadTimeout:       a.cfg.WSHandshakeTimeout,
+		IdleTimeout:       a.cfg.WSHandshakeTimeout,
+	}
+}
+
+//---------------------------------------------
+// 允许的来源，为空时允许任意来源
+func func_CheckOrigin(origins []string) func(r *HTTP.Request) bool {
+	if len(origins) == 0 {
+		return nil
+	}
+	allowed := make(map[string]bool)
+	for _, v := range origins {
+		allowed[v] = true
+	}
+	return func(r *HTTP.Request) bool {
+		return allowed[r.Header.Get("Origin")]
+	}
+}
+
+//---------------------------------------------
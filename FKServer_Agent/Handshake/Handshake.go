@@ -0,0 +1,123 @@
+//---------------------------------------------
+package handshake
+
+//---------------------------------------------
+/*
+	客户端连接的握手配置
+	v1: get_seed_req，32位DH+RC4，仅为兼容旧客户端保留
+	v2: key_exchange_req，MODP-2048+RSA签名+AES-GCM，见FKLib_Common/Cipher
+	启用哪些版本由命令行参数 --handshake 决定，默认只启用v1，启用v2时必须以 --handshake-key 指定私钥
+	旧客户端全部升级后可以只保留v2
+	v2握手同时协商数据包压缩算法，见FKLib_Common/Compress，--compress 为空则不压缩
+*/
+//---------------------------------------------
+import (
+	RSA "crypto/rsa"
+	STRINGS "strings"
+	SYNC "sync"
+
+	CIPHER "FKGoServer/FKLib_Common/Cipher"
+	COMPRESS "FKGoServer/FKLib_Common/Compress"
+
+	LOG "github.com/Sirupsen/logrus"
+	CLI "gopkg.in/urfave/cli.v2"
+)
+
+//---------------------------------------------
+type handshake_pool struct {
+	versions map[int32]bool  // 已启用的握手版本
+	key      *RSA.PrivateKey // v2握手的服务器签名私钥
+
+	compress  []int32 // 启用的压缩算法，按优先级排列
+	threshold int     // 超过该长度的数据包才压缩
+	limit     int     // 解压后允许的最大长度
+}
+
+var (
+	_default_pool handshake_pool
+	once          SYNC.Once
+)
+
+//---------------------------------------------
+func InitWithCliContext(c *CLI.Context) {
+	once.Do(func() {
+		_default_pool.init(c.StringSlice("handshake"), c.String("handshake-key"))
+		_default_pool.init_compress(c.StringSlice("compress"), c.Int("compress-threshold"), c.Int("max-message"))
+	})
+}
+
+//---------------------------------------------
+// 不使用命令行参数的初始化，供嵌入Agent与端到端测试使用
+func Init(versions []string, key_path string, compress []string, threshold, limit int) {
+	once.Do(func() {
+		_default_pool.init(versions, key_path)
+		_default_pool.init_compress(compress, threshold, limit)
+	})
+}
+
+//---------------------------------------------
+func (p *handshake_pool) init(versions []string, key_path string) {
+	p.versions = make(map[int32]bool)
+	for _, v := range versions {
+		switch STRINGS.TrimSpace(v) {
+		case "v1":
+			p.versions[CIPHER.HANDSHAKE_V1] = true
+		case "v2":
+			p.versions[CIPHER.HANDSHAKE_V2] = true
+		default:
+			LOG.Warning("未知的握手版本:", v)
+		}
+	}
+	LOG.Println("启用握手版本:", versions)
+
+	if !p.versions[CIPHER.HANDSHAKE_V2] {
+		return
+	}
+	// 临时生成的密钥无法被客户端校验，等同于不校验服务器身份，不允许启动
+	if key_path == "" {
+		LOG.Fatal("启用v2握手必须设置 --handshake-key")
+	}
+	key, err := CIPHER.LoadPrivateKey(key_path)
+	if err != nil {
+		LOG.Fatal("加载握手私钥失败:", err)
+	}
+	p.key = key
+}
+
+//---------------------------------------------
+func (p *handshake_pool) init_compress(names []string, threshold, limit int) {
+	algorithms, err := COMPRESS.ParseAlgorithms(names)
+	if err != nil {
+		LOG.Fatal("未知的压缩算法:", names)
+	}
+	p.compress = algorithms
+	p.threshold = threshold
+	p.limit = limit
+	LOG.Println("启用压缩算法:", names, "压缩阈值:", threshold)
+}
+
+//---------------------------------------------
+// 该握手版本是否已启用
+func Func_Enabled(version int32) bool {
+	return _default_pool.versions[version]
+}
+
+//---------------------------------------------
+// v2握手的服务器签名私钥
+func Func_PrivateKey() *RSA.PrivateKey {
+	return _default_pool.key
+}
+
+//---------------------------------------------
+// 从客户端支持的压缩算法中选取一种，返回nil表示不压缩
+func Func_NegotiateCompress(supported int32) *COMPRESS.Codec {
+	algorithm := COMPRESS.Negotiate(_default_pool.compress, supported)
+	if algorithm == COMPRESS.COMPRESS_NONE {
+		return nil
+	}
+	codec := COMPRESS.NewCodec(algorithm, _default_pool.threshold)
+	codec.SetLimit(_default_pool.limit)
+	return codec
+}
+
+//---------------------------------------------
@@ -0,0 +1,71 @@
+//---------------------------------------------
+package limiter
+
+//---------------------------------------------
+import (
+	TIME "time"
+)
+
+//---------------------------------------------
+// 令牌桶，以Rate个每秒的速度补充令牌，最多积累Burst个
+// 不是协程安全的，由调用者加锁
+type Bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   TIME.Time
+}
+
+//---------------------------------------------
+// 新建的令牌桶是满的
+func NewBucket(rate, burst float64, now TIME.Time) *Bucket {
+	return &Bucket{rate: rate, burst: burst, tokens: burst, last: now}
+}
+
+//---------------------------------------------
+func (b *Bucket) refill(now TIME.Time) {
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
+
+//---------------------------------------------
+// 取一个令牌，令牌不足时不扣除并返回false
+func (b *Bucket) Allow(now TIME.Time) bool {
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true
+	}
+	return false
+}
+
+//---------------------------------------------
+// 预约一个令牌，返回需要等待的时间，令牌可以透支
+// 需要等待的时间超过max时不预约，返回false，透支因此不会超过max内补充的令牌数
+func (b *Bucket) Reserve(now TIME.Time, max TIME.Duration) (TIME.Duration, bool) {
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	wait := TIME.Duration((1 - b.tokens) / b.rate * float64(TIME.Second))
+	if wait > max {
+		return 0, false
+	}
+	b.tokens--
+	return wait, true
+}
+
+//---------------------------------------------
+// 令牌桶是否已经补满，补满的桶可以回收
+func (b *Bucket) Full(now TIME.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+//---------------------------------------------
@@ -0,0 +1,298 @@
+//---------------------------------------------
+package limiter
+
+//---------------------------------------------
+/*
+	基于令牌桶的发包频率限制，分三个维度:
+	session: 每个会话
+	ip:      同一来源IP的全部会话
+	proto:   每个会话的单个协议号，例如聊天比移动更严格
+	每条规则的格式为 rate:burst:action，rate为每秒补充的令牌数，burst为最多积累的令牌数
+	action为超限时的处理方式:
+	drop:  丢弃该数据包
+	delay: 延迟处理该数据包(会话暂停读取客户端消息，其他事务照常处理)，需要等待的时间超过上限时丢弃
+	kick:  踢掉客户端
+	超限次数通过expvar导出，见/debug/vars中的limiter
+	默认不限制，各维度由 --limit-session, --limit-ip, --limit-proto 显式开启
+*/
+//---------------------------------------------
+import (
+	ERRORS "errors"
+	EXPVAR "expvar"
+	FMT "fmt"
+	STRCONV "strconv"
+	STRINGS "strings"
+	SYNC "sync"
+	TIME "time"
+
+	LOG "github.com/Sirupsen/logrus"
+	CLI "gopkg.in/urfave/cli.v2"
+)
+
+//---------------------------------------------
+// 超限时的处理方式，数值越大越严厉
+type Action int
+
+const (
+	ACTION_PASS Action = iota
+	ACTION_DELAY
+	ACTION_DROP
+	ACTION_KICK
+)
+
+var action_names = map[Action]string{
+	ACTION_PASS:  "pass",
+	ACTION_DELAY: "delay",
+	ACTION_DROP:  "drop",
+	ACTION_KICK:  "kick",
+}
+
+func (a Action) String() string {
+	return action_names[a]
+}
+
+//---------------------------------------------
+const (
+	DEFAULT_MAX_DELAY = TIME.Second // delay方式最多等待的时间
+	IP_SWEEP_INTERVAL = TIME.Minute // 回收空闲IP令牌桶的间隔
+)
+
+//---------------------------------------------
+var (
+	ERROR_BAD_RULE = ERRORS.New("bad limit rule")
+
+	_counters = EXPVAR.NewMap("limiter") // scope.action -> 次数
+)
+
+//---------------------------------------------
+// 一条限流规则
+type Rule struct {
+	Rate   float64
+	Burst  float64
+	Action Action
+}
+
+//---------------------------------------------
+// 解析 rate:burst:action
+func ParseRule(s string) (r Rule, err error) {
+	parts := STRINGS.Split(STRINGS.TrimSpace(s), ":")
+	if len(parts) != 3 {
+		return r, FMT.Errorf("%v: %v", ERROR_BAD_RULE, s)
+	}
+	if r.Rate, err = STRCONV.ParseFloat(parts[0], 64); err != nil || r.Rate <= 0 {
+		return r, FMT.Errorf("%v: %v", ERROR_BAD_RULE, s)
+	}
+	if r.Burst, err = STRCONV.ParseFloat(parts[1], 64); err != nil || r.Burst < 1 {
+		return r, FMT.Errorf("%v: %v", ERROR_BAD_RULE, s)
+	}
+	for a, name := range action_names {
+		if a != ACTION_PASS && name == parts[2] {
+			r.Action = a
+			return r, nil
+		}
+	}
+	return r, FMT.Errorf("%v: %v", ERROR_BAD_RULE, s)
+}
+
+//---------------------------------------------
+// 解析 proto=rate:burst:action
+func ParseProtoRule(s string) (proto int16, r Rule, err error) {
+	kv := STRINGS.SplitN(s, "=", 2)
+	if len(kv) != 2 {
+		return 0, r, FMT.Errorf("%v: %v", ERROR_BAD_RULE, s)
+	}
+	id, err := STRCONV.ParseInt(STRINGS.TrimSpace(kv[0]), 10, 16)
+	if err != nil {
+		return 0, r, FMT.Errorf("%v: %v", ERROR_BAD_RULE, s)
+	}
+	r, err = ParseRule(kv[1])
+	return int16(id), r, err
+}
+
+//---------------------------------------------
+// 全部限流规则，以及按IP共享的令牌桶
+type limiter_pool struct {
+	session   *Rule
+	ip        *Rule
+	protos    map[int16]Rule
+	max_delay TIME.Duration
+
+	ips map[string]*Bucket
+	mu  SYNC.Mutex
+}
+
+var (
+	_default_pool limiter_pool
+	once          SYNC.Once
+)
+
+//---------------------------------------------
+func InitWithCliContext(c *CLI.Context) {
+	once.Do(func() {
+		if err := Init(c.String("limit-session"), c.String("limit-ip"), c.StringSlice("limit-proto")); err != nil {
+			LOG.Fatal(err)
+		}
+		go _default_pool.sweeper()
+	})
+}
+
+//---------------------------------------------
+// 直接指定规则初始化，空字符串表示不限制该维度，可重复调用，主要用于测试
+func Init(session, ip string, protos []string) error {
+	return _default_pool.init(session, ip, protos)
+}
+
+//---------------------------------------------
+func (p *limiter_pool) init(session, ip string, protos []string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.session, p.ip = nil, nil
+	p.protos = make(map[int16]Rule)
+	p.ips = make(map[string]*Bucket)
+	p.max_delay = DEFAULT_MAX_DELAY
+
+	if session != "" {
+		r, err := ParseRule(session)
+		if err != nil {
+			return err
+		}
+		p.session = &r
+	}
+	if ip != "" {
+		r, err := ParseRule(ip)
+		if err != nil {
+			return err
+		}
+		p.ip = &r
+	}
+	for _, v := range protos {
+		id, r, err := ParseProtoRule(v)
+		if err != nil {
+			return err
+		}
+		p.protos[id] = r
+	}
+	LOG.Println("限流规则 会话:", session, "IP:", ip, "协议:", protos)
+	return nil
+}
+
+//---------------------------------------------
+// 消耗一个IP令牌
+func (p *limiter_pool) check_ip(ip string, now TIME.Time) (Action, TIME.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ip == nil {
+		return ACTION_PASS, 0
+	}
+	b := p.ips[ip]
+	if b == nil {
+		b = NewBucket(p.ip.Rate, p.ip.Burst, now)
+		p.ips[ip] = b
+	}
+	return func_Check(b, p.ip.Action, now, p.max_delay)
+}
+
+//---------------------------------------------
+// 回收已经补满的IP令牌桶
+func (p *limiter_pool) sweep(now TIME.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for ip, b := range p.ips {
+		if b.Full(now) {
+			delete(p.ips, ip)
+		}
+	}
+}
+
+//---------------------------------------------
+func (p *limiter_pool) sweeper() {
+	for {
+		TIME.Sleep(IP_SWEEP_INTERVAL)
+		p.sweep(TIME.Now())
+	}
+}
+
+//---------------------------------------------
+// delay方式需要等待的时间超过max_delay时改为丢弃，不预约令牌
+func func_Check(b *Bucket, action Action, now TIME.Time, max_delay TIME.Duration) (Action, TIME.Duration) {
+	if action == ACTION_DELAY {
+		d, ok := b.Reserve(now, max_delay)
+		if !ok {
+			return ACTION_DROP, 0
+		}
+		if d > 0 {
+			return ACTION_DELAY, d
+		}
+		return ACTION_PASS, 0
+	}
+	if b.Allow(now) {
+		return ACTION_PASS, 0
+	}
+	return action, 0
+}
+
+//---------------------------------------------
+// 会话的限流状态，只在会话协程中使用
+type Session struct {
+	session *Bucket
+	protos  map[int16]*Bucket
+}
+
+//---------------------------------------------
+func NewSession() *Session {
+	return &Session{protos: make(map[int16]*Bucket)}
+}
+
+//---------------------------------------------
+// 检查一个数据包，返回最严厉的处理方式，以及delay方式需要等待的时间
+// 三个维度的令牌都会被消耗，这样被丢弃的数据包同样会累积到会话和IP的限制中
+func (s *Session) Check(ip string, proto int16, now TIME.Time) (Action, TIME.Duration) {
+	p := &_default_pool
+	action, delay := ACTION_PASS, TIME.Duration(0)
+	merge := func(scope string, a Action, d TIME.Duration) {
+		if a == ACTION_PASS {
+			return
+		}
+		_counters.Add(scope+"."+a.String(), 1)
+		if a > action {
+			action = a
+		}
+		if d > delay {
+			delay = d
+		}
+	}
+
+	if r, ok := p.protos[proto]; ok {
+		b := s.protos[proto]
+		if b == nil {
+			b = NewBucket(r.Rate, r.Burst, now)
+			s.protos[proto] = b
+		}
+		a, d := func_Check(b, r.Action, now, p.max_delay)
+		merge("proto", a, d)
+	}
+	if p.session != nil {
+		if s.session == nil {
+			s.session = NewBucket(p.session.Rate, p.session.Burst, now)
+		}
+		a, d := func_Check(s.session, p.session.Action, now, p.max_delay)
+		merge("session", a, d)
+	}
+	a, d := p.check_ip(ip, now)
+	merge("ip", a, d)
+	return action, delay
+}
+
+//---------------------------------------------
+// 超限次数统计，scope.action -> 次数
+func Func_Counters() map[string]int64 {
+	ret := make(map[string]int64)
+	_counters.Do(func(kv EXPVAR.KeyValue) {
+		if v, ok := kv.Value.(*EXPVAR.Int); ok {
+			ret[kv.Key] = v.Value()
+		}
+	})
+	return ret
+}
+
+//---------------------------------------------
@@ -0,0 +1,155 @@
+//---------------------------------------------
+package limiter
+
+//---------------------------------------------
+import (
+	"testing"
+	TIME "time"
+)
+
+//---------------------------------------------
+func TestBucket(t *testing.T) {
+	now := TIME.Now()
+	b := NewBucket(10, 3, now)
+	for i := 0; i < 3; i++ {
+		if !b.Allow(now) {
+			t.Fatal("burst should pass:", i)
+		}
+	}
+	if b.Allow(now) {
+		t.Error("bucket should be empty")
+	}
+	// 100ms补充一个令牌
+	if !b.Allow(now.Add(100 * TIME.Millisecond)) {
+		t.Error("token should be refilled")
+	}
+
+	// 透支预约
+	b = NewBucket(10, 1, now)
+	if d, ok := b.Reserve(now, TIME.Second); d != 0 || !ok {
+		t.Error("first reserve should not wait:", d)
+	}
+	if d, ok := b.Reserve(now, TIME.Second); d != 100*TIME.Millisecond || !ok {
+		t.Error("second reserve should wait 100ms:", d)
+	}
+	// 等待超过上限时不预约
+	if d, ok := b.Reserve(now, 150*TIME.Millisecond); ok {
+		t.Error("reserve over max should fail:", d)
+	}
+	if b.Full(now.Add(150 * TIME.Millisecond)) {
+		t.Error("bucket should not be full yet")
+	}
+	if !b.Full(now.Add(TIME.Second)) {
+		t.Error("bucket should be full")
+	}
+}
+
+//---------------------------------------------
+func TestParseRule(t *testing.T) {
+	r, err := ParseRule("20:40:kick")
+	if err != nil || r.Rate != 20 || r.Burst != 40 || r.Action != ACTION_KICK {
+		t.Error("parse:", r, err)
+	}
+	for _, s := range []string{"20:40", "0:40:drop", "20:0:drop", "20:40:ban", "x:40:drop"} {
+		if _, err := ParseRule(s); err == nil {
+			t.Errorf("%q should fail", s)
+		}
+	}
+	if id, r, err := ParseProtoRule("1001=1:2:drop"); err != nil || id != 1001 || r.Action != ACTION_DROP {
+		t.Error("parse proto:", id, r, err)
+	}
+}
+
+//---------------------------------------------
+func TestSessionCheck(t *testing.T) {
+	if err := Init("100:5:kick", "", []string{"1001=1:2:drop"}); err != nil {
+		t.Fatal(err)
+	}
+	now := TIME.Now()
+	s := NewSession()
+
+	// 协议1001只允许2个
+	for i := 0; i < 2; i++ {
+		if a, _ := s.Check("1.1.1.1", 1001, now); a != ACTION_PASS {
+			t.Fatal("should pass:", i, a)
+		}
+	}
+	if a, _ := s.Check("1.1.1.1", 1001, now); a != ACTION_DROP {
+		t.Error("proto limit should drop:", a)
+	}
+	// 其他协议不受影响，但会话总量只剩2个
+	for i := 0; i < 2; i++ {
+		if a, _ := s.Check("1.1.1.1", 1002, now); a != ACTION_PASS {
+			t.Fatal("should pass:", i, a)
+		}
+	}
+	if a, _ := s.Check("1.1.1.1", 1002, now); a != ACTION_KICK {
+		t.Error("session limit should kick:", a)
+	}
+	if Func_Counters()["session.kick"] < 1 || Func_Counters()["proto.drop"] < 1 {
+		t.Error("counters:", Func_Counters())
+	}
+}
+
+//---------------------------------------------
+func TestIPDelay(t *testing.T) {
+	if err := Init("", "10:2:delay", nil); err != nil {
+		t.Fatal(err)
+	}
+	now := TIME.Now()
+	s1, s2 := NewSession(), NewSession()
+
+	// 同一IP的两个会话共享令牌
+	s1.Check("2.2.2.2", 0, now)
+	s2.Check("2.2.2.2", 0, now)
+	if a, d := s1.Check("2.2.2.2", 0, now); a != ACTION_DELAY || d != 100*TIME.Millisecond {
+		t.Error("ip limit should delay 100ms:", a, d)
+	}
+	// 其他IP不受影响
+	if a, _ := s2.Check("3.3.3.3", 0, now); a != ACTION_PASS {
+		t.Error("other ip should pass:", a)
+	}
+	// 透支太多时改为丢弃
+	for i := 0; i < 20; i++ {
+		s1.Check("2.2.2.2", 0, now)
+	}
+	if a, _ := s1.Check("2.2.2.2", 0, now); a != ACTION_DROP {
+		t.Error("long delay should drop:", a)
+	}
+
+	// 回收补满的令牌桶
+	_default_pool.sweep(now.Add(TIME.Hour))
+	if len(_default_pool.ips) != 0 {
+		t.Error("idle ip buckets should be swept")
+	}
+}
+
+//---------------------------------------------
+// 持续超限被丢弃的数据包不会累积透支，停止发包后很快恢复
+func TestDelayRecover(t *testing.T) {
+	if err := Init("10:2:delay", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	now := TIME.Now()
+	s := NewSession()
+
+	drop := 0
+	for i := 0; i < 1000; i++ {
+		if a, d := s.Check("4.4.4.4", 0, now); a == ACTION_DROP {
+			drop++
+		} else if d > DEFAULT_MAX_DELAY {
+			t.Fatal("delay over max:", d)
+		}
+	}
+	if drop == 0 {
+		t.Fatal("flood should be dropped")
+	}
+
+	// 透支最多为max_delay内补充的令牌，等待已经延迟的数据包处理完，再经过burst/rate后恢复
+	later := now.Add(DEFAULT_MAX_DELAY + 2*TIME.Second/10)
+	if a, d := s.Check("4.4.4.4", 0, later); a != ACTION_PASS {
+		t.Error("should pass after flood stops:", a, d)
+	}
+}
+
+//---------------------------------------------
@@ -3,19 +3,22 @@ package msg
 
 //---------------------------------------------
 import (
-	RC4 "crypto/rc4"
 	FMT "fmt"
-	IO "io"
 	BIG "math/big"
+	TIME "time"
 
+	CIPHER "FKGoServer/FKLib_Common/Cipher"
 	DH "FKGoServer/FKLib_Common/DH"
-	SERVICES "FKGoServer/FKLib_Common/Service"
+	AUTH "FKGoServer/FKServer_Agent/Auth"
+	BACKEND "FKGoServer/FKServer_Agent/Backend"
+	CAPTURE "FKGoServer/FKServer_Agent/Capture"
+	DATAGRAM "FKGoServer/FKServer_Agent/Datagram"
+	HANDSHAKE "FKGoServer/FKServer_Agent/Handshake"
 	PROTO "FKGoServer/FKServer_Agent/Proto"
 	SESSION "FKGoServer/FKServer_Agent/Session"
+	VERSION "FKGoServer/FKServer_Agent/Version"
 
 	LOG "github.com/Sirupsen/logrus"
-	CONTEXT "golang.org/x/net/context"
-	METADATA "google.golang.org/grpc/metadata"
 
 	MSGDEFINE "FKGoServer/FKLib_Common/MsgDefine"
 	PACKET "FKGoServer/FKLib_Common/Packet"
@@ -31,7 +34,12 @@ func init() {
 	Handlers = map[int16]func(*SESSION.Session, *PACKET.Packet) []byte{
 		0:  P_heart_beat_req,
 		10: P_user_login_req,
+		16: P_session_resume_req,
 		30: P_get_seed_req,
+		32: P_key_exchange_req,
+		23: P_server_pong_req,
+		35: P_kcp_profile_req,
+		37: P_client_version_req,
 	}
 }
 
@@ -43,14 +51,42 @@ func P_heart_beat_req(sess *SESSION.Session, reader *PACKET.Packet) []byte {
 }
 
 //---------------------------------------------
-// 密钥交换
+// 客户端回复Agent发起的ping
+// 更新会话的往返时延，并以Latency帧通知游戏服，供逻辑进行延迟补偿
+func P_server_pong_req(sess *SESSION.Session, reader *PACKET.Packet) []byte {
+	tbl, _ := MSGDEFINE.PKT_auto_id(reader)
+	if sess.PingTime.IsZero() || tbl.F_id != sess.PingId { // 过期或伪造的回复
+		return nil
+	}
+	now := TIME.Now()
+	sess.UpdateRTT(now.Sub(sess.PingTime), now)
+	sess.PingTime = TIME.Time{}
+
+	if sess.Stream != nil {
+		frame := &PROTO.Game_Frame{
+			Type:   PROTO.Game_Latency,
+			Rtt:    int32(sess.RTT / TIME.Millisecond),
+			Jitter: int32(sess.Jitter / TIME.Millisecond),
+		}
+		if err := sess.Stream.Send(frame); err != nil {
+			LOG.Warningf("通知游戏服往返时延失败 userid:%v 错误原因:%v", sess.UserId, err)
+		}
+	}
+	return nil
+}
+
+//---------------------------------------------
+// 密钥交换(v1)
 // 加密建立方式: DH+RC4
 // 注意:完整的加密过程包括 RSA+DH+RC4
-// 1. RSA用于鉴定服务器的真伪(这步省略)
+// 1. RSA用于鉴定服务器的真伪(这步省略，v2握手中补全，见P_key_exchange_req)
 // 2. DH用于在不安全的信道上协商安全的KEY
 // 3. RC4用于流加密
 func P_get_seed_req(sess *SESSION.Session, reader *PACKET.Packet) []byte {
 	tbl, _ := MSGDEFINE.PKT_seed_info(reader)
+	if !HANDSHAKE.Func_Enabled(CIPHER.HANDSHAKE_V1) {
+		return PACKET.Func_Pack(MSGDEFINE.Code["key_exchange_faild_ack"], MSGDEFINE.S_error_info{F_code: MSGDEFINE.ERR_HANDSHAKE_VERSION, F_msg: "handshake v1 disabled"}, nil)
+	}
 	// KEY1
 	X1, E1 := DH.DHExchange()
 	KEY1 := DH.DHKey(X1, BIG.NewInt(int64(tbl.F_client_send_seed)))
@@ -61,12 +97,12 @@ func P_get_seed_req(sess *SESSION.Session, reader *PACKET.Packet) []byte {
 
 	ret := MSGDEFINE.S_seed_info{int32(E1.Int64()), int32(E2.Int64())}
 	// 服务器加密种子是客户端解密种子
-	encoder, err := RC4.NewCipher([]byte(FMT.Sprintf("%v%v", MSGDEFINE.SALT, KEY2)))
+	encoder, err := CIPHER.NewRC4Codec([]byte(FMT.Sprintf("%v%v", MSGDEFINE.SALT, KEY2)))
 	if err != nil {
 		LOG.Error(err)
 		return nil
 	}
-	decoder, err := RC4.NewCipher([]byte(FMT.Sprintf("%v%v", MSGDEFINE.SALT, KEY1)))
+	decoder, err := CIPHER.NewRC4Codec([]byte(FMT.Sprintf("%v%v", MSGDEFINE.SALT, KEY1)))
 	if err != nil {
 		LOG.Error(err)
 		return nil
@@ -74,57 +110,167 @@ func P_get_seed_req(sess *SESSION.Session, reader *PACKET.Packet) []byte {
 	sess.Encoder = encoder
 	sess.Decoder = decoder
 	sess.Flag |= SESSION.SESS_KEYEXCG
+	sess.SetState(SESSION.STATE_KEYEXCHANGED)
 	return PACKET.Func_Pack(MSGDEFINE.Code["get_seed_ack"], ret, nil)
 }
 
+//---------------------------------------------
+// 密钥交换(v2)
+// 加密建立方式: MODP-2048 DH + RSA签名 + AES-256-GCM
+// 客户端预置服务器的RSA公钥，用于校验回复中的签名，校验通过后双方切换到AES-GCM
+// 客户端可以发送更高的版本号，服务器回复实际使用的版本
+func P_key_exchange_req(sess *SESSION.Session, reader *PACKET.Packet) []byte {
+	tbl, _ := MSGDEFINE.PKT_key_exchange_info(reader)
+	if sess.Flag&(SESSION.SESS_KEYEXCG|SESSION.SESS_ENCRYPT) != 0 {
+		LOG.Warningf("重复的密钥交换 会话IP:%v", sess.IP)
+		sess.Kick(MSGDEFINE.ERR_KICK_PROTOCOL, "repeated key exchange")
+		return nil
+	}
+	if tbl.F_version < CIPHER.HANDSHAKE_V2 || !HANDSHAKE.Func_Enabled(CIPHER.HANDSHAKE_V2) {
+		return PACKET.Func_Pack(MSGDEFINE.Code["key_exchange_faild_ack"], MSGDEFINE.S_error_info{F_code: MSGDEFINE.ERR_HANDSHAKE_VERSION, F_msg: "handshake version unsupported"}, nil)
+	}
+
+	hello, encoder, decoder, err := CIPHER.ServerHandshake(HANDSHAKE.Func_PrivateKey(), []byte(tbl.F_nonce), []byte(tbl.F_public))
+	if err != nil {
+		LOG.Warningf("握手失败 会话IP:%v 错误原因:%v", sess.IP, err)
+		return PACKET.Func_Pack(MSGDEFINE.Code["key_exchange_faild_ack"], MSGDEFINE.S_error_info{F_code: MSGDEFINE.ERR_HANDSHAKE_FAILED, F_msg: "handshake failed"}, nil)
+	}
+	sess.Encoder = encoder
+	sess.Decoder = decoder
+	sess.Flag |= SESSION.SESS_KEYEXCG
+	sess.SetState(SESSION.STATE_KEYEXCHANGED)
+
+	// 协商压缩算法，与加密同时生效
+	ret := MSGDEFINE.S_key_exchange_info{
+		F_version:   CIPHER.HANDSHAKE_V2,
+		F_nonce:     string(hello.Nonce),
+		F_public:    string(hello.Public),
+		F_signature: string(hello.Signature),
+	}
+	if sess.Compressor = HANDSHAKE.Func_NegotiateCompress(tbl.F_compress); sess.Compressor != nil {
+		ret.F_compress = sess.Compressor.Algorithm()
+	}
+	return PACKET.Func_Pack(MSGDEFINE.Code["key_exchange_ack"], ret, nil)
+}
+
 //---------------------------------------------
 // 玩家登陆过程
 func P_user_login_req(sess *SESSION.Session, reader *PACKET.Packet) []byte {
-	// TODO: 登陆鉴权
-	// 简单鉴权可以在agent直接完成，通常公司都存在一个用户中心服务器用于鉴权
-	sess.UserId = 1
+	tbl, _ := MSGDEFINE.PKT_user_login_info(reader)
+
+	// 未经版本协商的旧客户端，按登陆信息中的版本检查，版本过低时msg为新版本的下载地址
+	if sess.VersionPolicy == nil {
+		if policy, err := func_NegotiateVersion(sess, tbl.F_client_version); err != nil {
+			return PACKET.Func_Pack(MSGDEFINE.Code["user_login_faild_ack"], MSGDEFINE.S_error_info{F_code: MSGDEFINE.ERR_VERSION_TOO_OLD, F_msg: policy.URL}, nil)
+		}
+	}
 
-	// TODO: 选择GAME服务器
-	// 选服策略依据业务进行，比如小服可以固定选取某台，大服可以采用HASH或一致性HASH
-	sess.GSID = MSGDEFINE.DEFAULT_GSID
+	// 登陆鉴权
+	// 简单鉴权可以在agent直接完成，通常公司都存在一个用户中心服务器用于鉴权
+	userid, err := AUTH.Func_Authenticate(&tbl)
+	if err != nil {
+		LOG.Warningf("登陆鉴权失败 会话IP:%v 登陆方式:%v 错误原因:%v", sess.IP, tbl.F_login_way, err)
+		return PACKET.Func_Pack(MSGDEFINE.Code["user_login_faild_ack"], AUTH.Func_ErrorInfo(err), nil)
+	}
+	sess.UserId = userid
+	sess.SetState(SESSION.STATE_AUTHENTICATED)
 
-	// 连接到已选定GAME服务器
-	conn := SERVICES.GetServiceWithId("game-10000", sess.GSID)
-	if conn == nil {
-		LOG.Error("cannot get game service:", sess.GSID)
-		return nil
+	// 选择GAME服务器
+	// 选服策略依据业务进行，比如小服可以固定选取某台，大服可以采用HASH或一致性HASH，见 --game-select
+	gsid := sess.Backend.SelectGame(sess.UserId)
+	if gsid == "" {
+		LOG.Error("没有可用的游戏服务器")
+		return PACKET.Func_Pack(MSGDEFINE.Code["user_login_faild_ack"], MSGDEFINE.S_error_info{F_code: MSGDEFINE.ERR_LOGIN_NO_GAME_SERVER, F_msg: "no game server"}, nil)
 	}
-	cli := PROTO.NewGameServiceClient(conn)
 
-	// 开启到游戏服的流
-	ctx := METADATA.NewContext(CONTEXT.Background(), METADATA.New(map[string]string{"userid": FMT.Sprint(sess.UserId)}))
-	stream, err := cli.Stream(ctx)
+	// 连接到已选定GAME服务器，开启到游戏服的流
+	stream, err := sess.Backend.OpenGameStream(sess, gsid)
 	if err != nil {
-		LOG.Error(err)
-		return nil
+		LOG.Error("无法连接游戏服:", gsid, " 错误原因:", err)
+		sess.Backend.ReleaseGame(gsid)
+		return PACKET.Func_Pack(MSGDEFINE.Code["user_login_faild_ack"], MSGDEFINE.S_error_info{F_code: MSGDEFINE.ERR_LOGIN_NO_GAME_SERVER, F_msg: "no game server"}, nil)
 	}
+	sess.GSID = gsid
 	sess.Stream = stream
+	sess.SetState(SESSION.STATE_INGAME)
 
-	// 读取GAME返回消息的goroutine
-	fetcher_task := func(sess *SESSION.Session) {
-		for {
-			in, err := sess.Stream.Recv()
-			if err == IO.EOF { // 流关闭
-				LOG.Debug(err)
-				return
-			}
-			if err != nil {
-				LOG.Error(err)
-				return
-			}
-			select {
-			case sess.MQ <- *in:
-			case <-sess.Die:
-			}
+	// 登陆成功的会话可以在断线后恢复，从登陆成功回复开始记录下发的数据包
+	sess.ResumeToken = SESSION.Func_NewResumeToken()
+	sess.Outbox = SESSION.NewOutbox(SESSION.DEFAULT_OUTBOX_SIZE)
+	SESSION.Func_RegisterResumable(sess.ResumeToken, sess)
+	// 开启不可靠数据报通道，凭证随登陆结果下发
+	if sess.Supports(VERSION.FEATURE_DATAGRAM) {
+		sess.Datagram = DATAGRAM.Func_Open()
+	}
+	// 登记到在线表，同一玩家之前的登陆会被踢掉
+	BACKEND.Func_ClaimUser(sess)
+	// 游戏服按玩家ID组播
+	SESSION.Func_RegisterUser(sess.UserId, sess)
+	// 按玩家或采样开启抓包，见 --capture-dir
+	if CAPTURE.Func_ShouldCapture(sess.UserId) {
+		if w, err := CAPTURE.Func_Open(sess.UserId); err != nil {
+			LOG.Warningf("创建抓包文件失败 userid:%v 错误原因:%v", sess.UserId, err)
+		} else {
+			sess.Capture = w
+			LOG.Infof("开始抓包 userid:%v", sess.UserId)
 		}
 	}
-	go fetcher_task(sess)
-	return PACKET.Func_Pack(MSGDEFINE.Code["user_login_succeed_ack"], MSGDEFINE.S_user_snapshot{F_uid: sess.UserId}, nil)
+	return PACKET.Func_Pack(MSGDEFINE.Code["user_login_succeed_ack"], MSGDEFINE.S_user_snapshot{F_uid: sess.UserId, F_resume_token: sess.ResumeToken, F_datagram_token: sess.Datagram.Token()}, nil)
+}
+
+//---------------------------------------------
+// 恢复会话
+// 客户端断线重连后，在新连接上完成密钥交换，然后凭登陆时下发的恢复凭证找回原会话
+// 实际的接管过程由会话协程完成，见framework中的func_ResumeSession
+func P_session_resume_req(sess *SESSION.Session, reader *PACKET.Packet) []byte {
+	tbl, _ := MSGDEFINE.PKT_resume_info(reader)
+	if sess.UserId != 0 || tbl.F_token == "" || tbl.F_count < 0 {
+		return PACKET.Func_Pack(MSGDEFINE.Code["session_resume_faild_ack"], MSGDEFINE.S_error_info{F_code: MSGDEFINE.ERR_RESUME_INVALID_TOKEN, F_msg: "invalid resume token"}, nil)
+	}
+	sess.ResumeToken = tbl.F_token
+	sess.ResumeCount = uint32(tbl.F_count)
+	sess.Flag |= SESSION.SESS_RESUME
+	return nil
+}
+
+//---------------------------------------------
+// 切换KCP调优参数
+// 只作用于KCP连接，需要开启 --kcp-negotiate，回复中为实际生效的参数
+func P_kcp_profile_req(sess *SESSION.Session, reader *PACKET.Packet) []byte {
+	tbl, _ := MSGDEFINE.PKT_kcp_profile(reader)
+	if sess.KCP == nil {
+		return PACKET.Func_Pack(MSGDEFINE.Code["kcp_profile_ack"], MSGDEFINE.S_kcp_profile{}, nil)
+	}
+	if err := sess.KCP.SetProfile(tbl.F_name); err != nil {
+		LOG.Warningf("切换KCP调优参数失败 userid:%v 会话IP:%v 参数:%v 错误原因:%v", sess.UserId, sess.IP, tbl.F_name, err)
+	}
+	return PACKET.Func_Pack(MSGDEFINE.Code["kcp_profile_ack"], MSGDEFINE.S_kcp_profile{F_name: sess.KCP.Profile()}, nil)
+}
+
+//---------------------------------------------
+// 客户端协议版本协商
+// 在登陆前发送，版本过低时回复新版本的下载地址，之后的登陆同样被拒绝
+// 客户端可以发送更高的版本号，服务器回复会话实际使用的版本
+func P_client_version_req(sess *SESSION.Session, reader *PACKET.Packet) []byte {
+	tbl, _ := MSGDEFINE.PKT_version_info(reader)
+	policy, err := func_NegotiateVersion(sess, tbl.F_version)
+	if err != nil {
+		return PACKET.Func_Pack(MSGDEFINE.Code["client_version_faild_ack"], MSGDEFINE.S_update_info{F_code: MSGDEFINE.ERR_VERSION_TOO_OLD, F_msg: "update required", F_url: policy.URL}, nil)
+	}
+	return PACKET.Func_Pack(MSGDEFINE.Code["client_version_ack"], MSGDEFINE.S_version_info{F_version: sess.Version, F_min_version: policy.Min, F_max_version: policy.Max}, nil)
+}
+
+//---------------------------------------------
+// 按当前的版本策略协商客户端版本，成功后记录在会话中
+func func_NegotiateVersion(sess *SESSION.Session, version int32) (*VERSION.Policy, error) {
+	policy := VERSION.Func_Policy()
+	v, err := policy.Negotiate(version)
+	if err != nil {
+		LOG.Warningf("客户端版本过低 会话IP:%v 客户端版本:%v 最低版本:%v", sess.IP, version, policy.Min)
+		return policy, err
+	}
+	sess.Version, sess.VersionPolicy = v, policy
+	return policy, nil
 }
 
 //---------------------------------------------
@@ -0,0 +1,78 @@
+//---------------------------------------------
+package presence
+
+//---------------------------------------------
+import (
+	SYNC "sync"
+
+	LOG "github.com/Sirupsen/logrus"
+)
+
+//---------------------------------------------
+// 进程内的在线表
+// 多个Agent共用同一个Memory时可以模拟集群，用于测试
+type Memory struct {
+	owners   map[int32]string         // userid -> owner
+	watchers map[string]chan Eviction // agent -> 通知队列
+	SYNC.Mutex
+}
+
+//---------------------------------------------
+func NewMemory() *Memory {
+	return &Memory{
+		owners:   make(map[int32]string),
+		watchers: make(map[string]chan Eviction),
+	}
+}
+
+//---------------------------------------------
+func (m *Memory) Claim(userid int32, owner string) (string, error) {
+	m.Lock()
+	defer m.Unlock()
+	prev := m.owners[userid]
+	m.owners[userid] = owner
+	if prev != "" && prev != owner {
+		m.notify(Eviction{UserId: userid, Owner: prev, By: owner})
+	}
+	return prev, nil
+}
+
+//---------------------------------------------
+func (m *Memory) Release(userid int32, owner string) error {
+	m.Lock()
+	if m.owners[userid] == owner {
+		delete(m.owners, userid)
+	}
+	m.Unlock()
+	return nil
+}
+
+//---------------------------------------------
+func (m *Memory) Watch(agent string) <-chan Eviction {
+	m.Lock()
+	defer m.Unlock()
+	return m.watcher(agent)
+}
+
+//---------------------------------------------
+// 必须持有锁
+func (m *Memory) watcher(agent string) chan Eviction {
+	ch := m.watchers[agent]
+	if ch == nil {
+		ch = make(chan Eviction, DEFAULT_EVICTION_QUEUE)
+		m.watchers[agent] = ch
+	}
+	return ch
+}
+
+//---------------------------------------------
+// 必须持有锁
+func (m *Memory) notify(ev Eviction) {
+	select {
+	case m.watcher(Func_AgentOf(ev.Owner)) <- ev:
+	default:
+		LOG.Warningf("重复登陆通知队列已满 userid:%v owner:%v", ev.UserId, ev.Owner)
+	}
+}
+
+//---------------------------------------------
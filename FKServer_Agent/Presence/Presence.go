@@ -0,0 +1,65 @@
+//---------------------------------------------
+package presence
+
+//---------------------------------------------
+/*
+	集群范围的玩家在线表，防止同一玩家通过不同的Agent重复登陆
+	每次登陆成功时以owner(Agent标识/会话编号)登记玩家，覆盖之前的登记
+	被覆盖的owner所在的Agent收到Eviction通知，踢掉对应的旧会话
+	同一Agent上的重复登陆同样通过通知处理，本Agent也会收到自己的通知
+	实现:
+	memory: 进程内的在线表，只能发现同一Agent上的重复登陆，也用于测试
+	etcd:   见FKServer_Agent/Backend/Presence.go
+*/
+//---------------------------------------------
+import (
+	FMT "fmt"
+	STRINGS "strings"
+	ATOMIC "sync/atomic"
+)
+
+//---------------------------------------------
+const (
+	DEFAULT_EVICTION_QUEUE = 1024 // 每个Agent的通知队列长度
+)
+
+//---------------------------------------------
+// 旧登陆被覆盖的通知
+type Eviction struct {
+	UserId int32
+	Owner  string // 被覆盖的owner
+	By     string // 新的owner
+}
+
+//---------------------------------------------
+// 在线表
+type Registry interface {
+	// 登记玩家由owner持有，返回之前的owner，没有时为空
+	Claim(userid int32, owner string) (string, error)
+	// 玩家下线，仅当仍由owner持有时才移除
+	Release(userid int32, owner string) error
+	// 持有者属于agent的登记被覆盖时的通知
+	Watch(agent string) <-chan Eviction
+}
+
+//---------------------------------------------
+var (
+	_owner_seq uint64
+)
+
+//---------------------------------------------
+// 为本Agent上一次新的登陆生成owner
+func Func_NewOwner(agent string) string {
+	return FMT.Sprintf("%v/%v", agent, ATOMIC.AddUint64(&_owner_seq, 1))
+}
+
+//---------------------------------------------
+// owner所在的Agent
+func Func_AgentOf(owner string) string {
+	if i := STRINGS.LastIndex(owner, "/"); i >= 0 {
+		return owner[:i]
+	}
+	return owner
+}
+
+//---------------------------------------------
@@ -0,0 +1,61 @@
+//---------------------------------------------
+package presence
+
+//---------------------------------------------
+import (
+	"testing"
+)
+
+//---------------------------------------------
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	a1, a2 := Func_NewOwner("agent-a"), Func_NewOwner("agent-a")
+	b1 := Func_NewOwner("agent-b")
+	if a1 == a2 || Func_AgentOf(a1) != "agent-a" {
+		t.Fatal("owner got", a1, a2)
+	}
+
+	if prev, _ := m.Claim(1, a1); prev != "" {
+		t.Error("first claim got", prev)
+	}
+	// 其他Agent上的重复登陆，通知原Agent
+	if prev, _ := m.Claim(1, b1); prev != a1 {
+		t.Error("second claim got", prev)
+	}
+	select {
+	case ev := <-m.Watch("agent-a"):
+		if ev.UserId != 1 || ev.Owner != a1 || ev.By != b1 {
+			t.Error("eviction got", ev)
+		}
+	default:
+		t.Error("agent-a should be notified")
+	}
+
+	// 同一Agent上的重复登陆
+	m.Claim(1, a2)
+	select {
+	case ev := <-m.Watch("agent-b"):
+		if ev.Owner != b1 {
+			t.Error("eviction got", ev)
+		}
+	default:
+		t.Error("agent-b should be notified")
+	}
+
+	// 旧会话下线不影响新的登记
+	m.Release(1, b1)
+	if prev, _ := m.Claim(1, a2); prev != a2 {
+		t.Error("stale release removed new owner:", prev)
+	}
+	select {
+	case ev := <-m.Watch("agent-a"):
+		t.Error("reclaim by same owner should not notify:", ev)
+	default:
+	}
+	m.Release(1, a2)
+	if prev, _ := m.Claim(1, a1); prev != "" {
+		t.Error("released user got", prev)
+	}
+}
+
+//---------------------------------------------
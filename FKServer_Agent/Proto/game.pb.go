@@ -6,9 +6,11 @@
 Package proto is a generated protocol buffer package.
 
 It is generated from these files:
+
 	game.proto
 
 It has these top-level messages:
+
 	Game
 */
 package proto
@@ -30,20 +32,41 @@ var _ = math.Inf
 type Game_FrameType int32
 
 const (
-	Game_Message Game_FrameType = 0
-	Game_Kick    Game_FrameType = 1
-	Game_Ping    Game_FrameType = 2
+	Game_Message    Game_FrameType = 0
+	Game_Kick       Game_FrameType = 1
+	Game_Ping       Game_FrameType = 2
+	Game_Redirect   Game_FrameType = 3
+	Game_Broadcast  Game_FrameType = 4
+	Game_Multicast  Game_FrameType = 5
+	Game_GroupJoin  Game_FrameType = 6
+	Game_GroupLeave Game_FrameType = 7
+	Game_Datagram   Game_FrameType = 8
+	Game_Latency    Game_FrameType = 9
 )
 
 var Game_FrameType_name = map[int32]string{
 	0: "Message",
 	1: "Kick",
 	2: "Ping",
+	3: "Redirect",
+	4: "Broadcast",
+	5: "Multicast",
+	6: "GroupJoin",
+	7: "GroupLeave",
+	8: "Datagram",
+	9: "Latency",
 }
 var Game_FrameType_value = map[string]int32{
-	"Message": 0,
-	"Kick":    1,
-	"Ping":    2,
+	"Message":    0,
+	"Kick":       1,
+	"Ping":       2,
+	"Redirect":   3,
+	"Broadcast":  4,
+	"Multicast":  5,
+	"GroupJoin":  6,
+	"GroupLeave": 7,
+	"Datagram":   8,
+	"Latency":    9,
 }
 
 func (x Game_FrameType) String() string {
@@ -60,6 +83,13 @@ func (*Game) ProtoMessage()    {}
 type Game_Frame struct {
 	Type    Game_FrameType `protobuf:"varint,1,opt,name=Type,enum=proto.Game_FrameType" json:"Type,omitempty"`
 	Message []byte         `protobuf:"bytes,2,opt,name=Message,proto3" json:"Message,omitempty"`
+	Target  string         `protobuf:"bytes,3,opt,name=Target" json:"Target,omitempty"`
+	UserIds []int32        `protobuf:"varint,4,rep,packed,name=UserIds" json:"UserIds,omitempty"`
+	Group   string         `protobuf:"bytes,5,opt,name=Group" json:"Group,omitempty"`
+	Code    int32          `protobuf:"varint,6,opt,name=Code" json:"Code,omitempty"`
+	Reason  string         `protobuf:"bytes,7,opt,name=Reason" json:"Reason,omitempty"`
+	Rtt     int32          `protobuf:"varint,8,opt,name=Rtt" json:"Rtt,omitempty"`
+	Jitter  int32          `protobuf:"varint,9,opt,name=Jitter" json:"Jitter,omitempty"`
 }
 
 func (m *Game_Frame) Reset()         { *m = Game_Frame{} }
@@ -0,0 +1,141 @@
+//---------------------------------------------
+package proxy
+
+//---------------------------------------------
+/*
+	HAProxy PROXY协议头解析，见 http://www.haproxy.org/download/1.8/doc/proxy-protocol.txt
+	v1(文本): PROXY TCP4 源地址 目标地址 源端口 目标端口\r\n，最长107字节
+	v2(二进制): 12B签名 | 1B版本与命令 | 1B地址族与协议 | 2B地址长度 | 地址 | TLV
+	LOCAL命令(负载均衡器自身的健康检查)与UNKNOWN地址族不携带客户端地址，沿用连接的地址
+*/
+//---------------------------------------------
+import (
+	BUFIO "bufio"
+	BYTES "bytes"
+	BINARY "encoding/binary"
+	ERRORS "errors"
+	IO "io"
+	NET "net"
+	STRCONV "strconv"
+	STRINGS "strings"
+)
+
+//---------------------------------------------
+const (
+	V1_MAX_LENGTH = 107 // v1协议头的最大长度，包括\r\n
+	V2_HEADER_LEN = 16  // v2协议头的固定部分长度
+
+	v2_cmd_local = 0x0
+	v2_cmd_proxy = 0x1
+
+	v2_family_inet  = 0x1
+	v2_family_inet6 = 0x2
+)
+
+//---------------------------------------------
+var (
+	ERROR_NO_HEADER  = ERRORS.New("proxy header missing")
+	ERROR_BAD_HEADER = ERRORS.New("bad proxy header")
+
+	v1_signature = []byte("PROXY ")
+	v2_signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+//---------------------------------------------
+// 读取PROXY协议头，返回客户端的真实地址
+// 协议头不携带地址(LOCAL, UNKNOWN)时返回nil
+func ReadHeader(r *BUFIO.Reader) (*NET.TCPAddr, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	switch b[0] {
+	case v1_signature[0]:
+		return func_ReadV1(r)
+	case v2_signature[0]:
+		return func_ReadV2(r)
+	}
+	return nil, ERROR_NO_HEADER
+}
+
+//---------------------------------------------
+func func_ReadV1(r *BUFIO.Reader) (*NET.TCPAddr, error) {
+	// 读取到\r\n为止，超过最大长度视为错误
+	line := make([]byte, 0, V1_MAX_LENGTH)
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, c)
+		if BYTES.HasSuffix(line, []byte("\r\n")) {
+			break
+		}
+		if len(line) >= V1_MAX_LENGTH {
+			return nil, ERROR_BAD_HEADER
+		}
+	}
+	if !BYTES.HasPrefix(line, v1_signature) {
+		return nil, ERROR_NO_HEADER
+	}
+
+	fields := STRINGS.Fields(string(line[len(v1_signature) : len(line)-2]))
+	if len(fields) > 0 && fields[0] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 5 || (fields[0] != "TCP4" && fields[0] != "TCP6") {
+		return nil, ERROR_BAD_HEADER
+	}
+	ip := NET.ParseIP(fields[1])
+	if ip == nil || (fields[0] == "TCP4") != (ip.To4() != nil) {
+		return nil, ERROR_BAD_HEADER
+	}
+	port, err := STRCONV.ParseUint(fields[3], 10, 16)
+	if err != nil {
+		return nil, ERROR_BAD_HEADER
+	}
+	return &NET.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+//---------------------------------------------
+func func_ReadV2(r *BUFIO.Reader) (*NET.TCPAddr, error) {
+	header := make([]byte, V2_HEADER_LEN)
+	if _, err := IO.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if !BYTES.Equal(header[:12], v2_signature) {
+		return nil, ERROR_NO_HEADER
+	}
+	if header[12]>>4 != 0x2 {
+		return nil, ERROR_BAD_HEADER
+	}
+	// 地址与TLV一并读出，TLV忽略
+	body := make([]byte, BINARY.BigEndian.Uint16(header[14:]))
+	if _, err := IO.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	switch header[12] & 0xF {
+	case v2_cmd_local:
+		return nil, nil
+	case v2_cmd_proxy:
+	default:
+		return nil, ERROR_BAD_HEADER
+	}
+	switch header[13] >> 4 {
+	case v2_family_inet:
+		if len(body) < 12 {
+			return nil, ERROR_BAD_HEADER
+		}
+		return &NET.TCPAddr{IP: NET.IP(body[0:4]), Port: int(BINARY.BigEndian.Uint16(body[8:]))}, nil
+	case v2_family_inet6:
+		if len(body) < 36 {
+			return nil, ERROR_BAD_HEADER
+		}
+		return &NET.TCPAddr{IP: NET.IP(body[0:16]), Port: int(BINARY.BigEndian.Uint16(body[32:]))}, nil
+	}
+	// AF_UNSPEC与AF_UNIX
+	return nil, nil
+}
+
+//---------------------------------------------
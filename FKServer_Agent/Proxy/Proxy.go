@@ -0,0 +1,134 @@
+//---------------------------------------------
+package proxy
+
+//---------------------------------------------
+/*
+	Agent部署在TCP负载均衡之后时，连接的远端地址是负载均衡器的地址
+	来自 --proxy-trusted 网段的连接必须以PROXY协议头(v1或v2)开始，会话记录协议头中的客户端真实地址
+	其他来源的连接不解析协议头，避免客户端伪造地址
+	只作用于TCP监听，KCP与WebSocket连接不受影响
+*/
+//---------------------------------------------
+import (
+	BUFIO "bufio"
+	NET "net"
+	STRINGS "strings"
+	SYNC "sync"
+	TIME "time"
+
+	LOG "github.com/Sirupsen/logrus"
+	CLI "gopkg.in/urfave/cli.v2"
+)
+
+//---------------------------------------------
+const (
+	DEFAULT_HEADER_TIMEOUT = 5 * TIME.Second // 等待协议头的超时
+)
+
+//---------------------------------------------
+var (
+	_default_trusted []*NET.IPNet
+	once             SYNC.Once
+)
+
+//---------------------------------------------
+// 携带客户端真实地址的连接，协议头之后的数据从缓冲中继续读取
+type Conn struct {
+	NET.Conn
+	reader *BUFIO.Reader
+	remote NET.Addr
+}
+
+//---------------------------------------------
+func (c *Conn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+//---------------------------------------------
+func (c *Conn) RemoteAddr() NET.Addr {
+	return c.remote
+}
+
+//---------------------------------------------
+func InitWithCliContext(c *CLI.Context) {
+	once.Do(func() {
+		if err := Init(c.StringSlice("proxy-trusted")); err != nil {
+			LOG.Fatal("PROXY协议可信网段格式错误:", err)
+		}
+		if len(_default_trusted) > 0 {
+			LOG.Println("PROXY协议可信网段:", c.StringSlice("proxy-trusted"))
+		}
+	})
+}
+
+//---------------------------------------------
+// 设置可信网段，CIDR或单个IP，为空则不解析PROXY协议
+func Init(specs []string) error {
+	trusted, err := ParseCIDRs(specs)
+	if err != nil {
+		return err
+	}
+	_default_trusted = trusted
+	return nil
+}
+
+//---------------------------------------------
+// 解析网段列表，单个IP视为只包含该IP的网段
+func ParseCIDRs(specs []string) ([]*NET.IPNet, error) {
+	var nets []*NET.IPNet
+	for _, spec := range specs {
+		for _, s := range STRINGS.Split(spec, ",") {
+			if s = STRINGS.TrimSpace(s); s == "" {
+				continue
+			}
+			if !STRINGS.Contains(s, "/") {
+				if ip := NET.ParseIP(s); ip != nil && ip.To4() != nil {
+					s += "/32"
+				} else {
+					s += "/128"
+				}
+			}
+			_, ipnet, err := NET.ParseCIDR(s)
+			if err != nil {
+				return nil, err
+			}
+			nets = append(nets, ipnet)
+		}
+	}
+	return nets, nil
+}
+
+//---------------------------------------------
+// 连接是否来自可信网段
+func Func_Trusted(ip NET.IP) bool {
+	for _, ipnet := range _default_trusted {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+//---------------------------------------------
+// 处理新建立的TCP连接
+// 来自可信网段的连接读取PROXY协议头，返回远端地址为客户端真实地址的连接；其他连接原样返回
+func Func_Accept(conn NET.Conn) (NET.Conn, error) {
+	addr, ok := conn.RemoteAddr().(*NET.TCPAddr)
+	if !ok || !Func_Trusted(addr.IP) {
+		return conn, nil
+	}
+
+	conn.SetReadDeadline(TIME.Now().Add(DEFAULT_HEADER_TIMEOUT))
+	reader := BUFIO.NewReader(conn)
+	remote, err := ReadHeader(reader)
+	conn.SetReadDeadline(TIME.Time{})
+	if err != nil {
+		return nil, err
+	}
+	if remote == nil { // 协议头不携带地址
+		return &Conn{Conn: conn, reader: reader, remote: addr}, nil
+	}
+	return &Conn{Conn: conn, reader: reader, remote: remote}, nil
+}
+
+//---------------------------------------------
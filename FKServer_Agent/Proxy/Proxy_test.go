@@ -0,0 +1,117 @@
+//---------------------------------------------
+package proxy
+
+//---------------------------------------------
+import (
+	BUFIO "bufio"
+	BYTES "bytes"
+	IO "io/ioutil"
+	NET "net"
+	"testing"
+)
+
+//---------------------------------------------
+func TestReadHeaderV1(t *testing.T) {
+	r := BUFIO.NewReader(BYTES.NewBufferString("PROXY TCP4 1.2.3.4 10.0.0.1 56324 443\r\nDATA"))
+	addr, err := ReadHeader(r)
+	if err != nil || !addr.IP.Equal(NET.ParseIP("1.2.3.4")) || addr.Port != 56324 {
+		t.Fatal("v1 got", addr, err)
+	}
+	if rest, _ := IO.ReadAll(r); string(rest) != "DATA" {
+		t.Error("payload after header got", rest)
+	}
+
+	r = BUFIO.NewReader(BYTES.NewBufferString("PROXY UNKNOWN\r\n"))
+	if addr, err := ReadHeader(r); err != nil || addr != nil {
+		t.Error("v1 unknown got", addr, err)
+	}
+
+	for _, s := range []string{
+		"PROXY TCP4 ::1 ::1 1 2\r\n",
+		"PROXY TCP4 1.2.3.4 10.0.0.1 99999 443\r\n",
+		"PROXY TCP4 1.2.3.4\r\n",
+		"PROXY " + string(BYTES.Repeat([]byte("1"), V1_MAX_LENGTH)),
+	} {
+		if _, err := ReadHeader(BUFIO.NewReader(BYTES.NewBufferString(s))); err != ERROR_BAD_HEADER {
+			t.Errorf("bad v1 header %q got %v", s, err)
+		}
+	}
+	if _, err := ReadHeader(BUFIO.NewReader(BYTES.NewBufferString("\x00\x10hello"))); err != ERROR_NO_HEADER {
+		t.Error("missing header got", err)
+	}
+}
+
+//---------------------------------------------
+func TestReadHeaderV2(t *testing.T) {
+	// PROXY TCP4 5.6.7.8:1234 -> 10.0.0.1:443，附带一个TLV
+	header := append([]byte{}, v2_signature...)
+	header = append(header, 0x21, 0x11, 0, 15)
+	header = append(header, 5, 6, 7, 8, 10, 0, 0, 1, 0x04, 0xD2, 0x01, 0xBB)
+	header = append(header, 0x04, 0, 0)
+	r := BUFIO.NewReader(BYTES.NewReader(append(header, 'X')))
+	addr, err := ReadHeader(r)
+	if err != nil || !addr.IP.Equal(NET.ParseIP("5.6.7.8")) || addr.Port != 1234 {
+		t.Fatal("v2 got", addr, err)
+	}
+	if b, _ := r.ReadByte(); b != 'X' {
+		t.Error("payload after header got", b)
+	}
+
+	// LOCAL命令
+	local := append(append([]byte{}, v2_signature...), 0x20, 0x00, 0, 0)
+	if addr, err := ReadHeader(BUFIO.NewReader(BYTES.NewReader(local))); err != nil || addr != nil {
+		t.Error("v2 local got", addr, err)
+	}
+
+	// 地址长度不足
+	short := append(append([]byte{}, v2_signature...), 0x21, 0x21, 0, 12)
+	short = append(short, make([]byte, 12)...)
+	if _, err := ReadHeader(BUFIO.NewReader(BYTES.NewReader(short))); err != ERROR_BAD_HEADER {
+		t.Error("short v2 got", err)
+	}
+}
+
+//---------------------------------------------
+func TestAccept(t *testing.T) {
+	if err := Init([]string{"127.0.0.1", "10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	defer Init(nil)
+	if !Func_Trusted(NET.ParseIP("10.1.2.3")) || Func_Trusted(NET.ParseIP("127.0.0.2")) {
+		t.Error("trusted mismatch")
+	}
+	if _, err := ParseCIDRs([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("bad cidr accepted")
+	}
+
+	l, err := NET.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		c, err := NET.Dial("tcp", l.Addr().String())
+		if err != nil {
+			return
+		}
+		c.Write([]byte("PROXY TCP6 2001:db8::1 2001:db8::2 4000 443\r\nDATA"))
+		c.Close()
+	}()
+
+	raw, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := Func_Accept(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr := conn.RemoteAddr().(*NET.TCPAddr); !addr.IP.Equal(NET.ParseIP("2001:db8::1")) || addr.Port != 4000 {
+		t.Error("remote addr got", addr)
+	}
+	if rest, _ := IO.ReadAll(conn); string(rest) != "DATA" {
+		t.Error("payload got", rest)
+	}
+}
+
+//---------------------------------------------
@@ -0,0 +1,139 @@
+//---------------------------------------------
+package route
+
+//---------------------------------------------
+/*
+	协议号路由表
+	将客户端协议号区间映射到etcd中发现的后端服务，每条规则的格式为:
+		begin-end:service   例如 1001-5000:game-10000
+		id:service          例如 7000:chat-10000
+	多条规则之间用逗号或换行分隔，区间不允许重叠
+	没有命中任何规则的协议号由Agent自己处理
+*/
+//---------------------------------------------
+import (
+	ERRORS "errors"
+	FMT "fmt"
+	SORT "sort"
+	STRCONV "strconv"
+	STRINGS "strings"
+)
+
+//---------------------------------------------
+var (
+	ERROR_BAD_RULE = ERRORS.New("bad route rule")
+)
+
+//---------------------------------------------
+// 一条路由规则，[Begin, End]闭区间
+type Rule struct {
+	Begin   int16
+	End     int16
+	Service string
+}
+
+type rule_slice []Rule
+
+func (s rule_slice) Len() int           { return len(s) }
+func (s rule_slice) Less(i, j int) bool { return s[i].Begin < s[j].Begin }
+func (s rule_slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+//---------------------------------------------
+// 路由表，创建后只读，可以在多个协程中同时使用
+type Table struct {
+	rules []Rule // 按Begin升序
+}
+
+//---------------------------------------------
+// 根据规则创建路由表，区间重叠时返回错误
+func NewTable(rules []Rule) (*Table, error) {
+	t := &Table{rules: make([]Rule, len(rules))}
+	copy(t.rules, rules)
+	SORT.Sort(rule_slice(t.rules))
+	for k, r := range t.rules {
+		if r.Begin > r.End || r.Service == "" {
+			return nil, FMT.Errorf("%v: %v-%v:%v", ERROR_BAD_RULE, r.Begin, r.End, r.Service)
+		}
+		if k > 0 && r.Begin <= t.rules[k-1].End {
+			return nil, FMT.Errorf("%v: %v-%v overlaps %v-%v", ERROR_BAD_RULE, r.Begin, r.End, t.rules[k-1].Begin, t.rules[k-1].End)
+		}
+	}
+	return t, nil
+}
+
+//---------------------------------------------
+// 解析路由规则文本
+func Parse(spec string) (*Table, error) {
+	var rules []Rule
+	fields := STRINGS.FieldsFunc(spec, func(c rune) bool { return c == ',' || c == '\n' || c == ';' })
+	for _, f := range fields {
+		f = STRINGS.TrimSpace(f)
+		if f == "" || STRINGS.HasPrefix(f, "#") {
+			continue
+		}
+		r, err := parse_rule(f)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return NewTable(rules)
+}
+
+//---------------------------------------------
+func parse_rule(s string) (r Rule, err error) {
+	idx := STRINGS.LastIndex(s, ":")
+	if idx < 0 {
+		return r, FMT.Errorf("%v: %v", ERROR_BAD_RULE, s)
+	}
+	r.Service = STRINGS.TrimSpace(s[idx+1:])
+
+	ids := STRINGS.SplitN(s[:idx], "-", 2)
+	begin, err := STRCONV.ParseInt(STRINGS.TrimSpace(ids[0]), 10, 16)
+	if err != nil {
+		return r, FMT.Errorf("%v: %v", ERROR_BAD_RULE, s)
+	}
+	end := begin
+	if len(ids) == 2 {
+		if end, err = STRCONV.ParseInt(STRINGS.TrimSpace(ids[1]), 10, 16); err != nil {
+			return r, FMT.Errorf("%v: %v", ERROR_BAD_RULE, s)
+		}
+	}
+	r.Begin, r.End = int16(begin), int16(end)
+	return r, nil
+}
+
+//---------------------------------------------
+// 查询协议号对应的服务，没有命中时返回空
+func (t *Table) Lookup(proto int16) string {
+	k := SORT.Search(len(t.rules), func(i int) bool { return t.rules[i].End >= proto })
+	if k < len(t.rules) && t.rules[k].Begin <= proto {
+		return t.rules[k].Service
+	}
+	return ""
+}
+
+//---------------------------------------------
+// 路由表中出现的全部服务
+func (t *Table) Services() []string {
+	var ret []string
+	seen := make(map[string]bool)
+	for _, r := range t.rules {
+		if !seen[r.Service] {
+			seen[r.Service] = true
+			ret = append(ret, r.Service)
+		}
+	}
+	return ret
+}
+
+//---------------------------------------------
+func (t *Table) String() string {
+	parts := make([]string, len(t.rules))
+	for k, r := range t.rules {
+		parts[k] = FMT.Sprintf("%v-%v:%v", r.Begin, r.End, r.Service)
+	}
+	return STRINGS.Join(parts, ",")
+}
+
+//---------------------------------------------
@@ -0,0 +1,63 @@
+//---------------------------------------------
+package route
+
+//---------------------------------------------
+import (
+	"testing"
+)
+
+//---------------------------------------------
+func TestLookup(t *testing.T) {
+	table, err := Parse("5001-6000:battle-10000, 1001-5000:game-10000\n7000:chat-10000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[int16]string{
+		0:     "",
+		1000:  "",
+		1001:  "game-10000",
+		5000:  "game-10000",
+		5001:  "battle-10000",
+		6000:  "battle-10000",
+		6001:  "",
+		7000:  "chat-10000",
+		32767: "",
+		-1:    "",
+	}
+	for proto, want := range cases {
+		if got := table.Lookup(proto); got != want {
+			t.Errorf("lookup %v: got %q want %q", proto, got, want)
+		}
+	}
+
+	if s := table.String(); s != "1001-5000:game-10000,5001-6000:battle-10000,7000-7000:chat-10000" {
+		t.Error("string:", s)
+	}
+	if len(table.Services()) != 3 {
+		t.Error("services:", table.Services())
+	}
+}
+
+//---------------------------------------------
+func TestParseError(t *testing.T) {
+	bad := []string{
+		"1001-5000:game,4000-6000:battle", // 重叠
+		"5000-1001:game",                  // 区间颠倒
+		"1001-5000",                       // 没有服务名
+		"1001-5000:",                      // 服务名为空
+		"x-5000:game",                     // 非数字
+		"1001-40000:game",                 // 超出int16
+	}
+	for _, s := range bad {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("%q should fail", s)
+		}
+	}
+
+	if table, err := Parse(""); err != nil || table.Lookup(1001) != "" {
+		t.Error("empty table:", err)
+	}
+}
+
+//---------------------------------------------
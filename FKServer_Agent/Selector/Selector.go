@@ -0,0 +1,207 @@
+//---------------------------------------------
+package selector
+
+//---------------------------------------------
+/*
+	游戏服选服策略
+	fixed:       固定选取某台，适合小服
+	roundrobin:  轮询
+	hash:        以UserId为键的一致性HASH，玩家固定落在同一台，增删节点时只有少量玩家迁移
+	leastonline: 选取本Agent上在线人数最少的一台
+*/
+//---------------------------------------------
+import (
+	BINARY "encoding/binary"
+	CRC32 "hash/crc32"
+	SORT "sort"
+	STRCONV "strconv"
+	SYNC "sync"
+	ATOMIC "sync/atomic"
+)
+
+//---------------------------------------------
+const (
+	DEFAULT_VIRTUAL_NODES = 160 // 一致性HASH中每台服务器的虚拟节点数
+)
+
+//---------------------------------------------
+// 选服策略
+type Selector interface {
+	Update(ids []string)        // 可用的游戏服列表发生变化
+	Select(userid int32) string // 为玩家选取一台游戏服，没有可用游戏服时返回空
+}
+
+//---------------------------------------------
+// 需要统计在线人数的选服策略
+type Tracker interface {
+	Acquire(id string) // 一个玩家进入该游戏服
+	Release(id string) // 一个玩家离开该游戏服
+}
+
+//---------------------------------------------
+// 根据名字创建选服策略
+func NewSelector(name string, fixed_id string) Selector {
+	switch name {
+	case "fixed":
+		return &FixedSelector{Id: fixed_id}
+	case "roundrobin":
+		return &RoundRobinSelector{}
+	case "hash":
+		return NewHashSelector(DEFAULT_VIRTUAL_NODES)
+	case "leastonline":
+		return NewLeastOnlineSelector()
+	}
+	return nil
+}
+
+//---------------------------------------------
+// 固定选取某台
+type FixedSelector struct {
+	Id string
+}
+
+func (s *FixedSelector) Update(ids []string) {}
+
+func (s *FixedSelector) Select(userid int32) string {
+	return s.Id
+}
+
+//---------------------------------------------
+// 轮询
+type RoundRobinSelector struct {
+	ids []string
+	idx uint32
+	mu  SYNC.RWMutex
+}
+
+func (s *RoundRobinSelector) Update(ids []string) {
+	s.mu.Lock()
+	s.ids = append([]string(nil), ids...)
+	SORT.Strings(s.ids)
+	s.mu.Unlock()
+}
+
+func (s *RoundRobinSelector) Select(userid int32) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.ids) == 0 {
+		return ""
+	}
+	idx := int(ATOMIC.AddUint32(&s.idx, 1)) % len(s.ids)
+	return s.ids[idx]
+}
+
+//---------------------------------------------
+// 一致性HASH
+type HashSelector struct {
+	replicas int
+	hashes   []uint32          // 已排序的虚拟节点HASH值
+	nodes    map[uint32]string // 虚拟节点HASH -> 游戏服ID
+	mu       SYNC.RWMutex
+}
+
+func NewHashSelector(replicas int) *HashSelector {
+	return &HashSelector{replicas: replicas, nodes: make(map[uint32]string)}
+}
+
+// 重建HASH环
+func (s *HashSelector) Update(ids []string) {
+	hashes := make([]uint32, 0, len(ids)*s.replicas)
+	nodes := make(map[uint32]string, len(ids)*s.replicas)
+	for _, id := range ids {
+		for i := 0; i < s.replicas; i++ {
+			h := CRC32.ChecksumIEEE([]byte(id + "#" + STRCONV.Itoa(i)))
+			// HASH冲突时保留字典序较小的ID，保证环的构建结果与ids顺序无关
+			if old, ok := nodes[h]; ok {
+				if old < id {
+					continue
+				}
+			} else {
+				hashes = append(hashes, h)
+			}
+			nodes[h] = id
+		}
+	}
+	SORT.Sort(uint32_slice(hashes))
+
+	s.mu.Lock()
+	s.hashes = hashes
+	s.nodes = nodes
+	s.mu.Unlock()
+}
+
+func (s *HashSelector) Select(userid int32) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.hashes) == 0 {
+		return ""
+	}
+
+	var key [4]byte
+	BINARY.BigEndian.PutUint32(key[:], uint32(userid))
+	h := CRC32.ChecksumIEEE(key[:])
+	idx := SORT.Search(len(s.hashes), func(i int) bool { return s.hashes[i] >= h })
+	if idx == len(s.hashes) {
+		idx = 0
+	}
+	return s.nodes[s.hashes[idx]]
+}
+
+//---------------------------------------------
+// 在线人数最少
+// 注意：在线人数只统计经由本Agent登陆的玩家
+type LeastOnlineSelector struct {
+	online map[string]int
+	mu     SYNC.Mutex
+}
+
+func NewLeastOnlineSelector() *LeastOnlineSelector {
+	return &LeastOnlineSelector{online: make(map[string]int)}
+}
+
+func (s *LeastOnlineSelector) Update(ids []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	online := make(map[string]int, len(ids))
+	for _, id := range ids {
+		online[id] = s.online[id]
+	}
+	s.online = online
+}
+
+func (s *LeastOnlineSelector) Select(userid int32) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	selected, min := "", 0
+	for id, n := range s.online {
+		if selected == "" || n < min || (n == min && id < selected) {
+			selected, min = id, n
+		}
+	}
+	return selected
+}
+
+func (s *LeastOnlineSelector) Acquire(id string) {
+	s.mu.Lock()
+	if _, ok := s.online[id]; ok {
+		s.online[id]++
+	}
+	s.mu.Unlock()
+}
+
+func (s *LeastOnlineSelector) Release(id string) {
+	s.mu.Lock()
+	if n, ok := s.online[id]; ok && n > 0 {
+		s.online[id]--
+	}
+	s.mu.Unlock()
+}
+
+//---------------------------------------------
+type uint32_slice []uint32
+
+func (p uint32_slice) Len() int           { return len(p) }
+func (p uint32_slice) Less(i, j int) bool { return p[i] < p[j] }
+func (p uint32_slice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+//---------------------------------------------
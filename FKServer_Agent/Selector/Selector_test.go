@@ -0,0 +1,109 @@
+//---------------------------------------------
+package selector
+
+//---------------------------------------------
+import (
+	"testing"
+)
+
+//---------------------------------------------
+func TestHashSticky(t *testing.T) {
+	s := NewHashSelector(DEFAULT_VIRTUAL_NODES)
+	s.Update([]string{"game1", "game2", "game3"})
+
+	// 列表顺序不影响结果
+	s2 := NewHashSelector(DEFAULT_VIRTUAL_NODES)
+	s2.Update([]string{"game3", "game1", "game2"})
+
+	for uid := int32(1); uid < 1000; uid++ {
+		if s.Select(uid) != s.Select(uid) {
+			t.Fatal("hash selector not sticky:", uid)
+		}
+		if s.Select(uid) != s2.Select(uid) {
+			t.Fatal("hash selector depends on id order:", uid)
+		}
+	}
+}
+
+//---------------------------------------------
+func TestHashMinimalMove(t *testing.T) {
+	const N = 10000
+	s := NewHashSelector(DEFAULT_VIRTUAL_NODES)
+	s.Update([]string{"game1", "game2", "game3"})
+	before := make(map[int32]string)
+	count := make(map[string]int)
+	for uid := int32(1); uid <= N; uid++ {
+		before[uid] = s.Select(uid)
+		count[before[uid]]++
+	}
+	for id, n := range count {
+		if n < N/6 {
+			t.Errorf("unbalanced ring, %v got %v of %v", id, n, N)
+		}
+	}
+
+	// 增加一个节点，只有落到新节点的玩家发生迁移
+	s.Update([]string{"game1", "game2", "game3", "game4"})
+	moved := 0
+	for uid := int32(1); uid <= N; uid++ {
+		now := s.Select(uid)
+		if now != before[uid] {
+			if now != "game4" {
+				t.Fatalf("user %v moved from %v to %v", uid, before[uid], now)
+			}
+			moved++
+		}
+	}
+	if moved > N/2 {
+		t.Errorf("too many users moved: %v", moved)
+	}
+
+	// 移除一个节点，只有原本在该节点的玩家发生迁移
+	s.Update([]string{"game1", "game3"})
+	for uid := int32(1); uid <= N; uid++ {
+		if before[uid] != "game2" && s.Select(uid) != before[uid] {
+			t.Fatalf("user %v moved from %v to %v", uid, before[uid], s.Select(uid))
+		}
+	}
+}
+
+//---------------------------------------------
+func TestRoundRobin(t *testing.T) {
+	s := &RoundRobinSelector{}
+	if s.Select(1) != "" {
+		t.Error("empty selector should return nothing")
+	}
+	s.Update([]string{"game1", "game2"})
+	count := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		count[s.Select(1)]++
+	}
+	if count["game1"] != 5 || count["game2"] != 5 {
+		t.Error("round robin unbalanced:", count)
+	}
+}
+
+//---------------------------------------------
+func TestLeastOnline(t *testing.T) {
+	s := NewLeastOnlineSelector()
+	s.Update([]string{"game1", "game2"})
+	for i := 0; i < 10; i++ {
+		s.Acquire(s.Select(1))
+	}
+	if s.online["game1"] != 5 || s.online["game2"] != 5 {
+		t.Error("least online unbalanced:", s.online)
+	}
+	s.Release("game2")
+	if s.Select(1) != "game2" {
+		t.Error("should select game2")
+	}
+
+	// 节点移除后重新加入，计数清零
+	s.Update([]string{"game1"})
+	s.Update([]string{"game1", "game2"})
+	if s.online["game2"] != 0 {
+		t.Error("removed node should reset count")
+	}
+}
+
+//---------------------------------------------
@@ -0,0 +1,220 @@
+//---------------------------------------------
+package Session
+
+//---------------------------------------------
+import (
+	NET "net"
+	SYNC "sync"
+	TIME "time"
+
+	UDP "FKGoServer/FKServer_Agent/Udp"
+)
+
+//---------------------------------------------
+// 运维指令类型
+const (
+	CMD_INFO    = iota // 查询会话信息
+	CMD_KICK           // 踢掉会话
+	CMD_NOTICE         // 下发服务器公告
+	CMD_MIGRATE        // 下发服务器迁移通知，Agent排空时使用
+)
+
+const (
+	DEFAULT_ADMIN_QUEUE = 8 // 每个会话的运维指令队列长度
+)
+
+//---------------------------------------------
+// 会话信息快照，由会话协程填写
+type Info struct {
+	UserId       int32      `json:"userid"`
+	IP           string     `json:"ip"`
+	GSID         string     `json:"gsid"`
+	State        string     `json:"state"`
+	ConnectTime  TIME.Time  `json:"connect_time"`
+	PacketCount  uint32     `json:"packet_count"`  // 收到的客户端数据包个数
+	OutCount     uint32     `json:"out_count"`     // 登陆后下发的数据包个数
+	Detached     bool       `json:"detached"`      // 连接已断开，等待客户端恢复
+	QueuePackets int        `json:"queue_packets"` // 发送队列中的数据包个数
+	QueueBytes   int        `json:"queue_bytes"`   // 发送队列中的字节数
+	KCP          *UDP.Stats `json:"kcp,omitempty"` // KCP连接的调优参数与收发统计
+	RTT          float64    `json:"rtt_ms"`        // 平滑后的往返时延(毫秒)，0表示还没有采样
+	Jitter       float64    `json:"jitter_ms"`     // 往返时延的抖动(毫秒)
+	Version      int32      `json:"version"`       // 协商后的客户端协议版本
+}
+
+//---------------------------------------------
+// 会话筛选条件，零值匹配全部会话
+type Filter struct {
+	UserIds []int32    // 玩家ID，为空则不限制
+	GSID    string     // 游戏服ID，为空则不限制
+	IPNet   *NET.IPNet // 客户端IP段，为空则不限制
+}
+
+//---------------------------------------------
+// 运维指令
+// 指令投递到会话的Admin队列，由会话协程按Filter自行判断是否执行，避免在协程外读取会话状态
+// 执行后(或不匹配时)向Reply写入一次结果
+type Command struct {
+	Type   int
+	Filter Filter
+	Code   int32        // 踢人原因的错误码，0表示运维踢人
+	Text   string       // 踢人原因或公告内容
+	Reply  chan<- *Info // 匹配时回复会话信息，不匹配时回复nil
+
+	Addr     string    // 迁移通知: 建议重连的地址
+	Deadline TIME.Time // 迁移通知: 强制断开的时间
+}
+
+//---------------------------------------------
+// 判断会话是否满足筛选条件，必须在会话协程中调用
+func (f *Filter) Match(sess *Session) bool {
+	if len(f.UserIds) > 0 {
+		found := false
+		for _, id := range f.UserIds {
+			if id == sess.UserId {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.GSID != "" && f.GSID != sess.GSID {
+		return false
+	}
+	if f.IPNet != nil && !f.IPNet.Contains(sess.IP) {
+		return false
+	}
+	return true
+}
+
+//---------------------------------------------
+// 生成会话信息快照，必须在会话协程中调用
+func (sess *Session) Snapshot(detached bool) *Info {
+	info := &Info{
+		UserId:      sess.UserId,
+		IP:          sess.IP.String(),
+		GSID:        sess.GSID,
+		State:       sess.State.String(),
+		ConnectTime: sess.ConnectTime,
+		PacketCount: sess.PacketCount,
+		Detached:    detached,
+		RTT:         sess.RTT.Seconds() * 1000,
+		Jitter:      sess.Jitter.Seconds() * 1000,
+		Version:     sess.Version,
+	}
+	if sess.Outbox != nil {
+		info.OutCount = sess.Outbox.Count()
+	}
+	if sess.KCP != nil {
+		info.KCP = sess.KCP.Stats()
+	}
+	return info
+}
+
+//---------------------------------------------
+// 在线会话表，包括已断开等待恢复的会话
+type Online struct {
+	sessions map[*Session]struct{}
+	SYNC.Mutex
+}
+
+//---------------------------------------------
+var (
+	_default_online = Online{sessions: make(map[*Session]struct{})}
+)
+
+//---------------------------------------------
+// 创建在线会话表，全进程的在线表见Func_AddOnline，每个Agent另外记录自己的会话
+func NewOnline() *Online {
+	return &Online{sessions: make(map[*Session]struct{})}
+}
+
+//---------------------------------------------
+// 加入在线表
+func (o *Online) Add(sess *Session) {
+	o.Lock()
+	o.sessions[sess] = struct{}{}
+	o.Unlock()
+}
+
+//---------------------------------------------
+// 移出在线表
+func (o *Online) Remove(sess *Session) {
+	o.Lock()
+	delete(o.sessions, sess)
+	o.Unlock()
+}
+
+//---------------------------------------------
+// 在线会话个数
+func (o *Online) Count() (count int) {
+	o.Lock()
+	count = len(o.sessions)
+	o.Unlock()
+	return
+}
+
+//---------------------------------------------
+// 向全部在线会话投递指令，在timeout内收集回复
+// 返回匹配的会话信息，以及未能及时回复的会话个数
+func (o *Online) Dispatch(cmd Command, timeout TIME.Duration) (infos []*Info, missed int) {
+	o.Lock()
+	all := make([]*Session, 0, len(o.sessions))
+	for sess := range o.sessions {
+		all = append(all, sess)
+	}
+	o.Unlock()
+
+	reply := make(chan *Info, len(all))
+	cmd.Reply = reply
+	deadline := TIME.After(timeout)
+
+	sent := 0
+	for _, sess := range all {
+		select {
+		case sess.Admin <- cmd:
+			sent++
+		case <-sess.Die: // 会话已经结束
+		case <-deadline:
+			missed += len(all) - sent
+			return
+		}
+	}
+
+	for i := 0; i < sent; i++ {
+		select {
+		case info := <-reply:
+			if info != nil {
+				infos = append(infos, info)
+			}
+		case <-deadline:
+			missed += sent - i
+			return
+		}
+	}
+	return
+}
+
+//---------------------------------------------
+func Func_AddOnline(sess *Session) {
+	_default_online.Add(sess)
+}
+
+//---------------------------------------------
+func Func_RemoveOnline(sess *Session) {
+	_default_online.Remove(sess)
+}
+
+//---------------------------------------------
+func Func_OnlineCount() int {
+	return _default_online.Count()
+}
+
+//---------------------------------------------
+func Func_Dispatch(cmd Command, timeout TIME.Duration) ([]*Info, int) {
+	return _default_online.Dispatch(cmd, timeout)
+}
+
+//---------------------------------------------
@@ -0,0 +1,71 @@
+//---------------------------------------------
+package Session
+
+//---------------------------------------------
+const (
+	DEFAULT_OUTBOX_SIZE = 256 // 默认重传缓冲可保存的数据包个数
+)
+
+//---------------------------------------------
+// 重传缓冲
+// 记录最近发给客户端的明文数据包，客户端断线重连恢复会话时，重发客户端尚未收到的部分
+// 数据包从1开始编号，第一个被记录的包即登陆成功回复
+type Outbox struct {
+	packets [][]byte // 环形缓冲
+	count   uint32   // 已记录的数据包总数
+}
+
+//---------------------------------------------
+func NewOutbox(size int) *Outbox {
+	return &Outbox{packets: make([][]byte, size)}
+}
+
+//---------------------------------------------
+// 记录一个数据包，保存的是副本
+func (o *Outbox) Push(data []byte) {
+	p := make([]byte, len(data))
+	copy(p, data)
+	o.packets[o.count%uint32(len(o.packets))] = p
+	o.count++
+}
+
+//---------------------------------------------
+// 覆盖编号为seq的数据包，该包已经不在缓冲中时返回false
+func (o *Outbox) Replace(seq uint32, data []byte) bool {
+	if seq == 0 || seq > o.count || o.count-seq >= uint32(len(o.packets)) {
+		return false
+	}
+	p := make([]byte, len(data))
+	copy(p, data)
+	o.packets[(seq-1)%uint32(len(o.packets))] = p
+	return true
+}
+
+//---------------------------------------------
+// 已记录的数据包总数
+func (o *Outbox) Count() uint32 {
+	return o.count
+}
+
+//---------------------------------------------
+// 获取编号大于received的全部数据包副本，按发送顺序排列
+// 对端声称收到的包比已发送的还多，或者缺失的包已被覆盖时返回false
+func (o *Outbox) Since(received uint32) ([][]byte, bool) {
+	if received > o.count {
+		return nil, false
+	}
+	if o.count-received > uint32(len(o.packets)) {
+		return nil, false
+	}
+
+	ret := make([][]byte, 0, o.count-received)
+	for i := received; i < o.count; i++ {
+		p := o.packets[i%uint32(len(o.packets))]
+		c := make([]byte, len(p))
+		copy(c, p)
+		ret = append(ret, c)
+	}
+	return ret, true
+}
+
+//---------------------------------------------
@@ -0,0 +1,66 @@
+//---------------------------------------------
+package Session
+
+//---------------------------------------------
+import (
+	"testing"
+)
+
+//---------------------------------------------
+func TestOutbox(t *testing.T) {
+	o := NewOutbox(4)
+	for i := byte(1); i <= 6; i++ {
+		o.Push([]byte{i})
+	}
+	if o.Count() != 6 {
+		t.Fatal("count:", o.Count())
+	}
+
+	// 客户端收到了4个，补发5、6
+	ps, ok := o.Since(4)
+	if !ok || len(ps) != 2 || ps[0][0] != 5 || ps[1][0] != 6 {
+		t.Error("replay since 4:", ps, ok)
+	}
+	// 缓冲中最早的是3
+	if ps, ok := o.Since(2); !ok || len(ps) != 4 || ps[0][0] != 3 {
+		t.Error("replay since 2:", ps, ok)
+	}
+	// 1、2已被覆盖
+	if _, ok := o.Since(1); ok {
+		t.Error("overwritten packets should not be replayed")
+	}
+	// 客户端声称收到的比已发送的多
+	if _, ok := o.Since(7); ok {
+		t.Error("received more than sent")
+	}
+	// 全部收到
+	if ps, ok := o.Since(6); !ok || len(ps) != 0 {
+		t.Error("nothing to replay:", ps, ok)
+	}
+
+	// 补发的是副本，加密时不会破坏缓冲
+	ps[0][0] = 0xff
+	if again, _ := o.Since(5); again[0][0] != 6 {
+		t.Error("outbox modified by caller")
+	}
+}
+
+//---------------------------------------------
+func TestRegistryTake(t *testing.T) {
+	var r Registry
+	r.init()
+	a, b := &Session{}, &Session{}
+	r.Register("t", a)
+	r.Unregister("t", b) // 不是同一个会话，不应移除
+	if r.Take("t") != a {
+		t.Fatal("take failed")
+	}
+	if r.Take("t") != nil {
+		t.Error("token should be consumed by take")
+	}
+	if len(Func_NewResumeToken()) != 32 {
+		t.Error("bad token length")
+	}
+}
+
+//---------------------------------------------
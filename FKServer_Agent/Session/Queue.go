@@ -0,0 +1,229 @@
+//---------------------------------------------
+package Session
+
+//---------------------------------------------
+/*
+	每条连接的有界发送队列
+	会话协程只负责入队，发送协程批量出队后加密、写入网络，客户端接收缓慢时不会阻塞会话协程
+	队列超过包个数或字节数上限时，按策略处理:
+	kick:     踢掉客户端
+	drop:     丢弃可丢弃的协议(见 --out-droppable)，其他协议踢掉客户端
+	coalesce: 可丢弃的协议覆盖队列中尚未发送的同协议号数据包(只保留最新状态)，没有可覆盖的包时丢弃
+	被丢弃的包不记录到重传缓冲，被覆盖的包在重传缓冲中同样被覆盖，断线恢复时数据包计数保持一致
+*/
+//---------------------------------------------
+import (
+	ERRORS "errors"
+	EXPVAR "expvar"
+	STRCONV "strconv"
+	STRINGS "strings"
+	SYNC "sync"
+
+	CIPHER "FKGoServer/FKLib_Common/Cipher"
+	COMPRESS "FKGoServer/FKLib_Common/Compress"
+)
+
+//---------------------------------------------
+// 队列满时的处理策略
+type Policy int
+
+const (
+	POLICY_KICK Policy = iota
+	POLICY_DROP
+	POLICY_COALESCE
+)
+
+// 入队结果
+const (
+	QUEUE_OK        = iota // 已入队
+	QUEUE_COALESCED        // 覆盖了队列中的同协议号数据包
+	QUEUE_DROPPED          // 已丢弃
+	QUEUE_FULL             // 队列已满，需要踢掉客户端
+)
+
+const (
+	DEFAULT_QUEUE_PACKETS = 512     // 默认队列最多容纳的数据包个数
+	DEFAULT_QUEUE_BYTES   = 1 << 20 // 默认队列最多容纳的字节数
+)
+
+//---------------------------------------------
+var (
+	ERROR_BAD_POLICY = ERRORS.New("bad slow client policy")
+	ERROR_BAD_RANGE  = ERRORS.New("bad proto range")
+
+	policy_names = map[string]Policy{
+		"kick":     POLICY_KICK,
+		"drop":     POLICY_DROP,
+		"coalesce": POLICY_COALESCE,
+	}
+
+	// 全部连接发送队列中的数据包个数与字节数，通过expvar导出
+	_queued_packets = EXPVAR.NewInt("outqueue_packets")
+	_queued_bytes   = EXPVAR.NewInt("outqueue_bytes")
+)
+
+//---------------------------------------------
+// 发送队列中的一个数据包
+type Packet struct {
+	Data       []byte          // 明文
+	Proto      int16           // 协议号
+	Seq        uint32          // 在重传缓冲中的编号，0表示未记录
+	Encoder    CIPHER.Codec    // 加密器，nil表示明文发送
+	Compressor *COMPRESS.Codec // 压缩器，nil表示不压缩
+	Final      bool            // 连接关闭前的最后一个数据包，关闭时仍然发出
+}
+
+//---------------------------------------------
+// 发送队列配置
+type QueueConfig struct {
+	MaxPackets int
+	MaxBytes   int
+	Policy     Policy
+	Droppable  [][2]int16 // 可丢弃的协议号区间[begin, end]
+}
+
+//---------------------------------------------
+// 解析队列满时的处理策略
+func ParsePolicy(s string) (Policy, error) {
+	p, ok := policy_names[STRINGS.ToLower(STRINGS.TrimSpace(s))]
+	if !ok {
+		return POLICY_KICK, ERROR_BAD_POLICY
+	}
+	return p, nil
+}
+
+//---------------------------------------------
+// 解析协议号区间，格式 begin-end 或 id
+func ParseRanges(specs []string) ([][2]int16, error) {
+	var ranges [][2]int16
+	for _, spec := range specs {
+		for _, s := range STRINGS.Split(spec, ",") {
+			if s = STRINGS.TrimSpace(s); s == "" {
+				continue
+			}
+			parts := STRINGS.SplitN(s, "-", 2)
+			begin, err := STRCONV.ParseInt(STRINGS.TrimSpace(parts[0]), 10, 16)
+			if err != nil {
+				return nil, ERROR_BAD_RANGE
+			}
+			end := begin
+			if len(parts) == 2 {
+				if end, err = STRCONV.ParseInt(STRINGS.TrimSpace(parts[1]), 10, 16); err != nil || end < begin {
+					return nil, ERROR_BAD_RANGE
+				}
+			}
+			ranges = append(ranges, [2]int16{int16(begin), int16(end)})
+		}
+	}
+	return ranges, nil
+}
+
+//---------------------------------------------
+// 该协议是否可以丢弃
+func (c *QueueConfig) IsDroppable(proto int16) bool {
+	for _, r := range c.Droppable {
+		if proto >= r[0] && proto <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+//---------------------------------------------
+// 有界发送队列，会话协程入队，发送协程出队
+type Queue struct {
+	config  *QueueConfig
+	packets []*Packet
+	bytes   int
+	notify  chan struct{} // 有新数据包时通知发送协程
+	SYNC.Mutex
+}
+
+//---------------------------------------------
+func NewQueue(config *QueueConfig) *Queue {
+	return &Queue{config: config, notify: make(chan struct{}, 1)}
+}
+
+//---------------------------------------------
+// 按配置的上限与策略入队
+// 返回QUEUE_COALESCED时同时返回被覆盖的数据包(已替换为p的内容)
+func (q *Queue) Offer(p *Packet) (int, *Packet) {
+	q.Lock()
+	defer q.Unlock()
+	// 队列为空时总是入队，扩展帧传输的大消息可以超过字节数上限
+	if len(q.packets) == 0 || len(q.packets) < q.config.MaxPackets && q.bytes+len(p.Data) <= q.config.MaxBytes {
+		q.push(p)
+		return QUEUE_OK, nil
+	}
+
+	if q.config.Policy == POLICY_KICK || !q.config.IsDroppable(p.Proto) {
+		return QUEUE_FULL, nil
+	}
+	if q.config.Policy == POLICY_COALESCE {
+		for i := len(q.packets) - 1; i >= 0; i-- {
+			old := q.packets[i]
+			if old.Proto == p.Proto {
+				q.add(len(p.Data) - len(old.Data))
+				old.Data = p.Data
+				return QUEUE_COALESCED, old
+			}
+		}
+	}
+	return QUEUE_DROPPED, nil
+}
+
+//---------------------------------------------
+// 不检查上限直接入队，用于断线恢复时的补发
+func (q *Queue) Push(p *Packet) {
+	q.Lock()
+	q.push(p)
+	q.Unlock()
+}
+
+//---------------------------------------------
+// 必须持有锁
+func (q *Queue) push(p *Packet) {
+	q.packets = append(q.packets, p)
+	q.add(len(p.Data))
+	_queued_packets.Add(1)
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+//---------------------------------------------
+// 必须持有锁
+func (q *Queue) add(n int) {
+	q.bytes += n
+	_queued_bytes.Add(int64(n))
+}
+
+//---------------------------------------------
+// 取出全部数据包
+func (q *Queue) Pop() []*Packet {
+	q.Lock()
+	packets := q.packets
+	q.packets = nil
+	_queued_packets.Add(-int64(len(packets)))
+	q.add(-q.bytes)
+	q.Unlock()
+	return packets
+}
+
+//---------------------------------------------
+// 有新数据包时可读
+func (q *Queue) Wait() <-chan struct{} {
+	return q.notify
+}
+
+//---------------------------------------------
+// 当前队列中的数据包个数与字节数
+func (q *Queue) Len() (packets, bytes int) {
+	q.Lock()
+	packets, bytes = len(q.packets), q.bytes
+	q.Unlock()
+	return
+}
+
+//---------------------------------------------
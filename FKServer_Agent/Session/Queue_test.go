@@ -0,0 +1,83 @@
+//---------------------------------------------
+package Session
+
+//---------------------------------------------
+import (
+	"testing"
+)
+
+//---------------------------------------------
+func TestQueuePolicy(t *testing.T) {
+	droppable, err := ParseRanges([]string{"2000-2999", "3001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := QueueConfig{MaxPackets: 2, MaxBytes: 100, Policy: POLICY_KICK, Droppable: droppable}
+	q := NewQueue(&config)
+
+	q.Offer(&Packet{Data: []byte{1}, Proto: 2001})
+	q.Offer(&Packet{Data: []byte{2}, Proto: 10})
+	if r, _ := q.Offer(&Packet{Data: []byte{3}, Proto: 2001}); r != QUEUE_FULL {
+		t.Error("kick policy got", r)
+	}
+
+	config.Policy = POLICY_DROP
+	if r, _ := q.Offer(&Packet{Data: []byte{3}, Proto: 2001}); r != QUEUE_DROPPED {
+		t.Error("drop policy got", r)
+	}
+	if r, _ := q.Offer(&Packet{Data: []byte{3}, Proto: 10}); r != QUEUE_FULL {
+		t.Error("critical packet should not be dropped:", r)
+	}
+
+	config.Policy = POLICY_COALESCE
+	r, old := q.Offer(&Packet{Data: []byte{4, 4}, Proto: 2001})
+	if r != QUEUE_COALESCED || old.Data[0] != 4 {
+		t.Error("coalesce got", r, old)
+	}
+	if r, _ := q.Offer(&Packet{Data: []byte{5}, Proto: 3001}); r != QUEUE_DROPPED {
+		t.Error("coalesce without match got", r)
+	}
+	if n, bytes := q.Len(); n != 2 || bytes != 3 {
+		t.Error("len got", n, bytes)
+	}
+
+	// 字节数上限，队列为空时大消息仍然可以入队
+	q.Pop()
+	if r, _ := q.Offer(&Packet{Data: make([]byte, 101), Proto: 10}); r != QUEUE_OK {
+		t.Error("large message into empty queue got", r)
+	}
+	if r, _ := q.Offer(&Packet{Data: []byte{1}, Proto: 10}); r != QUEUE_FULL {
+		t.Error("bytes limit got", r)
+	}
+	select {
+	case <-q.Wait():
+	default:
+		t.Error("queue should notify sender")
+	}
+
+	if _, err := ParseRanges([]string{"5-1"}); err != ERROR_BAD_RANGE {
+		t.Error("bad range got", err)
+	}
+	if _, err := ParsePolicy("wait"); err != ERROR_BAD_POLICY {
+		t.Error("bad policy got", err)
+	}
+}
+
+//---------------------------------------------
+func TestOutboxReplace(t *testing.T) {
+	o := NewOutbox(2)
+	for i := byte(1); i <= 3; i++ {
+		o.Push([]byte{i})
+	}
+	if !o.Replace(3, []byte{30}) {
+		t.Error("replace latest failed")
+	}
+	if o.Replace(1, []byte{10}) {
+		t.Error("overwritten packet should not be replaced")
+	}
+	if ps, _ := o.Since(1); ps[0][0] != 2 || ps[1][0] != 30 {
+		t.Error("replay got", ps)
+	}
+}
+
+//---------------------------------------------
@@ -0,0 +1,96 @@
+//---------------------------------------------
+package Session
+
+//---------------------------------------------
+import (
+	RAND "crypto/rand"
+	HEX "encoding/hex"
+	SYNC "sync"
+)
+
+//---------------------------------------------
+// 可恢复会话注册表
+// 登陆成功的会话以恢复凭证注册，客户端重连后凭此找回原会话
+type Registry struct {
+	records map[string]*Session // token -> session
+	SYNC.Mutex
+}
+
+//---------------------------------------------
+var (
+	_default_registry Registry
+)
+
+//---------------------------------------------
+func init() {
+	_default_registry.init()
+}
+
+//---------------------------------------------
+func (r *Registry) init() {
+	r.records = make(map[string]*Session)
+}
+
+//---------------------------------------------
+// 注册会话
+func (r *Registry) Register(token string, sess *Session) {
+	r.Lock()
+	r.records[token] = sess
+	r.Unlock()
+}
+
+//---------------------------------------------
+// 移除会话，仅当token仍然指向该会话时才移除
+func (r *Registry) Unregister(token string, sess *Session) {
+	r.Lock()
+	if r.records[token] == sess {
+		delete(r.records, token)
+	}
+	r.Unlock()
+}
+
+//---------------------------------------------
+// 取出会话，取出后该token不再有效，避免同一会话被两条连接同时恢复
+func (r *Registry) Take(token string) (sess *Session) {
+	r.Lock()
+	sess = r.records[token]
+	delete(r.records, token)
+	r.Unlock()
+	return
+}
+
+//---------------------------------------------
+// 当前可恢复会话个数
+func (r *Registry) Count() (count int) {
+	r.Lock()
+	count = len(r.records)
+	r.Unlock()
+	return
+}
+
+//---------------------------------------------
+func Func_RegisterResumable(token string, sess *Session) {
+	_default_registry.Register(token, sess)
+}
+
+//---------------------------------------------
+func Func_UnregisterResumable(token string, sess *Session) {
+	_default_registry.Unregister(token, sess)
+}
+
+//---------------------------------------------
+func Func_TakeResumable(token string) *Session {
+	return _default_registry.Take(token)
+}
+
+//---------------------------------------------
+// 生成恢复凭证
+func Func_NewResumeToken() string {
+	b := make([]byte, 16)
+	if _, err := RAND.Read(b); err != nil {
+		panic(err)
+	}
+	return HEX.EncodeToString(b)
+}
+
+//---------------------------------------------
@@ -3,8 +3,14 @@ package Session
 
 //---------------------------------------------
 import (
+	CIPHER "FKGoServer/FKLib_Common/Cipher"
+	COMPRESS "FKGoServer/FKLib_Common/Compress"
+	CAPTURE "FKGoServer/FKServer_Agent/Capture"
+	DATAGRAM "FKGoServer/FKServer_Agent/Datagram"
+	LIMITER "FKGoServer/FKServer_Agent/Limiter"
 	PROTO "FKGoServer/FKServer_Agent/Proto"
-	RC4 "crypto/rc4"
+	UDP "FKGoServer/FKServer_Agent/Udp"
+	VERSION "FKGoServer/FKServer_Agent/Version"
 	NET "net"
 	TIME "time"
 )
@@ -14,24 +20,113 @@ const (
 	SESS_KEYEXCG    = 0x1 // 是否已经交换完毕KEY
 	SESS_ENCRYPT    = 0x2 // 是否可以开始加密
 	SESS_KICKED_OUT = 0x4 // 踢掉
+	SESS_RESUME     = 0x8 // 新连接请求恢复原会话
 )
 
+//---------------------------------------------
+// 到游戏服的流，Stream为nil表示没有可用的游戏服
+type GameStream struct {
+	GSID   string
+	Stream PROTO.GameService_StreamClient
+}
+
+//---------------------------------------------
+// 后端服务发给会话的帧，Stream为来源流，控制流分发的广播、组播为nil
+// 会话协程据此只接受当前游戏服流发来的踢人与切换游戏服
+type Frame struct {
+	PROTO.Game_Frame
+	Stream PROTO.GameService_StreamClient
+}
+
+//---------------------------------------------
+// 会话所属Agent的后端服务，由FKServer_Agent/Backend实现，消息处理函数在登陆时经此选服
+type Backend interface {
+	SelectGame(userid int32) string
+	OpenGameStream(sess *Session, gsid string) (PROTO.GameService_StreamClient, error)
+	ReleaseGame(gsid string)
+}
+
 //---------------------------------------------
 type Session struct {
-	IP      NET.IP                         // 客户端IP
-	MQ      chan PROTO.Game_Frame          // 返回给客户端的异步消息
-	Encoder *RC4.Cipher                    // 加密器
-	Decoder *RC4.Cipher                    // 解密器
-	UserId  int32                          // 玩家ID
-	GSID    string                         // 游戏服ID;e.g.: game1,game2
-	Stream  PROTO.GameService_StreamClient // 后端游戏服数据流
-	Die     chan struct{}                  // 会话关闭信号
+	IP         NET.IP                         // 客户端IP
+	MQ         chan Frame                     // 返回给客户端的异步消息
+	Encoder    CIPHER.Codec                   // 加密器
+	Decoder    CIPHER.Codec                   // 解密器
+	Compressor *COMPRESS.Codec                // 压缩器，握手时未协商出压缩算法则为nil
+	KCP        *UDP.Conn                      // KCP连接，TCP与WebSocket连接为nil
+	UserId     int32                          // 玩家ID
+	GSID       string                         // 游戏服ID;e.g.: game1,game2
+	Stream     PROTO.GameService_StreamClient // 后端游戏服数据流
+	Die        chan struct{}                  // 会话关闭信号
+	Backend    Backend                        // 所属Agent的后端服务
+
+	Streams      map[string]PROTO.GameService_StreamClient // 游戏服以外的后端服务数据流，按服务名索引
+	GameLost     chan PROTO.GameService_StreamClient       // 后端服务流异常中断通知
+	GameRestored chan GameStream                           // 游戏服故障转移的重连结果，由重连协程发送
+
+	Owner       string             // 在线表中的登记，见FKServer_Agent/Presence
+	ResumeToken string             // 恢复会话凭证，登陆成功后下发
+	ResumeCount uint32             // 恢复会话时客户端已收到的数据包个数
+	Outbox      *Outbox            // 重传缓冲
+	Takeover    chan chan struct{} // 新连接接管会话的请求
+	Datagram    *DATAGRAM.Channel  // 不可靠数据报通道，登陆成功后开启，未配置 --datagram-listen 时为nil
+
+	Limiter *LIMITER.Session // 发包频率限制
+	Admin   chan Command     // 运维指令
+	Capture *CAPTURE.Writer  // 抓包文件，未开启抓包时为nil
+
+	Flag       int32  // 会话标记
+	KickCode   int32  // 踢掉的原因，见MsgDefine中的ERR_KICK_XXX
+	KickReason string // 踢掉的原因说明
+	State      State  // 会话状态，决定允许处理的协议
 
-	Flag int32 // 会话标记
+	Version       int32           // 协商后的客户端协议版本，0表示客户端未声明
+	VersionPolicy *VERSION.Policy // 协商时的版本策略，未协商时为nil
 
 	ConnectTime    TIME.Time // TCP链接建立时间
 	PacketTime     TIME.Time // 当前包的到达时间
 	LastPacketTime TIME.Time // 前一个包到达时间
 
 	PacketCount uint32 // 对收到的包进行计数，避免恶意发包
+
+	PingId   int32         // 最近一次Agent发起的ping
+	PingTime TIME.Time     // 最近一次ping的发送时间，收到回复后清零
+	RTT      TIME.Duration // 平滑后的往返时延，0表示还没有采样
+	Jitter   TIME.Duration // 往返时延的抖动(平均偏差)
+	RTTTime  TIME.Time     // 最近一次采样的时间
+}
+
+//---------------------------------------------
+// 标记踢掉本会话，连接关闭前把原因下发给客户端
+// 多次标记时保留第一次的原因
+func (sess *Session) Kick(code int32, reason string) {
+	if sess.Flag&SESS_KICKED_OUT == 0 {
+		sess.KickCode, sess.KickReason = code, reason
+	}
+	sess.Flag |= SESS_KICKED_OUT
+}
+
+//---------------------------------------------
+// 客户端是否支持某项功能，按协商时的版本策略判断，见FKServer_Agent/Version
+func (sess *Session) Supports(feature string) bool {
+	return sess.VersionPolicy.Supports(sess.Version, feature)
+}
+
+//---------------------------------------------
+// 记录一次往返时延采样，平滑方式同TCP(RFC 6298)
+// RTT = 7/8 RTT + 1/8 sample; Jitter = 3/4 Jitter + 1/4 |RTT - sample|
+func (sess *Session) UpdateRTT(sample TIME.Duration, now TIME.Time) {
+	if sess.RTT == 0 {
+		sess.RTT, sess.Jitter = sample, sample/2
+	} else {
+		diff := sess.RTT - sample
+		if diff < 0 {
+			diff = -diff
+		}
+		sess.Jitter = (3*sess.Jitter + diff) / 4
+		sess.RTT = (7*sess.RTT + sample) / 8
+	}
+	sess.RTTTime = now
 }
+
+//---------------------------------------------
@@ -0,0 +1,34 @@
+//---------------------------------------------
+package Session
+
+//---------------------------------------------
+import (
+	"testing"
+	TIME "time"
+)
+
+//---------------------------------------------
+func TestKick(t *testing.T) {
+	sess := &Session{}
+	sess.Kick(603, "rate limited")
+	sess.Kick(602, "server shutting down")
+	if sess.Flag&SESS_KICKED_OUT == 0 || sess.KickCode != 603 || sess.KickReason != "rate limited" {
+		t.Error("first kick reason should be kept:", sess.KickCode, sess.KickReason)
+	}
+}
+
+//---------------------------------------------
+func TestUpdateRTT(t *testing.T) {
+	sess := &Session{}
+	now := TIME.Now()
+	sess.UpdateRTT(100*TIME.Millisecond, now)
+	if sess.RTT != 100*TIME.Millisecond || sess.Jitter != 50*TIME.Millisecond || !sess.RTTTime.Equal(now) {
+		t.Error("first sample got", sess.RTT, sess.Jitter)
+	}
+	sess.UpdateRTT(180*TIME.Millisecond, now)
+	if sess.RTT != 110*TIME.Millisecond || sess.Jitter != 57500*TIME.Microsecond {
+		t.Error("second sample got", sess.RTT, sess.Jitter)
+	}
+}
+
+//---------------------------------------------
@@ -0,0 +1,155 @@
+//---------------------------------------------
+package Session
+
+//---------------------------------------------
+/*
+	会话状态机与各状态允许的协议号
+	CONNECTED -> KEYEXCHANGED -> AUTHENTICATED -> INGAME <-> FAILOVER
+	任意状态 -> CLOSING
+	1. CONNECTED:     连接建立，只允许心跳与密钥交换
+	2. KEYEXCHANGED:  密钥交换完成，允许登陆或恢复会话，不允许再次交换密钥
+	3. AUTHENTICATED: 鉴权通过但尚未连接游戏服(登陆选服失败)，允许重新登陆
+	4. INGAME:        已连接游戏服，允许转发到后端服务的协议
+	5. FAILOVER:      游戏服流中断，正在重连，不允许登陆与游戏服协议
+	6. CLOSING:       会话正在结束，不再处理任何协议
+	协议号不在当前状态允许范围内时，回复client_error_ack，不执行处理函数
+	各状态的允许范围可以用 --acl 覆盖
+*/
+//---------------------------------------------
+import (
+	ERRORS "errors"
+	STRINGS "strings"
+)
+
+//---------------------------------------------
+// 会话状态
+type State int32
+
+const (
+	STATE_CONNECTED State = iota
+	STATE_KEYEXCHANGED
+	STATE_AUTHENTICATED
+	STATE_INGAME
+	STATE_CLOSING
+	STATE_FAILOVER
+)
+
+//---------------------------------------------
+var (
+	ERROR_BAD_ACL = ERRORS.New("bad acl")
+
+	state_names = map[State]string{
+		STATE_CONNECTED:     "connected",
+		STATE_KEYEXCHANGED:  "keyexchanged",
+		STATE_AUTHENTICATED: "authenticated",
+		STATE_INGAME:        "ingame",
+		STATE_CLOSING:       "closing",
+		STATE_FAILOVER:      "failover",
+	}
+
+	// 合法的状态迁移
+	state_transitions = map[State][]State{
+		STATE_CONNECTED:     {STATE_KEYEXCHANGED, STATE_CLOSING},
+		STATE_KEYEXCHANGED:  {STATE_AUTHENTICATED, STATE_CLOSING},
+		STATE_AUTHENTICATED: {STATE_INGAME, STATE_CLOSING},
+		STATE_INGAME:        {STATE_FAILOVER, STATE_CLOSING},
+		STATE_FAILOVER:      {STATE_INGAME, STATE_CLOSING},
+	}
+
+	// 各状态默认允许的协议号区间[begin, end]
+	// 0 心跳; 10 登陆; 16 恢复会话; 23 回复Agent的ping; 30 密钥交换(v1); 32 密钥交换(v2); 35 KCP调优参数; 37 协议版本协商; 1001-32767 游戏服协议(见 --route)
+	DEFAULT_ACL = map[State][][2]int16{
+		STATE_CONNECTED:     {{0, 0}, {30, 30}, {32, 32}, {37, 37}},
+		STATE_KEYEXCHANGED:  {{0, 0}, {10, 10}, {16, 16}, {35, 35}, {37, 37}},
+		STATE_AUTHENTICATED: {{0, 0}, {10, 10}, {23, 23}, {35, 35}},
+		STATE_INGAME:        {{0, 0}, {23, 23}, {35, 35}, {1001, 32767}},
+		STATE_FAILOVER:      {{0, 0}, {23, 23}, {35, 35}},
+	}
+
+	_acl = DEFAULT_ACL
+)
+
+//---------------------------------------------
+func (s State) String() string {
+	if name, ok := state_names[s]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+//---------------------------------------------
+// 该状态是否允许处理此协议
+func (s State) Allowed(proto int16) bool {
+	for _, r := range _acl[s] {
+		if proto >= r[0] && proto <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+//---------------------------------------------
+// 迁移到新状态，不合法的迁移返回false且状态不变
+func (sess *Session) SetState(to State) bool {
+	for _, s := range state_transitions[sess.State] {
+		if s == to {
+			sess.State = to
+			return true
+		}
+	}
+	return false
+}
+
+//---------------------------------------------
+// 解析协议许可表，格式 state:ranges，例如 ingame:0,1001-32767
+// 未指定的状态沿用默认值
+func ParseACL(specs []string) (map[State][][2]int16, error) {
+	acl := make(map[State][][2]int16)
+	for s, ranges := range DEFAULT_ACL {
+		acl[s] = ranges
+	}
+	overridden := make(map[State]bool)
+	for _, spec := range specs {
+		if spec = STRINGS.TrimSpace(spec); spec == "" {
+			continue
+		}
+		parts := STRINGS.SplitN(spec, ":", 2)
+		if len(parts) != 2 {
+			return nil, ERROR_BAD_ACL
+		}
+		state, ok := func_ParseState(parts[0])
+		if !ok {
+			return nil, ERROR_BAD_ACL
+		}
+		ranges, err := ParseRanges([]string{parts[1]})
+		if err != nil {
+			return nil, err
+		}
+		// 同一状态出现多次时合并
+		if !overridden[state] {
+			acl[state] = nil
+			overridden[state] = true
+		}
+		acl[state] = append(acl[state], ranges...)
+	}
+	return acl, nil
+}
+
+//---------------------------------------------
+// 设置协议许可表，必须在开始接受连接之前调用
+func Func_SetACL(acl map[State][][2]int16) {
+	_acl = acl
+}
+
+//---------------------------------------------
+func func_ParseState(name string) (State, bool) {
+	name = STRINGS.ToLower(STRINGS.TrimSpace(name))
+	for s, n := range state_names {
+		if n == name {
+			return s, true
+		}
+	}
+	return STATE_CONNECTED, false
+}
+
+//---------------------------------------------
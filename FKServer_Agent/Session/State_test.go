@@ -0,0 +1,65 @@
+//---------------------------------------------
+package Session
+
+//---------------------------------------------
+import (
+	"testing"
+)
+
+//---------------------------------------------
+func TestStateMachine(t *testing.T) {
+	sess := &Session{}
+	if !sess.State.Allowed(30) || sess.State.Allowed(10) || sess.State.Allowed(1001) {
+		t.Error("connected acl mismatch")
+	}
+	if sess.SetState(STATE_INGAME) || sess.State != STATE_CONNECTED {
+		t.Error("connected should not jump into game")
+	}
+
+	for _, s := range []State{STATE_KEYEXCHANGED, STATE_AUTHENTICATED, STATE_INGAME} {
+		if !sess.SetState(s) {
+			t.Error("transition failed:", s)
+		}
+	}
+	if sess.State.Allowed(30) || sess.State.Allowed(10) || !sess.State.Allowed(1001) || !sess.State.Allowed(0) {
+		t.Error("ingame acl mismatch")
+	}
+
+	// 游戏服故障转移期间不允许重新登陆
+	if sess.SetState(STATE_AUTHENTICATED) || !sess.SetState(STATE_FAILOVER) {
+		t.Error("failover transition failed")
+	}
+	if sess.State.Allowed(10) || sess.State.Allowed(1001) || !sess.State.Allowed(0) {
+		t.Error("failover acl mismatch")
+	}
+	if !sess.SetState(STATE_INGAME) {
+		t.Error("restore transition failed")
+	}
+	if !sess.SetState(STATE_CLOSING) || sess.SetState(STATE_INGAME) || sess.State.Allowed(0) {
+		t.Error("closing should be final")
+	}
+}
+
+//---------------------------------------------
+func TestParseACL(t *testing.T) {
+	acl, err := ParseACL([]string{"ingame:0,1001-1999", "InGame:5000", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Func_SetACL(DEFAULT_ACL)
+	Func_SetACL(acl)
+	if !STATE_INGAME.Allowed(1500) || !STATE_INGAME.Allowed(5000) || STATE_INGAME.Allowed(2000) {
+		t.Error("overridden acl mismatch")
+	}
+	if !STATE_CONNECTED.Allowed(32) {
+		t.Error("other states should keep defaults")
+	}
+
+	for _, spec := range []string{"ingame", "lobby:1", "ingame:9-1"} {
+		if _, err := ParseACL([]string{spec}); err == nil {
+			t.Error("bad acl accepted:", spec)
+		}
+	}
+}
+
+//---------------------------------------------
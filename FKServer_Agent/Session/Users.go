@@ -0,0 +1,103 @@
+//---------------------------------------------
+package Session
+
+//---------------------------------------------
+import (
+	SYNC "sync"
+)
+
+//---------------------------------------------
+// 已登陆玩家索引
+// 游戏服的广播、组播帧按玩家ID查找本Agent上的会话
+// 重复登陆时按owner查找被覆盖的旧会话
+type Users struct {
+	records map[int32]*Session  // userid -> session
+	owners  map[string]*Session // owner -> session
+	SYNC.RWMutex
+}
+
+//---------------------------------------------
+var (
+	_default_users = Users{records: make(map[int32]*Session), owners: make(map[string]*Session)}
+)
+
+//---------------------------------------------
+// 登记玩家
+func (u *Users) Register(id int32, sess *Session) {
+	u.Lock()
+	u.records[id] = sess
+	if sess.Owner != "" {
+		u.owners[sess.Owner] = sess
+	}
+	u.Unlock()
+}
+
+//---------------------------------------------
+// 移除玩家，仅当id仍然指向该会话时才移除
+func (u *Users) Unregister(id int32, sess *Session) {
+	u.Lock()
+	if u.records[id] == sess {
+		delete(u.records, id)
+	}
+	if u.owners[sess.Owner] == sess {
+		delete(u.owners, sess.Owner)
+	}
+	u.Unlock()
+}
+
+//---------------------------------------------
+// 查询玩家会话
+func (u *Users) Query(id int32) (sess *Session) {
+	u.RLock()
+	sess = u.records[id]
+	u.RUnlock()
+	return
+}
+
+//---------------------------------------------
+// 按在线表中的owner查询会话
+func (u *Users) QueryOwner(owner string) (sess *Session) {
+	u.RLock()
+	sess = u.owners[owner]
+	u.RUnlock()
+	return
+}
+
+//---------------------------------------------
+// 全部已登陆会话
+func (u *Users) All() []*Session {
+	u.RLock()
+	all := make([]*Session, 0, len(u.records))
+	for _, sess := range u.records {
+		all = append(all, sess)
+	}
+	u.RUnlock()
+	return all
+}
+
+//---------------------------------------------
+func Func_RegisterUser(id int32, sess *Session) {
+	_default_users.Register(id, sess)
+}
+
+//---------------------------------------------
+func Func_UnregisterUser(id int32, sess *Session) {
+	_default_users.Unregister(id, sess)
+}
+
+//---------------------------------------------
+func Func_QueryUser(id int32) *Session {
+	return _default_users.Query(id)
+}
+
+//---------------------------------------------
+func Func_QueryOwner(owner string) *Session {
+	return _default_users.QueryOwner(owner)
+}
+
+//---------------------------------------------
+func Func_AllUsers() []*Session {
+	return _default_users.All()
+}
+
+//---------------------------------------------
@@ -0,0 +1,124 @@
+//---------------------------------------------
+package udp
+
+//---------------------------------------------
+import (
+	SYNC "sync"
+	ATOMIC "sync/atomic"
+
+	KCP "github.com/xtaci/kcp-go"
+)
+
+//---------------------------------------------
+// 单个连接的统计
+type Stats struct {
+	Profile  string `json:"profile"`
+	BytesIn  uint64 `json:"bytes_in"`  // 收到的字节数(KCP解包后)
+	BytesOut uint64 `json:"bytes_out"` // 发送的字节数(KCP封包前)
+	Reads    uint64 `json:"reads"`
+	Writes   uint64 `json:"writes"`
+}
+
+//---------------------------------------------
+// KCP连接，记录调优参数与收发统计
+// 调优参数在会话协程中切换，收发在连接协程中进行
+type Conn struct {
+	*KCP.UDPSession
+	profile  string
+	mu       SYNC.Mutex // 保护profile
+	bytesIn  uint64
+	bytesOut uint64
+	reads    uint64
+	writes   uint64
+	once     SYNC.Once
+}
+
+//---------------------------------------------
+// 接受新连接，使用默认的调优参数
+func Func_Accept(s *KCP.UDPSession) *Conn {
+	conn := &Conn{UDPSession: s}
+	conn.SetKeepAlive(0)
+	conn.SetStreamMode(true)
+	cfg := func_Config()
+	conn.func_Apply(cfg.Profiles[cfg.Default])
+	return conn
+}
+
+//---------------------------------------------
+func (conn *Conn) func_Apply(p Profile) {
+	conn.SetNoDelay(p.NoDelay, p.Interval, p.Resend, p.NC)
+	conn.SetWindowSize(p.SndWnd, p.RcvWnd)
+	if p.MTU > 0 {
+		conn.SetMtu(p.MTU)
+	}
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.profile != "" {
+		_profile_counters.Add(conn.profile+".conns", -1)
+	}
+	conn.profile = p.Name
+	_profile_counters.Add(conn.profile+".conns", 1)
+}
+
+//---------------------------------------------
+// 客户端协商切换调优参数，需要开启 --kcp-negotiate
+func (conn *Conn) SetProfile(name string) error {
+	cfg := func_Config()
+	if !cfg.Negotiate {
+		return ERROR_NEGOTIATE_DISABLED
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		return ERROR_UNKNOWN_PROFILE
+	}
+	conn.func_Apply(p)
+	return nil
+}
+
+//---------------------------------------------
+// 当前的调优参数
+func (conn *Conn) Profile() string {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	return conn.profile
+}
+
+//---------------------------------------------
+func (conn *Conn) Read(b []byte) (int, error) {
+	n, err := conn.UDPSession.Read(b)
+	ATOMIC.AddUint64(&conn.bytesIn, uint64(n))
+	ATOMIC.AddUint64(&conn.reads, 1)
+	_profile_counters.Add(conn.Profile()+".bytes_in", int64(n))
+	return n, err
+}
+
+//---------------------------------------------
+func (conn *Conn) Write(b []byte) (int, error) {
+	n, err := conn.UDPSession.Write(b)
+	ATOMIC.AddUint64(&conn.bytesOut, uint64(n))
+	ATOMIC.AddUint64(&conn.writes, 1)
+	_profile_counters.Add(conn.Profile()+".bytes_out", int64(n))
+	return n, err
+}
+
+//---------------------------------------------
+func (conn *Conn) Close() error {
+	conn.once.Do(func() {
+		_profile_counters.Add(conn.Profile()+".conns", -1)
+	})
+	return conn.UDPSession.Close()
+}
+
+//---------------------------------------------
+// 收发统计
+func (conn *Conn) Stats() *Stats {
+	return &Stats{
+		Profile:  conn.Profile(),
+		BytesIn:  ATOMIC.LoadUint64(&conn.bytesIn),
+		BytesOut: ATOMIC.LoadUint64(&conn.bytesOut),
+		Reads:    ATOMIC.LoadUint64(&conn.reads),
+		Writes:   ATOMIC.LoadUint64(&conn.writes),
+	}
+}
+
+//---------------------------------------------
@@ -0,0 +1,77 @@
+//---------------------------------------------
+package udp
+
+//---------------------------------------------
+import (
+	ERRORS "errors"
+	FMT "fmt"
+	STRCONV "strconv"
+	STRINGS "strings"
+)
+
+//---------------------------------------------
+// KCP调优参数，含义见kcp-go的SetNoDelay, SetWindowSize, SetMtu
+type Profile struct {
+	Name     string
+	NoDelay  int // 是否开启nodelay模式
+	Interval int // 内部刷新间隔(毫秒)
+	Resend   int // 快速重传的ACK跨越次数，0为关闭快速重传
+	NC       int // 是否关闭拥塞控制
+	SndWnd   int // 发送窗口(包)
+	RcvWnd   int // 接收窗口(包)
+	MTU      int // 0表示使用kcp-go的默认值
+}
+
+//---------------------------------------------
+var (
+	// 预置的调优参数
+	// fast:          实时对战，激进重传，流量最大
+	// normal:        默认，与之前固定的参数一致
+	// low-bandwidth: 弱网与流量敏感的客户端，开启拥塞控制，减少重传和包大小
+	DEFAULT_PROFILES = []Profile{
+		{Name: "fast", NoDelay: 1, Interval: 10, Resend: 2, NC: 1, SndWnd: 128, RcvWnd: 128},
+		{Name: "normal", NoDelay: 1, Interval: 20, Resend: 1, NC: 1, SndWnd: 32, RcvWnd: 32},
+		{Name: "low-bandwidth", NoDelay: 0, Interval: 40, Resend: 0, NC: 0, SndWnd: 16, RcvWnd: 32, MTU: 548},
+	}
+
+	ERROR_BAD_PROFILE     = ERRORS.New("bad kcp profile")
+	ERROR_UNKNOWN_PROFILE = ERRORS.New("unknown kcp profile")
+)
+
+//---------------------------------------------
+// 解析自定义调优参数，格式为 name:nodelay,interval,resend,nc,sndwnd,rcvwnd[,mtu]
+// 例如 battle:1,10,2,1,256,256,1200
+func ParseProfile(spec string) (Profile, error) {
+	var p Profile
+	parts := STRINGS.SplitN(spec, ":", 2)
+	if len(parts) != 2 || STRINGS.TrimSpace(parts[0]) == "" {
+		return p, ERROR_BAD_PROFILE
+	}
+	p.Name = STRINGS.TrimSpace(parts[0])
+
+	fields := STRINGS.Split(parts[1], ",")
+	if len(fields) != 6 && len(fields) != 7 {
+		return p, ERROR_BAD_PROFILE
+	}
+	values := make([]int, 7)
+	for i, f := range fields {
+		v, err := STRCONV.Atoi(STRINGS.TrimSpace(f))
+		if err != nil || v < 0 {
+			return p, ERROR_BAD_PROFILE
+		}
+		values[i] = v
+	}
+	p.NoDelay, p.Interval, p.Resend, p.NC = values[0], values[1], values[2], values[3]
+	p.SndWnd, p.RcvWnd, p.MTU = values[4], values[5], values[6]
+	if p.Interval == 0 || p.SndWnd == 0 || p.RcvWnd == 0 {
+		return p, ERROR_BAD_PROFILE
+	}
+	return p, nil
+}
+
+//---------------------------------------------
+func (p Profile) String() string {
+	return FMT.Sprintf("%v:%v,%v,%v,%v,%v,%v,%v", p.Name, p.NoDelay, p.Interval, p.Resend, p.NC, p.SndWnd, p.RcvWnd, p.MTU)
+}
+
+//---------------------------------------------
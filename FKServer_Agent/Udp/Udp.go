@@ -0,0 +1,193 @@
+//---------------------------------------------
+package udp
+
+//---------------------------------------------
+/*
+	KCP监听配置
+	调优参数: 按名称选取(见Profile.go)，--kcp-profile 为新连接的默认值，--kcp-profile-custom 增加或覆盖
+	          开启 --kcp-negotiate 时客户端可以通过kcp_profile_req切换本连接的参数
+	前向纠错: --kcp-data-shards 与 --kcp-parity-shards 指定Reed-Solomon分片数，0为关闭
+	包加密:   --kcp-crypt 与 --kcp-key 对每个UDP包加密，与会话层的加密相互独立
+	前向纠错与包加密作用于整个监听，客户端必须使用相同的配置
+	统计:     kcp-go全局的SNMP计数导出为/debug/vars中的kcp_snmp
+	          每个调优参数的连接数与收发字节数导出为kcp_profiles，单个连接的统计见 /admin/sessions
+*/
+//---------------------------------------------
+import (
+	SHA1 "crypto/sha1"
+	ERRORS "errors"
+	EXPVAR "expvar"
+	SYNC "sync"
+
+	LOG "github.com/Sirupsen/logrus"
+	KCP "github.com/xtaci/kcp-go"
+	PBKDF2 "golang.org/x/crypto/pbkdf2"
+	CLI "gopkg.in/urfave/cli.v2"
+)
+
+//---------------------------------------------
+const (
+	DEFAULT_PROFILE = "normal"
+	CRYPT_SALT      = "FKGoServer-kcp" // 由--kcp-key生成密钥时使用的盐，客户端必须一致
+	CRYPT_ITER      = 4096
+)
+
+//---------------------------------------------
+var (
+	ERROR_BAD_CRYPT          = ERRORS.New("bad kcp crypt")
+	ERROR_BAD_SHARDS         = ERRORS.New("bad kcp fec shards")
+	ERROR_NEGOTIATE_DISABLED = ERRORS.New("kcp profile negotiation disabled")
+
+	_profile_counters = EXPVAR.NewMap("kcp_profiles") // profile.conns, profile.bytes_in, profile.bytes_out
+)
+
+//---------------------------------------------
+func init() {
+	EXPVAR.Publish("kcp_snmp", EXPVAR.Func(func_Snmp))
+	// 未初始化时使用预置参数，不加密，不纠错
+	cfg, _ := NewConfig(DEFAULT_PROFILE, nil, false, "", "", 0, 0)
+	_default_config = *cfg
+}
+
+//---------------------------------------------
+// 监听配置
+type Config struct {
+	Profiles     map[string]Profile // 可选的调优参数，按名称索引
+	Default      string             // 新连接的调优参数
+	Negotiate    bool               // 是否允许客户端切换调优参数
+	Crypt        string             // 包加密算法
+	DataShards   int                // 前向纠错数据分片数
+	ParityShards int                // 前向纠错校验分片数
+	block        KCP.BlockCrypt
+}
+
+var (
+	_default_config Config
+	_mu             SYNC.RWMutex
+	once            SYNC.Once
+)
+
+//---------------------------------------------
+func InitWithCliContext(c *CLI.Context) {
+	once.Do(func() {
+		cfg, err := NewConfig(c.String("kcp-profile"), c.StringSlice("kcp-profile-custom"), c.Bool("kcp-negotiate"),
+			c.String("kcp-crypt"), c.String("kcp-key"), c.Int("kcp-data-shards"), c.Int("kcp-parity-shards"))
+		if err != nil {
+			LOG.Fatal("KCP配置错误:", err)
+		}
+		Func_SetConfig(cfg)
+		LOG.Printf("KCP调优参数:%v 允许协商:%v 包加密:%v 前向纠错:%v/%v", cfg.Default, cfg.Negotiate, cfg.Crypt, cfg.DataShards, cfg.ParityShards)
+	})
+}
+
+//---------------------------------------------
+// 根据参数生成监听配置
+func NewConfig(profile string, custom []string, negotiate bool, crypt, key string, data, parity int) (*Config, error) {
+	cfg := &Config{
+		Profiles:     make(map[string]Profile),
+		Default:      profile,
+		Negotiate:    negotiate,
+		Crypt:        crypt,
+		DataShards:   data,
+		ParityShards: parity,
+	}
+	for _, p := range DEFAULT_PROFILES {
+		cfg.Profiles[p.Name] = p
+	}
+	for _, spec := range custom {
+		p, err := ParseProfile(spec)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Profiles[p.Name] = p
+	}
+	if cfg.Default == "" {
+		cfg.Default = DEFAULT_PROFILE
+	}
+	if _, ok := cfg.Profiles[cfg.Default]; !ok {
+		return nil, ERROR_UNKNOWN_PROFILE
+	}
+	if data < 0 || parity < 0 || (data == 0) != (parity == 0) {
+		return nil, ERROR_BAD_SHARDS
+	}
+	var err error
+	if cfg.block, err = NewBlockCrypt(crypt, key); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+//---------------------------------------------
+func Func_SetConfig(cfg *Config) {
+	_mu.Lock()
+	defer _mu.Unlock()
+	_default_config = *cfg
+}
+
+//---------------------------------------------
+func func_Config() *Config {
+	_mu.RLock()
+	defer _mu.RUnlock()
+	cfg := _default_config
+	return &cfg
+}
+
+//---------------------------------------------
+// 查找调优参数
+func Func_Profile(name string) (Profile, bool) {
+	p, ok := func_Config().Profiles[name]
+	return p, ok
+}
+
+//---------------------------------------------
+// 包加密算法，name为空或none时不加密
+// 支持 aes, aes-128, aes-192, salsa20, blowfish, twofish, cast5, 3des, tea, xtea, xor
+func NewBlockCrypt(name, key string) (KCP.BlockCrypt, error) {
+	if name == "" || name == "none" {
+		return nil, nil
+	}
+	if key == "" {
+		return nil, ERROR_BAD_CRYPT
+	}
+	pass := PBKDF2.Key([]byte(key), []byte(CRYPT_SALT), CRYPT_ITER, 32, SHA1.New)
+	switch name {
+	case "aes":
+		return KCP.NewAESBlockCrypt(pass)
+	case "aes-128":
+		return KCP.NewAESBlockCrypt(pass[:16])
+	case "aes-192":
+		return KCP.NewAESBlockCrypt(pass[:24])
+	case "salsa20":
+		return KCP.NewSalsa20BlockCrypt(pass)
+	case "blowfish":
+		return KCP.NewBlowfishBlockCrypt(pass)
+	case "twofish":
+		return KCP.NewTwofishBlockCrypt(pass)
+	case "cast5":
+		return KCP.NewCast5BlockCrypt(pass[:16])
+	case "3des":
+		return KCP.NewTripleDESBlockCrypt(pass[:24])
+	case "tea":
+		return KCP.NewTEABlockCrypt(pass[:16])
+	case "xtea":
+		return KCP.NewXTEABlockCrypt(pass[:16])
+	case "xor":
+		return KCP.NewSimpleXORBlockCrypt(pass)
+	}
+	return nil, ERROR_BAD_CRYPT
+}
+
+//---------------------------------------------
+// 按当前配置监听，启用前向纠错与包加密
+func Func_Listen(addr string) (*KCP.Listener, error) {
+	cfg := func_Config()
+	return KCP.ListenWithOptions(addr, cfg.block, cfg.DataShards, cfg.ParityShards)
+}
+
+//---------------------------------------------
+// kcp-go全局的SNMP计数
+func func_Snmp() interface{} {
+	return KCP.DefaultSnmp.Copy()
+}
+
+//---------------------------------------------
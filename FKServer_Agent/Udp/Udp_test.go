@@ -0,0 +1,112 @@
+//---------------------------------------------
+package udp
+
+//---------------------------------------------
+import (
+	IO "io"
+	"testing"
+	TIME "time"
+
+	KCP "github.com/xtaci/kcp-go"
+)
+
+//---------------------------------------------
+func TestParseProfile(t *testing.T) {
+	p, err := ParseProfile("battle:1,10,2,1,256,256,1200")
+	if err != nil || p.Name != "battle" || p.Interval != 10 || p.RcvWnd != 256 || p.MTU != 1200 {
+		t.Error("parse got", p, err)
+	}
+	if p, err = ParseProfile("slow:0,40,0,0,16,32"); err != nil || p.MTU != 0 {
+		t.Error("parse without mtu got", p, err)
+	}
+	for _, spec := range []string{"", "x", ":1,10,2,1,32,32", "x:1,10,2,1", "x:1,0,2,1,32,32", "x:1,10,-2,1,32,32", "x:a,10,2,1,32,32"} {
+		if _, err := ParseProfile(spec); err != ERROR_BAD_PROFILE {
+			t.Error("bad spec accepted:", spec)
+		}
+	}
+}
+
+//---------------------------------------------
+func TestConfig(t *testing.T) {
+	cfg, err := NewConfig("", []string{"normal:1,15,1,1,64,64"}, true, "", "", 0, 0)
+	if err != nil || cfg.Default != DEFAULT_PROFILE || cfg.Profiles["normal"].SndWnd != 64 || cfg.Profiles["fast"].Name != "fast" {
+		t.Error("config got", cfg, err)
+	}
+	if _, err := NewConfig("turbo", nil, false, "", "", 0, 0); err != ERROR_UNKNOWN_PROFILE {
+		t.Error("unknown default profile got", err)
+	}
+	if _, err := NewConfig("", nil, false, "", "", 10, 0); err != ERROR_BAD_SHARDS {
+		t.Error("bad shards got", err)
+	}
+	if _, err := NewConfig("", nil, false, "aes", "", 0, 0); err != ERROR_BAD_CRYPT {
+		t.Error("crypt without key got", err)
+	}
+	if _, err := NewConfig("", nil, false, "rot13", "key", 0, 0); err != ERROR_BAD_CRYPT {
+		t.Error("unknown crypt got", err)
+	}
+	for _, name := range []string{"aes", "aes-128", "aes-192", "salsa20", "blowfish", "twofish", "cast5", "3des", "tea", "xtea", "xor"} {
+		if block, err := NewBlockCrypt(name, "key"); err != nil || block == nil {
+			t.Error("crypt", name, "got", err)
+		}
+	}
+}
+
+//---------------------------------------------
+func TestConn(t *testing.T) {
+	cfg, err := NewConfig("fast", nil, true, "aes", "secret", 10, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Func_SetConfig(cfg)
+	defer Func_SetConfig(&Config{Profiles: cfg.Profiles, Default: DEFAULT_PROFILE})
+
+	l, err := Func_Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	block, _ := NewBlockCrypt("aes", "secret")
+	client, err := KCP.DialWithOptions(l.Addr().String(), block, 10, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.SetNoDelay(1, 10, 2, 1)
+	client.Write([]byte("ping"))
+
+	l.SetDeadline(TIME.Now().Add(5 * TIME.Second))
+	s, err := l.AcceptKCP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := Func_Accept(s)
+	defer conn.Close()
+	if conn.Profile() != "fast" {
+		t.Error("default profile got", conn.Profile())
+	}
+
+	conn.SetReadDeadline(TIME.Now().Add(5 * TIME.Second))
+	buf := make([]byte, 4)
+	if _, err := IO.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatal("read got", string(buf), err)
+	}
+	conn.Write([]byte("pong"))
+	if stats := conn.Stats(); stats.BytesIn != 4 || stats.BytesOut != 4 || stats.Profile != "fast" {
+		t.Error("stats got", stats)
+	}
+
+	if err := conn.SetProfile("turbo"); err != ERROR_UNKNOWN_PROFILE {
+		t.Error("unknown profile got", err)
+	}
+	if err := conn.SetProfile("low-bandwidth"); err != nil || conn.Profile() != "low-bandwidth" {
+		t.Error("set profile got", conn.Profile(), err)
+	}
+
+	Func_SetConfig(&Config{Profiles: cfg.Profiles, Default: DEFAULT_PROFILE})
+	if err := conn.SetProfile("fast"); err != ERROR_NEGOTIATE_DISABLED {
+		t.Error("negotiation should be disabled:", err)
+	}
+}
+
+//---------------------------------------------
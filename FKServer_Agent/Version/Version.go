@@ -0,0 +1,191 @@
+//---------------------------------------------
+package version
+
+//---------------------------------------------
+/*
+	客户端协议版本
+	服务器支持的版本区间来自命令行参数 --client-version，设置了 --client-version-key 时从etcd读取并监视该key，修改后立即生效
+	客户端在登陆前以client_version_req声明自己的协议版本:
+		低于最低版本: 回复client_version_faild_ack，携带新版本的下载地址，之后的登陆同样被拒绝
+		高于最高版本: 按最高版本通信，客户端需要向下兼容
+	未经协商直接登陆的旧客户端按S_user_login_info.F_client_version检查
+	协商出的版本记录在会话中，处理函数按功能要求的最低版本判断客户端是否支持，见Policy.Supports
+*/
+//---------------------------------------------
+import (
+	JSON "encoding/json"
+	ERRORS "errors"
+	FMT "fmt"
+	STRCONV "strconv"
+	STRINGS "strings"
+	ATOMIC "sync/atomic"
+)
+
+//---------------------------------------------
+// Agent自身按版本区分的功能，未在策略中配置最低版本的功能对全部客户端开放
+// 需要客户端处理新协议的功能除外，见opt_in_features
+const (
+	FEATURE_DATAGRAM    = "datagram"    // 登陆时开启不可靠数据报通道
+	FEATURE_SERVER_PING = "server_ping" // Agent主动发起ping测量往返时延
+)
+
+//---------------------------------------------
+// 会向客户端下发新协议的功能，旧客户端无法识别，必须在策略中配置最低版本后才开放
+var opt_in_features = map[string]bool{
+	FEATURE_SERVER_PING: true,
+}
+
+//---------------------------------------------
+var (
+	ERROR_TOO_OLD     = ERRORS.New("client version too old")
+	ERROR_BAD_RANGE   = ERRORS.New("bad version range")
+	ERROR_BAD_FEATURE = ERRORS.New("bad version feature")
+)
+
+//---------------------------------------------
+// 版本策略，创建后只读，更新时整体替换
+type Policy struct {
+	Min      int32            `json:"min"`                // 最低协议版本，0表示不限制
+	Max      int32            `json:"max"`                // 最高协议版本，0表示不限制
+	URL      string           `json:"url"`                // 版本过低时下发的新版本下载地址
+	Features map[string]int32 `json:"features,omitempty"` // 功能 -> 要求的最低协议版本
+}
+
+//---------------------------------------------
+var (
+	_policy ATOMIC.Value // *Policy
+)
+
+func init() {
+	_policy.Store(&Policy{})
+}
+
+//---------------------------------------------
+// 根据命令行参数创建版本策略
+// spec为版本区间，格式 min-max，例如 3-5，省略max(3-或3)表示不限制最高版本，为空表示不限制
+// features格式 name:version，例如 datagram:2
+func NewPolicy(spec, url string, features []string) (*Policy, error) {
+	p := &Policy{URL: url, Features: make(map[string]int32)}
+	var err error
+	if p.Min, p.Max, err = ParseRange(spec); err != nil {
+		return nil, err
+	}
+	for _, f := range features {
+		f = STRINGS.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		kv := STRINGS.SplitN(f, ":", 2)
+		if len(kv) != 2 || STRINGS.TrimSpace(kv[0]) == "" {
+			return nil, FMT.Errorf("%v: %v", ERROR_BAD_FEATURE, f)
+		}
+		v, err := STRCONV.ParseInt(STRINGS.TrimSpace(kv[1]), 10, 32)
+		if err != nil {
+			return nil, FMT.Errorf("%v: %v", ERROR_BAD_FEATURE, f)
+		}
+		p.Features[STRINGS.TrimSpace(kv[0])] = int32(v)
+	}
+	return p, p.Validate()
+}
+
+//---------------------------------------------
+// 解析etcd中的版本策略，格式为JSON，例如
+// {"min":3,"max":5,"url":"https://example.com/download","features":{"datagram":4}}
+func ParsePolicy(data string) (*Policy, error) {
+	p := &Policy{}
+	if err := JSON.Unmarshal([]byte(data), p); err != nil {
+		return nil, err
+	}
+	return p, p.Validate()
+}
+
+//---------------------------------------------
+// 解析版本区间，格式 min-max
+func ParseRange(spec string) (min, max int32, err error) {
+	spec = STRINGS.TrimSpace(spec)
+	if spec == "" {
+		return 0, 0, nil
+	}
+	parts := STRINGS.SplitN(spec, "-", 2)
+	v, err := STRCONV.ParseInt(STRINGS.TrimSpace(parts[0]), 10, 32)
+	if err != nil {
+		return 0, 0, FMT.Errorf("%v: %v", ERROR_BAD_RANGE, spec)
+	}
+	min = int32(v)
+	if len(parts) == 2 && STRINGS.TrimSpace(parts[1]) != "" {
+		if v, err = STRCONV.ParseInt(STRINGS.TrimSpace(parts[1]), 10, 32); err != nil {
+			return 0, 0, FMT.Errorf("%v: %v", ERROR_BAD_RANGE, spec)
+		}
+		max = int32(v)
+	}
+	if min < 0 || max < 0 || (max > 0 && min > max) {
+		return 0, 0, FMT.Errorf("%v: %v", ERROR_BAD_RANGE, spec)
+	}
+	return min, max, nil
+}
+
+//---------------------------------------------
+// 检查策略是否合法
+func (p *Policy) Validate() error {
+	if p.Min < 0 || p.Max < 0 || (p.Max > 0 && p.Min > p.Max) {
+		return FMT.Errorf("%v: %v", ERROR_BAD_RANGE, p)
+	}
+	for name, v := range p.Features {
+		if name == "" || v < 0 {
+			return FMT.Errorf("%v: %v:%v", ERROR_BAD_FEATURE, name, v)
+		}
+	}
+	return nil
+}
+
+//---------------------------------------------
+// 按策略协商客户端的协议版本，返回会话使用的版本
+// 低于最低版本返回ERROR_TOO_OLD，高于最高版本时按最高版本通信
+func (p *Policy) Negotiate(version int32) (int32, error) {
+	if p == nil {
+		return version, nil
+	}
+	if version < p.Min {
+		return 0, ERROR_TOO_OLD
+	}
+	if p.Max > 0 && version > p.Max {
+		return p.Max, nil
+	}
+	return version, nil
+}
+
+//---------------------------------------------
+// 该协议版本是否支持某项功能，策略中未配置的功能对全部版本开放，opt_in_features中的功能对全部版本关闭
+func (p *Policy) Supports(version int32, feature string) bool {
+	if p == nil {
+		return !opt_in_features[feature]
+	}
+	need, ok := p.Features[feature]
+	if !ok {
+		return !opt_in_features[feature]
+	}
+	return version >= need
+}
+
+//---------------------------------------------
+func (p *Policy) String() string {
+	s := FMT.Sprintf("%v-", p.Min)
+	if p.Max > 0 {
+		s += FMT.Sprint(p.Max)
+	}
+	return FMT.Sprintf("%v url:%q features:%v", s, p.URL, p.Features)
+}
+
+//---------------------------------------------
+// 替换当前的版本策略，已经协商过的会话沿用协商时的策略
+func Func_SetPolicy(p *Policy) {
+	_policy.Store(p)
+}
+
+//---------------------------------------------
+// 当前的版本策略
+func Func_Policy() *Policy {
+	return _policy.Load().(*Policy)
+}
+
+//---------------------------------------------
@@ -0,0 +1,96 @@
+//---------------------------------------------
+package version
+
+//---------------------------------------------
+import (
+	"testing"
+)
+
+//---------------------------------------------
+func TestParseRange(t *testing.T) {
+	cases := map[string][2]int32{
+		"":      {0, 0},
+		"3":     {3, 0},
+		"3-":    {3, 0},
+		" 3-5 ": {3, 5},
+		"5-5":   {5, 5},
+	}
+	for spec, want := range cases {
+		min, max, err := ParseRange(spec)
+		if err != nil || min != want[0] || max != want[1] {
+			t.Errorf("parse %q: got %v-%v %v want %v", spec, min, max, err, want)
+		}
+	}
+	for _, spec := range []string{"a", "3-b", "5-3", "-1", "3-5-7"} {
+		if _, _, err := ParseRange(spec); err == nil {
+			t.Errorf("parse %q: expected error", spec)
+		}
+	}
+}
+
+//---------------------------------------------
+func TestNegotiate(t *testing.T) {
+	p, err := NewPolicy("3-5", "https://example.com/download", []string{"datagram:4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Negotiate(2); err != ERROR_TOO_OLD {
+		t.Error("too old got", err)
+	}
+	if _, err := p.Negotiate(0); err != ERROR_TOO_OLD {
+		t.Error("undeclared got", err)
+	}
+	for version, want := range map[int32]int32{3: 3, 5: 5, 9: 5} {
+		if got, err := p.Negotiate(version); err != nil || got != want {
+			t.Errorf("negotiate %v: got %v %v want %v", version, got, err, want)
+		}
+	}
+
+	if p.Supports(3, FEATURE_DATAGRAM) || !p.Supports(4, FEATURE_DATAGRAM) {
+		t.Error("datagram feature")
+	}
+	if !p.Supports(3, "unlisted") {
+		t.Error("unlisted feature should be supported")
+	}
+	if p.Supports(5, FEATURE_SERVER_PING) {
+		t.Error("unlisted opt-in feature should not be supported")
+	}
+
+	// 未配置的策略不限制版本
+	var none *Policy
+	if v, err := none.Negotiate(7); err != nil || v != 7 || !none.Supports(0, FEATURE_DATAGRAM) || none.Supports(7, FEATURE_SERVER_PING) {
+		t.Error("nil policy")
+	}
+	if v, err := Func_Policy().Negotiate(0); err != nil || v != 0 {
+		t.Error("default policy")
+	}
+
+	if _, err := NewPolicy("", "", []string{"datagram"}); err == nil {
+		t.Error("bad feature accepted")
+	}
+}
+
+//---------------------------------------------
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy(`{"min":2,"max":4,"url":"https://example.com/download","features":{"server_ping":3}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Min != 2 || p.Max != 4 || p.URL != "https://example.com/download" || p.Supports(2, FEATURE_SERVER_PING) || !p.Supports(3, FEATURE_SERVER_PING) {
+		t.Error("parsed:", p)
+	}
+	for _, data := range []string{`{"min":5,"max":3}`, `{"min":-1}`, `{"features":{"datagram":-1}}`, `min=1`} {
+		if _, err := ParsePolicy(data); err == nil {
+			t.Errorf("parse %q: expected error", data)
+		}
+	}
+
+	old := Func_Policy()
+	defer Func_SetPolicy(old)
+	Func_SetPolicy(p)
+	if Func_Policy() != p {
+		t.Error("set policy")
+	}
+}
+
+//---------------------------------------------
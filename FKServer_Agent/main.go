@@ -11,7 +11,10 @@ import (
 
 	HTTP "net/http"
 	OS "os"
+	TIME "time"
 
+	MSGDEFINE "FKGoServer/FKLib_Common/MsgDefine"
+	PACKET "FKGoServer/FKLib_Common/Packet"
 	UTILS "FKGoServer/FKLib_Common/Utils"
 	FRAMEWORK "FKGoServer/FKServer_Agent/Framework"
 
@@ -40,6 +43,35 @@ func main() {
 				Value: ":8888",
 				Usage: "监听端口",
 			},
+			&CLI.StringFlag{
+				Name:  "ws-listen",
+				Value: "",
+				Usage: "WebSocket监听端口，例如 :8889，为空则不启用",
+			},
+			&CLI.StringFlag{
+				Name:  "ws-path",
+				Value: "/ws",
+				Usage: "WebSocket路径",
+			},
+			&CLI.StringSliceFlag{
+				Name:  "ws-origin",
+				Usage: "允许的WebSocket来源(Origin)，为空则不限制",
+			},
+			&CLI.StringFlag{
+				Name:  "wss-cert",
+				Value: "",
+				Usage: "WSS证书(PEM)，与 --wss-key 同时设置时启用WSS",
+			},
+			&CLI.StringFlag{
+				Name:  "wss-key",
+				Value: "",
+				Usage: "WSS证书私钥(PEM)",
+			},
+			&CLI.DurationFlag{
+				Name:  "ws-handshake-timeout",
+				Value: 10 * TIME.Second,
+				Usage: "WebSocket升级握手(包括读取HTTP请求头)的最长时间，超时未完成的连接被关闭",
+			},
 			&CLI.StringSliceFlag{
 				Name:  "etcd-hosts",
 				Value: CLI.NewStringSlice("http://127.0.0.1:2379"),
@@ -52,8 +84,239 @@ func main() {
 			},
 			&CLI.StringSliceFlag{
 				Name:  "services",
-				Value: CLI.NewStringSlice("snowflake-10000", "game-10000"),
-				Usage: "自动发现服务器",
+				Value: CLI.NewStringSlice("snowflake-10000"),
+				Usage: "自动发现服务器，--game-service 与 --route 中的服务自动加入，为空则发现全部服务",
+			},
+			&CLI.StringSliceFlag{
+				Name:  "handshake",
+				Value: CLI.NewStringSlice("v1"),
+				Usage: "启用的握手版本(v1: DH+RC4, v2: MODP-2048+RSA+AES-GCM)",
+			},
+			&CLI.StringFlag{
+				Name:  "handshake-key",
+				Value: "",
+				Usage: "v2握手的服务器RSA私钥(PEM)，启用v2握手时必须设置",
+			},
+			&CLI.StringSliceFlag{
+				Name:  "compress",
+				Value: CLI.NewStringSlice("lz4", "snappy"),
+				Usage: "v2握手可协商的压缩算法，按优先级排列(lz4, snappy)，为空则不压缩",
+			},
+			&CLI.IntFlag{
+				Name:  "compress-threshold",
+				Value: 256,
+				Usage: "超过该长度(字节)的数据包才压缩",
+			},
+			&CLI.StringSliceFlag{
+				Name:  "auth",
+				Value: CLI.NewStringSlice("udid", "certificate", "token"),
+				Usage: "启用的登陆方式(udid, certificate, token)",
+			},
+			&CLI.StringFlag{
+				Name:  "auth-accounts",
+				Value: "",
+				Usage: "本地账号文件(JSON)，为空则仅使用内存账号存储",
+			},
+			&CLI.StringFlag{
+				Name:  "auth-secret",
+				Value: "",
+				Usage: "票据登陆使用的HMAC密钥",
+			},
+			&CLI.BoolFlag{
+				Name:  "auth-guest",
+				Value: true,
+				Usage: "未知设备udid登陆时是否自动创建游客账号",
+			},
+			&CLI.StringFlag{
+				Name:  "limit-session",
+				Value: "",
+				Usage: "每个会话的发包限制(rate:burst:action，action为drop, delay, kick)，例如 30:60:delay，为空则不限制",
+			},
+			&CLI.StringFlag{
+				Name:  "limit-ip",
+				Value: "",
+				Usage: "同一IP全部会话的发包限制(rate:burst:action)，例如 300:600:drop，为空则不限制；位于负载均衡之后时须同时设置 --proxy-trusted",
+			},
+			&CLI.StringSliceFlag{
+				Name:  "limit-proto",
+				Usage: "单个协议号的发包限制(proto=rate:burst:action)，例如 1001=2:5:drop",
+			},
+			&CLI.IntFlag{
+				Name:  "max-message",
+				Value: PACKET.DEFAULT_MESSAGE_LIMIT,
+				Usage: "客户端消息的最大长度(字节)，超过65535字节的消息使用扩展帧传输",
+			},
+			&CLI.IntFlag{
+				Name:  "out-queue-packets",
+				Value: 512,
+				Usage: "每条连接发送队列最多容纳的数据包个数",
+			},
+			&CLI.IntFlag{
+				Name:  "out-queue-bytes",
+				Value: 1 << 20,
+				Usage: "每条连接发送队列最多容纳的字节数",
+			},
+			&CLI.StringFlag{
+				Name:  "out-policy",
+				Value: "drop",
+				Usage: "发送队列已满时的处理策略(kick, drop, coalesce)，drop与coalesce只作用于 --out-droppable 中的协议，其他协议踢掉客户端",
+			},
+			&CLI.StringSliceFlag{
+				Name:  "out-droppable",
+				Usage: "发送队列已满时可以丢弃或覆盖的协议号区间(begin-end)，例如 2000-2999",
+			},
+			&CLI.DurationFlag{
+				Name:  "drain-timeout",
+				Value: 60 * TIME.Second,
+				Usage: "排空时等待会话自然结束的最长时间(SIGTERM或 /admin/drain 触发)，0表示立即踢掉全部会话",
+			},
+			&CLI.StringFlag{
+				Name:  "drain-addr",
+				Value: "",
+				Usage: "排空时建议客户端重连的地址，为空表示从原入口重连",
+			},
+			&CLI.StringFlag{
+				Name:  "register-key",
+				Value: "",
+				Usage: "etcd中登记本Agent对外地址的目录，例如 /agents，排空时移除，为空则不登记",
+			},
+			&CLI.StringFlag{
+				Name:  "register-addr",
+				Value: ":8888",
+				Usage: "登记到 --register-key 的对外地址，未指定主机时使用本机名",
+			},
+			&CLI.StringFlag{
+				Name:  "presence",
+				Value: "memory",
+				Usage: "玩家在线表(memory, etcd)，同一玩家重复登陆时踢掉旧会话，memory只能发现同一Agent上的重复登陆",
+			},
+			&CLI.StringFlag{
+				Name:  "presence-key",
+				Value: "/online",
+				Usage: "etcd在线表的目录",
+			},
+			&CLI.StringSliceFlag{
+				Name:  "proxy-trusted",
+				Usage: "可信的负载均衡器网段(CIDR或IP)，来自这些地址的TCP连接必须以PROXY协议头(v1/v2)开始，会话记录协议头中的客户端地址",
+			},
+			&CLI.StringFlag{
+				Name:  "capture-dir",
+				Value: "",
+				Usage: "抓包文件目录，记录玩家解密后的收发数据包，可用 FKTools_Simulate 回放，为空则不抓包",
+			},
+			&CLI.IntSliceFlag{
+				Name:  "capture-users",
+				Usage: "需要抓包的玩家ID，也可以通过 /admin/capture 动态增删",
+			},
+			&CLI.Float64Flag{
+				Name:  "capture-sample",
+				Value: 0,
+				Usage: "按比例随机抓包的玩家(0-1)，0表示不采样",
+			},
+			&CLI.StringFlag{
+				Name:  "kcp-profile",
+				Value: "normal",
+				Usage: "KCP连接默认的调优参数(fast, normal, low-bandwidth 或 --kcp-profile-custom 中定义的名称)",
+			},
+			&CLI.StringSliceFlag{
+				Name:  "kcp-profile-custom",
+				Usage: "增加或覆盖KCP调优参数(name:nodelay,interval,resend,nc,sndwnd,rcvwnd[,mtu])，例如 battle:1,10,2,1,256,256,1200",
+			},
+			&CLI.BoolFlag{
+				Name:  "kcp-negotiate",
+				Usage: "允许客户端通过kcp_profile_req切换本连接的KCP调优参数",
+			},
+			&CLI.StringFlag{
+				Name:  "kcp-crypt",
+				Value: "none",
+				Usage: "KCP包加密算法(none, aes, aes-128, aes-192, salsa20, blowfish, twofish, cast5, 3des, tea, xtea, xor)，客户端必须一致",
+			},
+			&CLI.StringFlag{
+				Name:  "kcp-key",
+				Value: "",
+				Usage: "KCP包加密的预共享密钥",
+			},
+			&CLI.IntFlag{
+				Name:  "kcp-data-shards",
+				Value: 0,
+				Usage: "KCP前向纠错(Reed-Solomon)的数据分片数，0为关闭，客户端必须一致",
+			},
+			&CLI.IntFlag{
+				Name:  "kcp-parity-shards",
+				Value: 0,
+				Usage: "KCP前向纠错(Reed-Solomon)的校验分片数，0为关闭，客户端必须一致",
+			},
+			&CLI.DurationFlag{
+				Name:  "idle-timeout",
+				Value: 15 * TIME.Second,
+				Usage: "连接没有收到任何数据包的最长时间，超过后断开",
+			},
+			&CLI.DurationFlag{
+				Name:  "ping-interval",
+				Value: 5 * TIME.Second,
+				Usage: "已登陆的客户端静默超过该时间后Agent主动发起ping(server_ping_ack)，同时用于测量往返时延，应小于 --idle-timeout；只对支持server_ping的客户端生效，见 --client-feature",
+			},
+			&CLI.StringFlag{
+				Name:  "datagram-listen",
+				Value: "",
+				Usage: "不可靠数据报通道的UDP监听地址，例如 :8889，登陆成功后下发凭证，为空则不开启",
+			},
+			&CLI.StringFlag{
+				Name:  "client-version",
+				Value: "",
+				Usage: "支持的客户端协议版本区间，格式 min-max，例如 3-5，省略max表示不限制最高版本，为空则不限制",
+			},
+			&CLI.StringFlag{
+				Name:  "client-update-url",
+				Value: "",
+				Usage: "客户端版本过低时下发的新版本下载地址",
+			},
+			&CLI.StringSliceFlag{
+				Name:  "client-feature",
+				Usage: "按客户端协议版本开放的功能，格式 name:version，例如 datagram:4 server_ping:3，未设置的功能对全部版本开放，server_ping除外(须显式设置才会开启)",
+			},
+			&CLI.StringFlag{
+				Name:  "client-version-key",
+				Value: "",
+				Usage: "etcd中的客户端版本策略key，值为JSON，例如 {\"min\":3,\"max\":5,\"url\":\"...\",\"features\":{\"datagram\":4}}，设置后从etcd读取并监视变化",
+			},
+			&CLI.StringSliceFlag{
+				Name:  "acl",
+				Usage: "覆盖会话状态允许的协议号区间(state:begin-end,...)，state为connected, keyexchanged, authenticated, ingame, failover，例如 ingame:0,1001-32767",
+			},
+			&CLI.DurationFlag{
+				Name:  "write-timeout",
+				Value: 10 * TIME.Second,
+				Usage: "单次写入客户端的超时时间，超时视为客户端接收过慢并断开连接",
+			},
+			&CLI.StringFlag{
+				Name:  "admin-secret",
+				Value: "",
+				Usage: "运维接口(:6060/admin/)的共享密钥，为空则不启用运维接口",
+			},
+			&CLI.StringFlag{
+				Name:  "game-service",
+				Value: "game-10000",
+				Usage: "游戏服在etcd中的服务名",
+			},
+			&CLI.StringFlag{
+				Name:  "game-select",
+				Value: "fixed",
+				Usage: "游戏服选服策略(fixed, roundrobin, hash, leastonline)",
+			},
+			&CLI.StringFlag{
+				Name:  "game-id",
+				Value: MSGDEFINE.DEFAULT_GSID,
+				Usage: "fixed选服策略下固定选取的游戏服ID",
+			},
+			&CLI.StringSliceFlag{
+				Name:  "route",
+				Usage: "协议号路由表(begin-end:service)，未命中的协议由Agent处理，为空则 1001-32767 转发到 --game-service",
+			},
+			&CLI.StringFlag{
+				Name:  "route-key",
+				Value: "",
+				Usage: "etcd中的路由表key，设置后从etcd读取路由表并监视变化",
 			},
 		},
 		Action: func(c *CLI.Context) error {
@@ -63,14 +326,16 @@ func main() {
 			LOG.Println("自动发现依赖服务:", c.StringSlice("services"))
 
 			// 初始化服务
-			FRAMEWORK.Func_InitApp(c)
+			agent := FRAMEWORK.Func_InitApp(c)
 
-			// 启动TCP和UDP服务器监听
-			go FRAMEWORK.Func_StartTcpServer()
-			go FRAMEWORK.Func_StartUdpServer()
+			// 启动TCP、UDP和WebSocket服务器监听
+			if err := agent.Start(); err != nil {
+				LOG.Fatal("监听失败:", err)
+			}
 
-			// 持续等待
-			select {}
+			// 等待排空结束，全部会话协程结束后退出
+			<-agent.Done()
+			return nil
 		},
 	}
 
@@ -6,6 +6,7 @@ import (
 	ERRORS "errors"
 	IO "io"
 	STRCONV "strconv"
+	TIME "time"
 
 	METADATA "google.golang.org/grpc/metadata"
 
@@ -21,15 +22,17 @@ import (
 
 //---------------------------------------------
 const (
-	DEFAULT_CH_IPC_SIZE = 16 // 默认玩家异步IPC消息队列大小
-	CONST_ListenPort    = ":51000"
-	SERVICE             = "[GAME]"
+	DEFAULT_CH_IPC_SIZE   = 16   // 默认玩家异步IPC消息队列大小
+	DEFAULT_CH_AGENT_SIZE = 4096 // Agent控制流发送队列大小
+	CONST_ListenPort      = ":51000"
+	SERVICE               = "[GAME]"
 )
 
 //---------------------------------------------
 var (
 	ERROR_INCORRECT_FRAME_TYPE = ERRORS.New("incorrect frame type")
 	ERROR_SERVICE_NOT_BIND     = ERRORS.New("service not bind")
+	ERROR_AGENT_STREAM_RESET   = ERRORS.New("agent stream reset")
 )
 
 //---------------------------------------------
@@ -67,6 +70,11 @@ func (s *Server) func_Recv(stream PROTO.GameService_StreamServer, sess_die chan
 func (s *Server) Stream(stream PROTO.GameService_StreamServer) error {
 	// 无论如何，最终要输出异常
 	defer UTILS.PrintPanicStack()
+	// Agent控制流，用于广播与组播
+	if md, ok := METADATA.FromContext(stream.Context()); ok && len(md["agent"]) > 0 {
+		return s.func_AgentStream(stream, md["agent"][0])
+	}
+
 	// 初始化会话
 	var sess SESSION.Session
 	sess_die := make(chan struct{})
@@ -76,6 +84,7 @@ func (s *Server) Stream(stream PROTO.GameService_StreamServer) error {
 	// 无论如何，最终要关闭会话
 	defer func() {
 		LOGIC.Unregister(sess.UserId)
+		LOGIC.LeaveAllGroups(sess.UserId)
 		close(sess_die)
 		LOG.Debug("流关闭:", sess.UserId)
 	}()
@@ -98,6 +107,13 @@ func (s *Server) Stream(stream PROTO.GameService_StreamServer) error {
 		return ERROR_INCORRECT_FRAME_TYPE
 	}
 
+	// 客户端协议版本，旧版本的Agent不传入
+	if len(md["version"]) > 0 {
+		if version, err := STRCONV.Atoi(md["version"][0]); err == nil {
+			sess.Version = int32(version)
+		}
+	}
+
 	// 进行用户注册
 	sess.UserId = int32(userid)
 	LOGIC.Register(sess.UserId, ch_ipc)
@@ -139,13 +155,35 @@ func (s *Server) Stream(stream PROTO.GameService_StreamServer) error {
 				}
 
 				// 逻辑对会话的管理
-				if sess.Flag&SESSION.SESS_KICKED_OUT != 0 { // 逻辑要求踢掉客户端
-					if err := stream.Send(&PROTO.Game_Frame{Type: PROTO.Game_Kick}); err != nil {
+				if done, err := func_CheckSessionFlag(stream, &sess); done {
+					return err
+				}
+			case PROTO.Game_Datagram: // 从 客户端->网关->游戏服务器 的不可靠数据报，无法处理时丢弃
+				reader := PACKET.Reader(frame.Message)
+				c, err := reader.ReadS16()
+				if err != nil {
+					LOG.Warning("数据报格式错误:", err)
+					continue
+				}
+				handle := MSG.Handlers[c]
+				if handle == nil {
+					LOG.Warning("该数据报处理服务未被绑定:", c)
+					continue
+				}
+
+				// 处理结果同样以数据报回复
+				if ret := handle(&sess, reader); ret != nil {
+					if err := stream.Send(&PROTO.Game_Frame{Type: PROTO.Game_Datagram, Message: ret}); err != nil {
 						LOG.Error(err)
 						return err
 					}
-					return nil
 				}
+				if done, err := func_CheckSessionFlag(stream, &sess); done {
+					return err
+				}
+			case PROTO.Game_Latency: // Agent测得的客户端往返时延
+				sess.Rtt = TIME.Duration(frame.Rtt) * TIME.Millisecond
+				sess.Jitter = TIME.Duration(frame.Jitter) * TIME.Millisecond
 			case PROTO.Game_Ping:
 				if err := stream.Send(&PROTO.Game_Frame{Type: PROTO.Game_Ping, Message: frame.Message}); err != nil {
 					LOG.Error(err)
@@ -166,3 +204,70 @@ func (s *Server) Stream(stream PROTO.GameService_StreamServer) error {
 }
 
 //---------------------------------------------
+// Agent控制流
+// 逻辑通过LOGIC.Broadcast、LOGIC.Multicast等接口发出的帧，经由此流发给Agent
+func (s *Server) func_AgentStream(stream PROTO.GameService_StreamServer, agent string) error {
+	die := make(chan struct{})
+	ch_agent := s.func_Recv(stream, die)
+	ch_ctrl := make(chan *PROTO.Game_Frame, DEFAULT_CH_AGENT_SIZE)
+	replay, reset := LOGIC.RegisterAgent(agent, ch_ctrl)
+	LOG.Info("Agent控制流建立:", agent)
+
+	defer func() {
+		LOGIC.UnregisterAgent(ch_ctrl)
+		close(die)
+		LOG.Info("Agent控制流关闭:", agent)
+	}()
+
+	// 补发组成员
+	for _, frame := range replay {
+		if err := stream.Send(frame); err != nil {
+			LOG.Error(err)
+			return err
+		}
+	}
+
+	for {
+		select {
+		case frame, ok := <-ch_agent:
+			if !ok { // 链接已经被关闭
+				return nil
+			}
+			if frame.Type == PROTO.Game_Ping {
+				if err := stream.Send(&PROTO.Game_Frame{Type: PROTO.Game_Ping, Message: frame.Message}); err != nil {
+					LOG.Error(err)
+					return err
+				}
+			}
+		case frame := <-ch_ctrl:
+			if err := stream.Send(frame); err != nil {
+				LOG.Error(err)
+				return err
+			}
+		case <-reset: // 组成员帧无法入队，结束控制流，Agent重连后补发全部组成员
+			return ERROR_AGENT_STREAM_RESET
+		}
+	}
+}
+
+//---------------------------------------------
+// 处理逻辑对会话的要求，返回true时结束本条流
+func func_CheckSessionFlag(stream PROTO.GameService_StreamServer, sess *SESSION.Session) (bool, error) {
+	if sess.Flag&SESSION.SESS_REDIRECT != 0 { // 逻辑要求切换游戏服，Agent切换后会关闭本条流
+		sess.Flag &^= SESSION.SESS_REDIRECT
+		if err := stream.Send(&PROTO.Game_Frame{Type: PROTO.Game_Redirect, Target: sess.Target}); err != nil {
+			LOG.Error(err)
+			return true, err
+		}
+	}
+	if sess.Flag&SESSION.SESS_KICKED_OUT != 0 { // 逻辑要求踢掉客户端
+		if err := stream.Send(&PROTO.Game_Frame{Type: PROTO.Game_Kick, Code: sess.KickCode, Reason: sess.KickReason}); err != nil {
+			LOG.Error(err)
+			return true, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+//---------------------------------------------
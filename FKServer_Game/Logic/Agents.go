@@ -0,0 +1,233 @@
+//---------------------------------------------
+package Logic
+
+//---------------------------------------------
+/*
+	Agent控制流与组成员
+	每个Agent与本游戏服之间有一条控制流，广播、组播帧在每条控制流上只发送一次，由Agent分发给玩家
+	组成员以本游戏服为准，新的控制流建立时补发全部GroupJoin
+	控制流队列已满时广播、组播帧直接丢弃，组成员帧不能丢弃，等待超时后重置该控制流，由Agent重连后重新补发
+*/
+//---------------------------------------------
+import (
+	SYNC "sync"
+	TIME "time"
+
+	PROTO "FKGoServer/FKServer_Game/Proto"
+
+	LOG "github.com/Sirupsen/logrus"
+)
+
+//---------------------------------------------
+const (
+	MEMBERSHIP_SEND_TIMEOUT = 100 * TIME.Millisecond // 组成员帧入队的最长等待时间，超时后重置控制流
+)
+
+//---------------------------------------------
+// 一条Agent控制流
+type agent_stream struct {
+	id    string        // Agent标识
+	reset chan struct{} // 组成员帧无法入队时关闭，控制流随之结束
+}
+
+//---------------------------------------------
+type Agents struct {
+	agents map[chan *PROTO.Game_Frame]*agent_stream // 控制流发送队列 -> 控制流
+	groups map[string]map[int32]struct{}            // 组名 -> 玩家ID
+	SYNC.RWMutex
+}
+
+//---------------------------------------------
+var (
+	_default_agents Agents
+)
+
+//---------------------------------------------
+func init() {
+	_default_agents.init()
+}
+
+//---------------------------------------------
+func (a *Agents) init() {
+	a.agents = make(map[chan *PROTO.Game_Frame]*agent_stream)
+	a.groups = make(map[string]map[int32]struct{})
+}
+
+//---------------------------------------------
+// 登记Agent控制流，返回需要补发的GroupJoin帧，以及控制流需要重置的信号
+func (a *Agents) RegisterAgent(id string, ch chan *PROTO.Game_Frame) ([]*PROTO.Game_Frame, <-chan struct{}) {
+	a.Lock()
+	defer a.Unlock()
+	s := &agent_stream{id: id, reset: make(chan struct{})}
+	a.agents[ch] = s
+	frames := make([]*PROTO.Game_Frame, 0, len(a.groups))
+	for group, members := range a.groups {
+		frame := &PROTO.Game_Frame{Type: PROTO.Game_GroupJoin, Group: group}
+		for id := range members {
+			frame.UserIds = append(frame.UserIds, id)
+		}
+		frames = append(frames, frame)
+	}
+	return frames, s.reset
+}
+
+//---------------------------------------------
+// 移除Agent控制流
+func (a *Agents) UnregisterAgent(ch chan *PROTO.Game_Frame) {
+	a.Lock()
+	delete(a.agents, ch)
+	a.Unlock()
+}
+
+//---------------------------------------------
+// 发送到全部Agent，控制流队列已满时丢弃，不阻塞游戏逻辑
+// 必须持有锁
+func (a *Agents) send(frame *PROTO.Game_Frame) {
+	for ch, s := range a.agents {
+		select {
+		case ch <- frame:
+		default:
+			LOG.Errorf("Agent控制流队列已满，丢弃帧 Agent:%v 类型:%v", s.id, frame.Type)
+		}
+	}
+}
+
+//---------------------------------------------
+// 发送组成员帧到全部Agent，不能丢弃
+// 控制流队列已满时等待MEMBERSHIP_SEND_TIMEOUT，仍然无法入队则重置该控制流，Agent重连后补发全部组成员
+// 必须持有写锁
+func (a *Agents) send_membership(frame *PROTO.Game_Frame) {
+	for ch, s := range a.agents {
+		select {
+		case ch <- frame:
+			continue
+		default:
+		}
+		timer := TIME.NewTimer(MEMBERSHIP_SEND_TIMEOUT)
+		select {
+		case ch <- frame:
+		case <-timer.C:
+			LOG.Errorf("Agent控制流队列已满，重置控制流 Agent:%v 类型:%v", s.id, frame.Type)
+			delete(a.agents, ch)
+			close(s.reset)
+		}
+		timer.Stop()
+	}
+}
+
+//---------------------------------------------
+// 广播给全部位于本游戏服的玩家
+func (a *Agents) Broadcast(msg []byte) {
+	a.RLock()
+	a.send(&PROTO.Game_Frame{Type: PROTO.Game_Broadcast, Message: msg})
+	a.RUnlock()
+}
+
+//---------------------------------------------
+// 发送给指定的玩家
+func (a *Agents) Multicast(userids []int32, msg []byte) {
+	a.RLock()
+	a.send(&PROTO.Game_Frame{Type: PROTO.Game_Multicast, Message: msg, UserIds: userids})
+	a.RUnlock()
+}
+
+//---------------------------------------------
+// 发送给组内全部成员
+func (a *Agents) SendGroup(group string, msg []byte) {
+	a.RLock()
+	a.send(&PROTO.Game_Frame{Type: PROTO.Game_Multicast, Message: msg, Group: group})
+	a.RUnlock()
+}
+
+//---------------------------------------------
+// 玩家加入组
+func (a *Agents) JoinGroup(group string, userids ...int32) {
+	a.Lock()
+	defer a.Unlock()
+	members := a.groups[group]
+	if members == nil {
+		members = make(map[int32]struct{})
+		a.groups[group] = members
+	}
+	for _, id := range userids {
+		members[id] = struct{}{}
+	}
+	a.send_membership(&PROTO.Game_Frame{Type: PROTO.Game_GroupJoin, Group: group, UserIds: userids})
+}
+
+//---------------------------------------------
+// 玩家离开组，userids为空时解散组
+func (a *Agents) LeaveGroup(group string, userids ...int32) {
+	a.Lock()
+	defer a.Unlock()
+	if members := a.groups[group]; members != nil {
+		for _, id := range userids {
+			delete(members, id)
+		}
+		if len(userids) == 0 || len(members) == 0 {
+			delete(a.groups, group)
+		}
+	}
+	a.send_membership(&PROTO.Game_Frame{Type: PROTO.Game_GroupLeave, Group: group, UserIds: userids})
+}
+
+//---------------------------------------------
+// 玩家离开本游戏服，退出全部组
+func (a *Agents) LeaveAllGroups(userid int32) {
+	a.Lock()
+	defer a.Unlock()
+	for group, members := range a.groups {
+		if _, ok := members[userid]; !ok {
+			continue
+		}
+		delete(members, userid)
+		if len(members) == 0 {
+			delete(a.groups, group)
+			a.send_membership(&PROTO.Game_Frame{Type: PROTO.Game_GroupLeave, Group: group})
+		} else {
+			a.send_membership(&PROTO.Game_Frame{Type: PROTO.Game_GroupLeave, Group: group, UserIds: []int32{userid}})
+		}
+	}
+}
+
+//---------------------------------------------
+func RegisterAgent(id string, ch chan *PROTO.Game_Frame) ([]*PROTO.Game_Frame, <-chan struct{}) {
+	return _default_agents.RegisterAgent(id, ch)
+}
+
+//---------------------------------------------
+func UnregisterAgent(ch chan *PROTO.Game_Frame) {
+	_default_agents.UnregisterAgent(ch)
+}
+
+//---------------------------------------------
+func Broadcast(msg []byte) {
+	_default_agents.Broadcast(msg)
+}
+
+//---------------------------------------------
+func Multicast(userids []int32, msg []byte) {
+	_default_agents.Multicast(userids, msg)
+}
+
+//---------------------------------------------
+func SendGroup(group string, msg []byte) {
+	_default_agents.SendGroup(group, msg)
+}
+
+//---------------------------------------------
+func JoinGroup(group string, userids ...int32) {
+	_default_agents.JoinGroup(group, userids...)
+}
+
+//---------------------------------------------
+func LeaveGroup(group string, userids ...int32) {
+	_default_agents.LeaveGroup(group, userids...)
+}
+
+//---------------------------------------------
+func LeaveAllGroups(userid int32) {
+	_default_agents.LeaveAllGroups(userid)
+}
+
+//---------------------------------------------
@@ -0,0 +1,57 @@
+//---------------------------------------------
+package Logic
+
+//---------------------------------------------
+import (
+	"testing"
+
+	PROTO "FKGoServer/FKServer_Game/Proto"
+)
+
+//---------------------------------------------
+// 控制流队列已满时广播被丢弃，组成员帧重置控制流，重新登记后补发全部组成员
+func TestAgentsMembershipReset(t *testing.T) {
+	var a Agents
+	a.init()
+
+	ch := make(chan *PROTO.Game_Frame, 1)
+	replay, reset := a.RegisterAgent("agent1", ch)
+	if len(replay) != 0 {
+		t.Fatal("unexpected replay", replay)
+	}
+
+	a.JoinGroup("guild", 1, 2)
+	a.Broadcast([]byte("dropped"))
+	select {
+	case <-reset:
+		t.Fatal("broadcast should not reset the stream")
+	default:
+	}
+
+	a.LeaveGroup("guild", 1)
+	select {
+	case <-reset:
+	default:
+		t.Fatal("membership frame dropped without reset")
+	}
+	if frame := <-ch; frame.Type != PROTO.Game_GroupJoin {
+		t.Error("queued frame got", frame.Type)
+	}
+
+	// 重置后不再向该控制流发送
+	a.JoinGroup("team", 3)
+	if len(ch) != 0 {
+		t.Error("frame sent to reset stream")
+	}
+
+	replay, _ = a.RegisterAgent("agent1", make(chan *PROTO.Game_Frame, 1))
+	members := make(map[string][]int32)
+	for _, frame := range replay {
+		members[frame.Group] = frame.UserIds
+	}
+	if len(members) != 2 || len(members["guild"]) != 1 || members["guild"][0] != 2 || len(members["team"]) != 1 {
+		t.Error("replay got", members)
+	}
+}
+
+//---------------------------------------------
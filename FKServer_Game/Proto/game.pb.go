@@ -6,9 +6,11 @@
 Package proto is a generated protocol buffer package.
 
 It is generated from these files:
+
 	game.proto
 
 It has these top-level messages:
+
 	Game
 */
 package proto
@@ -36,20 +38,41 @@ const _ = proto1.ProtoPackageIsVersion2 // please upgrade the proto package
 type Game_FrameType int32
 
 const (
-	Game_Message Game_FrameType = 0
-	Game_Kick    Game_FrameType = 1
-	Game_Ping    Game_FrameType = 2
+	Game_Message    Game_FrameType = 0
+	Game_Kick       Game_FrameType = 1
+	Game_Ping       Game_FrameType = 2
+	Game_Redirect   Game_FrameType = 3
+	Game_Broadcast  Game_FrameType = 4
+	Game_Multicast  Game_FrameType = 5
+	Game_GroupJoin  Game_FrameType = 6
+	Game_GroupLeave Game_FrameType = 7
+	Game_Datagram   Game_FrameType = 8
+	Game_Latency    Game_FrameType = 9
 )
 
 var Game_FrameType_name = map[int32]string{
 	0: "Message",
 	1: "Kick",
 	2: "Ping",
+	3: "Redirect",
+	4: "Broadcast",
+	5: "Multicast",
+	6: "GroupJoin",
+	7: "GroupLeave",
+	8: "Datagram",
+	9: "Latency",
 }
 var Game_FrameType_value = map[string]int32{
-	"Message": 0,
-	"Kick":    1,
-	"Ping":    2,
+	"Message":    0,
+	"Kick":       1,
+	"Ping":       2,
+	"Redirect":   3,
+	"Broadcast":  4,
+	"Multicast":  5,
+	"GroupJoin":  6,
+	"GroupLeave": 7,
+	"Datagram":   8,
+	"Latency":    9,
 }
 
 func (x Game_FrameType) String() string {
@@ -68,6 +91,13 @@ func (*Game) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
 type Game_Frame struct {
 	Type    Game_FrameType `protobuf:"varint,1,opt,name=Type,enum=proto.Game_FrameType" json:"Type,omitempty"`
 	Message []byte         `protobuf:"bytes,2,opt,name=Message,proto3" json:"Message,omitempty"`
+	Target  string         `protobuf:"bytes,3,opt,name=Target" json:"Target,omitempty"`
+	UserIds []int32        `protobuf:"varint,4,rep,packed,name=UserIds" json:"UserIds,omitempty"`
+	Group   string         `protobuf:"bytes,5,opt,name=Group" json:"Group,omitempty"`
+	Code    int32          `protobuf:"varint,6,opt,name=Code" json:"Code,omitempty"`
+	Reason  string         `protobuf:"bytes,7,opt,name=Reason" json:"Reason,omitempty"`
+	Rtt     int32          `protobuf:"varint,8,opt,name=Rtt" json:"Rtt,omitempty"`
+	Jitter  int32          `protobuf:"varint,9,opt,name=Jitter" json:"Jitter,omitempty"`
 }
 
 func (m *Game_Frame) Reset()                    { *m = Game_Frame{} }
@@ -188,16 +218,25 @@ var _GameService_serviceDesc = grpc.ServiceDesc{
 func init() { proto1.RegisterFile("game.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 167 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xe2, 0xe2, 0x4a, 0x4f, 0xcc, 0x4d,
-	0xd5, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x05, 0x53, 0x4a, 0xc5, 0x5c, 0x2c, 0xee, 0x89,
-	0xb9, 0xa9, 0x52, 0xb6, 0x5c, 0xac, 0x6e, 0x45, 0x89, 0xb9, 0xa9, 0x42, 0xca, 0x5c, 0x2c, 0x21,
-	0x95, 0x05, 0xa9, 0x12, 0x8c, 0x0a, 0x8c, 0x1a, 0x7c, 0x46, 0xa2, 0x10, 0xd5, 0x7a, 0x20, 0x35,
-	0x7a, 0x60, 0x05, 0x20, 0x49, 0x21, 0x7e, 0x2e, 0x76, 0xdf, 0xd4, 0xe2, 0xe2, 0xc4, 0xf4, 0x54,
-	0x09, 0x26, 0x05, 0x46, 0x0d, 0x1e, 0x25, 0x1d, 0x2e, 0x4e, 0x84, 0x2c, 0x37, 0x5c, 0x56, 0x80,
-	0x41, 0x88, 0x83, 0x8b, 0xc5, 0x3b, 0x33, 0x39, 0x5b, 0x80, 0x11, 0xc4, 0x0a, 0xc8, 0xcc, 0x4b,
-	0x17, 0x60, 0x32, 0x72, 0xe4, 0xe2, 0x06, 0x19, 0x18, 0x9c, 0x5a, 0x54, 0x96, 0x99, 0x9c, 0x2a,
-	0x64, 0xc4, 0xc5, 0x16, 0x5c, 0x52, 0x94, 0x9a, 0x98, 0x2b, 0x24, 0x88, 0x61, 0x9d, 0x14, 0xa6,
-	0x90, 0x06, 0xa3, 0x01, 0x63, 0x12, 0x1b, 0x58, 0xd4, 0x18, 0x10, 0x00, 0x00, 0xff, 0xff, 0x92,
-	0x87, 0xcf, 0xaa, 0xd3, 0x00, 0x00, 0x00,
+	// 315 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x64, 0x90, 0x4b, 0x4e, 0xf3, 0x30,
+	0x14, 0x85, 0x7f, 0x37, 0x8f, 0x26, 0xb7, 0x8f, 0xdf, 0x58, 0x42, 0xb2, 0x3a, 0x8a, 0xca, 0x24,
+	0xa3, 0x0a, 0x95, 0x15, 0xf0, 0x10, 0x15, 0xa5, 0x95, 0x50, 0x5b, 0x16, 0x70, 0x49, 0xae, 0x22,
+	0x0b, 0x12, 0x47, 0x8e, 0x5b, 0xa9, 0xdb, 0x60, 0x15, 0xac, 0x84, 0x75, 0x21, 0x1b, 0x01, 0x83,
+	0x8e, 0xec, 0x73, 0xcf, 0xb1, 0xef, 0xa7, 0x03, 0x50, 0x61, 0x4d, 0xb3, 0xd6, 0x68, 0xab, 0x45,
+	0xe4, 0x8f, 0xe9, 0x67, 0x0f, 0xc2, 0x05, 0xd6, 0x34, 0xf9, 0x60, 0x10, 0xdd, 0x1b, 0xac, 0x49,
+	0x5c, 0x40, 0xb8, 0x3b, 0xb6, 0x24, 0x59, 0xc6, 0xf2, 0xf1, 0xfc, 0xfc, 0x3b, 0x3f, 0x73, 0xa1,
+	0x99, 0x0f, 0x38, 0x53, 0xfc, 0x87, 0xfe, 0x9a, 0xba, 0x0e, 0x2b, 0x92, 0xbd, 0x8c, 0xe5, 0x43,
+	0x31, 0x86, 0x78, 0x87, 0xa6, 0x22, 0x2b, 0x83, 0x8c, 0xe5, 0xa9, 0x0b, 0x3c, 0x77, 0x64, 0x1e,
+	0xca, 0x4e, 0x86, 0x59, 0x90, 0x47, 0x62, 0x04, 0xd1, 0xc2, 0xe8, 0x7d, 0x2b, 0x23, 0xef, 0x0f,
+	0x21, 0xbc, 0xd5, 0x25, 0xc9, 0x38, 0x63, 0x79, 0xe4, 0x5e, 0x6f, 0x08, 0x3b, 0xdd, 0xc8, 0xbe,
+	0x77, 0x07, 0x10, 0x6c, 0xac, 0x95, 0xc9, 0x8f, 0xb9, 0x54, 0xd6, 0x92, 0x91, 0xa9, 0xd3, 0xd3,
+	0x77, 0x06, 0xe9, 0x1f, 0xc9, 0xe0, 0x97, 0x84, 0xff, 0x13, 0x09, 0x84, 0x8f, 0xaa, 0x78, 0xe5,
+	0xcc, 0xdd, 0x9e, 0x54, 0x53, 0xf1, 0x9e, 0x18, 0x42, 0xb2, 0xa1, 0x52, 0x19, 0x2a, 0x2c, 0x0f,
+	0xc4, 0x08, 0xd2, 0x1b, 0xa3, 0xb1, 0x2c, 0xb0, 0xb3, 0x3c, 0x74, 0x72, 0xbd, 0x7f, 0xb3, 0xca,
+	0x4b, 0x07, 0x99, 0x7a, 0xc8, 0xa5, 0x56, 0x0d, 0x8f, 0xc5, 0x18, 0xc0, 0xcb, 0x15, 0xe1, 0x81,
+	0x78, 0xdf, 0x7d, 0x75, 0x87, 0x16, 0x2b, 0x83, 0x35, 0x4f, 0xdc, 0xe6, 0x15, 0x5a, 0x6a, 0x8a,
+	0x23, 0x4f, 0xe7, 0xd7, 0x30, 0x70, 0x15, 0x6d, 0xc9, 0x1c, 0x54, 0x41, 0x62, 0x0e, 0xf1, 0xd6,
+	0x1a, 0xc2, 0x5a, 0x9c, 0x9d, 0x14, 0x38, 0x39, 0x1d, 0xe5, 0xec, 0x92, 0xbd, 0xc4, 0x7e, 0x7a,
+	0xf5, 0x35, 0x00, 0xd0, 0x1d, 0x7e, 0x9d, 0xa7, 0x01, 0x00, 0x00,
 }
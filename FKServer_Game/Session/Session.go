@@ -1,9 +1,15 @@
 //---------------------------------------------
 package Session
 
+//---------------------------------------------
+import (
+	TIME "time"
+)
+
 //---------------------------------------------
 const (
 	SESS_KICKED_OUT = 0x1 // 踢掉
+	SESS_REDIRECT   = 0x2 // 要求Agent将玩家切换到Target指定的游戏服
 )
 
 //---------------------------------------------
@@ -11,8 +17,23 @@ const (
 // 会话是一个单独玩家的上下文，在连入后到退出前的整个生命周期内存在
 // 根据业务自行扩展上下文
 type Session struct {
-	Flag   int32 // 会话状态标记
-	UserId int32 // 用户唯一ID
+	Flag       int32  // 会话状态标记
+	UserId     int32  // 用户唯一ID
+	Target     string // 切换的目标游戏服ID，配合SESS_REDIRECT使用
+	KickCode   int32  // 踢掉的原因，由Agent下发给客户端，0表示由Agent填写默认值
+	KickReason string // 踢掉的原因说明
+
+	Rtt    TIME.Duration // Agent测得的客户端往返时延，用于延迟补偿，0表示还没有采样
+	Jitter TIME.Duration // 往返时延的抖动
+
+	Version int32 // 客户端协议版本，由Agent协商后随元数据传入，0表示客户端未声明
+}
+
+//---------------------------------------------
+// 要求Agent踢掉客户端，code见MsgDefine中的ERR_KICK_XXX
+func (sess *Session) Kick(code int32, reason string) {
+	sess.KickCode, sess.KickReason = code, reason
+	sess.Flag |= SESS_KICKED_OUT
 }
 
 //---------------------------------------------
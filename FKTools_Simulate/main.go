@@ -3,11 +3,12 @@ package main
 
 //---------------------------------------------
 import (
+	CIPHER "FKGoServer/FKLib_Common/Cipher"
+	COMPRESS "FKGoServer/FKLib_Common/Compress"
 	DH "FKGoServer/FKLib_Common/DH"
 	MSGDEFINE "FKGoServer/FKLib_Common/MsgDefine"
 	PACKET "FKGoServer/FKLib_Common/Packet"
-	RC4 "crypto/rc4"
-	BINARY "encoding/binary"
+	CAPTURE "FKGoServer/FKServer_Agent/Capture"
 	FMT "fmt"
 	IO "io"
 	LOG "log"
@@ -15,14 +16,16 @@ import (
 	RAND "math/rand"
 	NET "net"
 	OS "os"
+	STRCONV "strconv"
 	TIME "time"
 )
 
 //---------------------------------------------
 var (
 	seqid        = uint32(0)
-	encoder      *RC4.Cipher
-	decoder      *RC4.Cipher
+	encoder      CIPHER.Codec
+	decoder      CIPHER.Codec
+	compressor   *COMPRESS.Codec // v2握手协商出压缩算法时不为nil
 	KEY_EXCHANGE = false
 	SALT         = "DH"
 )
@@ -58,35 +61,28 @@ func main() {
 	}
 	defer conn.Close()
 
-	//get_seed_req
-	S1, M1 := DH.DHExchange()
-	S2, M2 := DH.DHExchange()
-	p2 := MSGDEFINE.S_seed_info{
-		int32(M1.Int64()),
-		int32(M2.Int64()),
-	}
-	rst := send_proto(conn, MSGDEFINE.Code["get_seed_req"], p2)
-	r1, _ := MSGDEFINE.PKT_seed_info(rst)
-	LOG.Printf("result: %#v", r1)
-
-	K1 := DH.DHKey(S1, BIG.NewInt(int64(r1.F_client_send_seed)))
-	K2 := DH.DHKey(S2, BIG.NewInt(int64(r1.F_client_receive_seed)))
-	encoder, err = RC4.NewCipher([]byte(FMT.Sprintf("%v%v", SALT, K1)))
-	if err != nil {
-		LOG.Println(err)
-		return
-	}
-	decoder, err = RC4.NewCipher([]byte(FMT.Sprintf("%v%v", SALT, K2)))
-	if err != nil {
+	// 设置了服务器公钥时使用v2握手，否则使用v1握手
+	if path := OS.Getenv("AGENT_PUBKEY"); path != "" {
+		if err := key_exchange_v2(conn, path); err != nil {
+			LOG.Println(err)
+			return
+		}
+	} else if err := key_exchange_v1(conn); err != nil {
 		LOG.Println(err)
 		return
 	}
 
 	KEY_EXCHANGE = true
 
+	//client_version_req
+	p2 := MSGDEFINE.S_version_info{
+		F_version: 1,
+	}
+	send_proto(conn, MSGDEFINE.Code["client_version_req"], p2)
+
 	//user_login_req
 	p3 := MSGDEFINE.S_user_login_info{
-		F_login_way:          0,
+		F_login_way:          MSGDEFINE.LOGIN_WAY_UDID,
 		F_open_udid:          "udid",
 		F_client_certificate: "qwertyuiopasdfgh",
 		F_client_version:     1,
@@ -100,6 +96,21 @@ func main() {
 	}
 	send_proto(conn, MSGDEFINE.Code["user_login_req"], p3)
 
+	// 设置了抓包文件时回放抓包，见Agent的 --capture-dir
+	if path := OS.Getenv("REPLAY_FILE"); path != "" {
+		speed := 1.0
+		if env := OS.Getenv("REPLAY_SPEED"); env != "" {
+			if speed, err = STRCONV.ParseFloat(env, 64); err != nil || speed <= 0 {
+				LOG.Println("bad REPLAY_SPEED:", env)
+				return
+			}
+		}
+		if err := replay(conn, path, speed); err != nil {
+			LOG.Println(err)
+		}
+		return
+	}
+
 	//heart_beat_req
 	p4 := MSGDEFINE.S_auto_id{
 		F_id: RAND.Int31(),
@@ -115,37 +126,134 @@ func main() {
 }
 
 //---------------------------------------------
-func send_proto(conn NET.Conn, p int16, info interface{}) (reader *PACKET.Packet) {
-	seqid++
-	payload := PACKET.Func_Pack(p, info, nil)
-	writer := PACKET.Writer()
-	writer.WriteU16(uint16(len(payload)) + 4)
+// v1握手: get_seed_req，DH+RC4
+func key_exchange_v1(conn NET.Conn) (err error) {
+	S1, M1 := DH.DHExchange()
+	S2, M2 := DH.DHExchange()
+	p2 := MSGDEFINE.S_seed_info{
+		int32(M1.Int64()),
+		int32(M2.Int64()),
+	}
+	rst := send_proto(conn, MSGDEFINE.Code["get_seed_req"], p2)
+	r1, _ := MSGDEFINE.PKT_seed_info(rst)
+	LOG.Printf("result: %#v", r1)
 
-	w := PACKET.Writer()
-	w.WriteU32(seqid)
-	w.WriteRawBytes(payload)
-	data := w.Data()
-	if KEY_EXCHANGE {
-		encoder.XORKeyStream(data, data)
+	K1 := DH.DHKey(S1, BIG.NewInt(int64(r1.F_client_send_seed)))
+	K2 := DH.DHKey(S2, BIG.NewInt(int64(r1.F_client_receive_seed)))
+	if encoder, err = CIPHER.NewRC4Codec([]byte(FMT.Sprintf("%v%v", SALT, K1))); err != nil {
+		return err
+	}
+	if decoder, err = CIPHER.NewRC4Codec([]byte(FMT.Sprintf("%v%v", SALT, K2))); err != nil {
+		return err
 	}
-	writer.WriteRawBytes(data)
-	conn.Write(writer.Data())
-	LOG.Printf("send : %#v", writer.Data())
+	return nil
+}
+
+//---------------------------------------------
+// v2握手: key_exchange_req，MODP-2048+RSA签名+AES-GCM
+func key_exchange_v2(conn NET.Conn, pubkey string) error {
+	pub, err := CIPHER.LoadPublicKey(pubkey)
+	if err != nil {
+		return err
+	}
+	hs, err := CIPHER.NewClientHandshake()
+	if err != nil {
+		return err
+	}
+	rst := send_proto(conn, MSGDEFINE.Code["key_exchange_req"], MSGDEFINE.S_key_exchange_info{
+		F_version:  CIPHER.HANDSHAKE_V2,
+		F_nonce:    string(hs.Nonce),
+		F_public:   string(hs.Public),
+		F_compress: COMPRESS.COMPRESS_SNAPPY | COMPRESS.COMPRESS_LZ4,
+	})
+	r1, _ := MSGDEFINE.PKT_key_exchange_info(rst)
+	LOG.Printf("handshake version: %v compress: %v", r1.F_version, COMPRESS.Name(r1.F_compress))
+	if r1.F_compress != COMPRESS.COMPRESS_NONE {
+		compressor = COMPRESS.NewCodec(r1.F_compress, COMPRESS.DEFAULT_THRESHOLD)
+	}
+
+	encoder, decoder, err = hs.Finish(pub, &CIPHER.ServerHello{
+		Nonce:     []byte(r1.F_nonce),
+		Public:    []byte(r1.F_public),
+		Signature: []byte(r1.F_signature),
+	})
+	return err
+}
+
+//---------------------------------------------
+// 回放抓包文件中客户端发出的数据包，按原始间隔除以speed发送
+// 握手、登陆和恢复会话由本工具重新完成，抓包中的这些协议跳过
+// 回复由单独的协程读取并打印，发送完毕后再等待一段时间接收剩余的回复
+func replay(conn NET.Conn, path string, speed float64) error {
+	f, err := OS.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cr, err := CAPTURE.NewReader(f)
+	if err != nil {
+		return err
+	}
+
+	skip := map[int16]bool{
+		MSGDEFINE.Code["get_seed_req"]:       true,
+		MSGDEFINE.Code["key_exchange_req"]:   true,
+		MSGDEFINE.Code["client_version_req"]: true,
+		MSGDEFINE.Code["user_login_req"]:     true,
+		MSGDEFINE.Code["session_resume_req"]: true,
+	}
+
+	go func() {
+		for {
+			reader, err := read_packet(conn)
+			if err != nil {
+				LOG.Println(err)
+				return
+			}
+			b, _ := reader.ReadS16()
+			LOG.Printf("recv : %v %v", b, MSGDEFINE.RCode[b])
+		}
+	}()
+
+	var last TIME.Time
+	count := 0
+	for {
+		r, err := cr.Next()
+		if err != nil {
+			if err != IO.EOF {
+				LOG.Println("capture file truncated:", err)
+			}
+			break
+		}
+		if r.Dir != CAPTURE.DIR_IN || skip[r.Proto] {
+			continue
+		}
+		if !last.IsZero() {
+			TIME.Sleep(TIME.Duration(float64(r.Time.Sub(last)) / speed))
+		}
+		last = r.Time
+		if err := write_packet(conn, r.Data); err != nil {
+			return err
+		}
+		count++
+		LOG.Printf("replay : %v %v", r.Proto, MSGDEFINE.RCode[r.Proto])
+	}
+	LOG.Printf("replayed %v packets", count)
+	TIME.Sleep(3 * TIME.Second)
+	return nil
+}
+
+//---------------------------------------------
+func send_proto(conn NET.Conn, p int16, info interface{}) (reader *PACKET.Packet) {
+	write_packet(conn, PACKET.Func_Pack(p, info, nil))
 	TIME.Sleep(TIME.Second)
 
 	//read
-	header := make([]byte, 2)
-	IO.ReadFull(conn, header)
-	size := BINARY.BigEndian.Uint16(header)
-	r := make([]byte, size)
-	_, err := IO.ReadFull(conn, r)
+	reader, err := read_packet(conn)
 	if err != nil {
 		LOG.Println(err)
+		return PACKET.Reader(nil)
 	}
-	if KEY_EXCHANGE {
-		decoder.XORKeyStream(r, r)
-	}
-	reader = PACKET.Reader(r)
 	b, err := reader.ReadS16()
 	if err != nil {
 		LOG.Println(err)
@@ -158,3 +266,45 @@ func send_proto(conn NET.Conn, p int16, info interface{}) (reader *PACKET.Packet
 }
 
 //---------------------------------------------
+// 发送明文数据包 PROTO|PAYLOAD，加上序号后压缩、加密
+func write_packet(conn NET.Conn, payload []byte) error {
+	seqid++
+	w := PACKET.Writer()
+	w.WriteU32(seqid)
+	w.WriteRawBytes(payload)
+	data := w.Data()
+	if KEY_EXCHANGE {
+		if compressor != nil {
+			data = compressor.Compress(data)
+		}
+		data = encoder.Seal(data)
+	}
+	// 超过65535字节的消息使用扩展帧发送
+	frames := PACKET.AppendFrames(nil, data)
+	_, err := conn.Write(frames)
+	LOG.Printf("send : %#v", frames)
+	return err
+}
+
+//---------------------------------------------
+// 读取一个数据包，解密、解压后返回
+func read_packet(conn NET.Conn) (*PACKET.Packet, error) {
+	header := make([]byte, 2)
+	r, err := PACKET.ReadMessage(conn, header, PACKET.DEFAULT_MESSAGE_LIMIT)
+	if err != nil {
+		return nil, err
+	}
+	if KEY_EXCHANGE {
+		if r, err = decoder.Open(r); err != nil {
+			return nil, err
+		}
+		if compressor != nil {
+			if r, err = compressor.Decompress(r); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return PACKET.Reader(r), nil
+}
+
+//---------------------------------------------